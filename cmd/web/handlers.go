@@ -20,18 +20,193 @@ type addInvoiceForm struct {
 	Nr_faktury string
 	NIP        string
 	Nazwa      string
-	Netto      float64
-	Podatek    float64
+	Pozycje    []models.InvoiceLine
 	Data       time.Time
-	Inv_type   models.InvoiceType
+	// DataSprzedazy and DataWplywu are optional, Okres is the deduction month chosen for a purchase
+	DataSprzedazy   time.Time
+	DataWplywu      time.Time
+	Okres           time.Time
+	TerminPlatnosci time.Time
+	SposobPlatnosci models.PaymentMethod
+	NrRachunku      string
+	Odliczenie      models.DeductionType
+	Inv_type        models.InvoiceType
+	Dokument        models.DocumentType
+	Transakcja      models.TransactionType
+	Oznaczenia      []models.Marker
+	Waluta          string
+	// KorektaDo is the id of the corrected invoice when the form is a correction
+	KorektaDo        int
+	PrzyczynaKorekty string
+	BladPierwotny    bool
 	validator.Validator
 }
 
+func newAddInvoiceForm() addInvoiceForm {
+	return addInvoiceForm{
+		Pozycje:    []models.InvoiceLine{{Ilosc: 1, Jednostka: "szt.", Stawka: models.Rate23}},
+		Dokument:   models.DocFaktura,
+		Transakcja: models.TxKrajowa,
+		Odliczenie: models.OdliczeniePelne,
+		Waluta:     models.PLN,
+	}
+}
+
+func newEditInvoiceForm(inv *models.Invoice, nazwa string) addInvoiceForm {
+	form := addInvoiceForm{
+		Nr_faktury:       inv.Nr_faktury,
+		NIP:              inv.NumerVat(),
+		Nazwa:            nazwa,
+		Pozycje:          inv.Pozycje,
+		Data:             inv.Data,
+		DataSprzedazy:    inv.DataSprzedazy,
+		DataWplywu:       inv.DataWplywu,
+		TerminPlatnosci:  inv.TerminPlatnosci,
+		SposobPlatnosci:  inv.SposobPlatnosci,
+		NrRachunku:       inv.NrRachunku,
+		Odliczenie:       inv.Odliczenie,
+		Inv_type:         inv.Inv_type,
+		Dokument:         inv.Dokument,
+		Transakcja:       inv.Transakcja,
+		Oznaczenia:       inv.Oznaczenia,
+		Waluta:           inv.Waluta,
+		KorektaDo:        inv.KorektaDo,
+		PrzyczynaKorekty: inv.PrzyczynaKorekty,
+		BladPierwotny:    inv.BladPierwotny,
+	}
+	if inv.Inv_type == models.PurchaseInvoice {
+		form.Okres = inv.Okres
+	}
+	return form
+}
+
+// newCorrectionForm starts a correction of the invoice with its lines reversed, so that the correction
+// cancels the invoice until the lines are changed to the actual differences.
+func newCorrectionForm(orig *models.Invoice, nazwa string) addInvoiceForm {
+	form := addInvoiceForm{
+		NIP:        orig.NumerVat(),
+		Nazwa:      nazwa,
+		Inv_type:   orig.Inv_type,
+		Dokument:   orig.Dokument,
+		Transakcja: orig.Transakcja,
+		Odliczenie: orig.Odliczenie,
+		Waluta:     orig.Waluta,
+		KorektaDo:  orig.Id,
+	}
+	for _, l := range orig.Pozycje {
+		l.Id = 0
+		l.Ilosc, l.Netto, l.Podatek, l.Brutto = -l.Ilosc, -l.Netto, -l.Podatek, -l.Brutto
+		form.Pozycje = append(form.Pozycje, l)
+	}
+	return form
+}
+
+func (f addInvoiceForm) invoice() *models.Invoice {
+	kodKraju, nip := validator.SplitVatNumber(f.NIP)
+	return &models.Invoice{
+		Nip:              nip,
+		KodKraju:         kodKraju,
+		Nr_faktury:       f.Nr_faktury,
+		Data:             f.Data,
+		DataSprzedazy:    f.DataSprzedazy,
+		DataWplywu:       f.DataWplywu,
+		Okres:            f.Okres,
+		TerminPlatnosci:  f.TerminPlatnosci,
+		SposobPlatnosci:  f.SposobPlatnosci,
+		NrRachunku:       f.NrRachunku,
+		Odliczenie:       f.Odliczenie,
+		Inv_type:         f.Inv_type,
+		Dokument:         f.Dokument,
+		Transakcja:       f.Transakcja,
+		Pozycje:          f.Pozycje,
+		Oznaczenia:       f.Oznaczenia,
+		Waluta:           f.Waluta,
+		KorektaDo:        f.KorektaDo,
+		PrzyczynaKorekty: f.PrzyczynaKorekty,
+		BladPierwotny:    f.BladPierwotny,
+	}
+}
+
+// mppMessage tells that the MPP marker of the stored invoice was added or taken away because the split
+// payment became mandatory or optional for it.
+func mppMessage(form addInvoiceForm, inv *models.Invoice) string {
+	mpp := slices.Contains(inv.Oznaczenia, "MPP")
+	switch {
+	case mpp && !form.HasMarker("MPP") && inv.WymagaMPP():
+		return " Faktura powyżej 15 000 zł brutto z towarami z załącznika 15 wymaga mechanizmu podzielonej płatności, dodano oznaczenie MPP."
+	case !mpp && form.HasMarker("MPP"):
+		return " Faktura nie wymaga już mechanizmu podzielonej płatności, usunięto dodane automatycznie oznaczenie MPP."
+	}
+	return ""
+}
+
+func (f addInvoiceForm) HasMarker(kod models.Marker) bool {
+	for _, o := range f.Oznaczenia {
+		if o == kod {
+			return true
+		}
+	}
+	return false
+}
+
 type confirmJpkForm struct {
 	UPO string
 	validator.Validator
 }
 
+type companyProfileForm struct {
+	PelnaNazwa    string
+	Email         string
+	Telefon       string
+	KodUrzedu     string
+	OsobaFizyczna bool
+	Imie          string
+	Nazwisko      string
+	DataUrodzenia string
+	Kwartalnie    bool
+	Proporcja     string
+	MetodaKasowa  bool
+	NrRachunku    string
+	validator.Validator
+}
+
+type correctJpkForm struct {
+	Uzasadnienie string
+	validator.Validator
+}
+
+type contractorForm struct {
+	Nip      string
+	Nazwa    string
+	KodKraju string
+	validator.Validator
+}
+
+type importRatesForm struct {
+	Zaimportowano int
+	validator.Validator
+}
+
+type importStatementForm struct {
+	Zaimportowano int
+	Dopasowano    int
+	validator.Validator
+}
+
+type paymentForm struct {
+	Data   string
+	Kwota  string
+	Sposob models.PaymentMethod
+	validator.Validator
+}
+
+type unlockPeriodForm struct {
+	Rok     int
+	Miesiac int
+	Powod   string
+	validator.Validator
+}
+
 type userSignupForm struct {
 	Name     string
 	Email    string
@@ -41,6 +216,13 @@ type userSignupForm struct {
 	validator.Validator
 }
 
+type companyUserForm struct {
+	Name     string
+	Email    string
+	Password string
+	validator.Validator
+}
+
 type userLoginForm struct {
 	Email    string
 	Password string
@@ -55,7 +237,10 @@ func (app *application) home(w http.ResponseWriter, r *http.Request) {
 		app.serverError(w, err)
 		return
 	}
-	data.Invoices = invoices
+	data.DocumentTypes = models.DocumentTypes
+	data.ZwrotTerminy = models.ZwrotTerminy
+	data.DokumentFilter = models.DocumentType(r.URL.Query().Get("dokument"))
+	data.Invoices = filterByDocument(invoices, data.DokumentFilter)
 	app.sessionManager.Put(r.Context(), "date", data.CurrentDate)
 	app.render(w, http.StatusOK, "home.tmpl", data)
 }
@@ -80,85 +265,52 @@ func (app *application) homePost(w http.ResponseWriter, r *http.Request) {
 		app.serverError(w, err)
 		return
 	}
-	data.Invoices = invoices
+	data.DocumentTypes = models.DocumentTypes
+	data.ZwrotTerminy = models.ZwrotTerminy
+	data.DokumentFilter = models.DocumentType(r.PostForm.Get("dokument"))
+	data.Invoices = filterByDocument(invoices, data.DokumentFilter)
 	app.sessionManager.Put(r.Context(), "date", data.CurrentDate)
 
 	app.render(w, http.StatusOK, "home.tmpl", data)
 }
 
 func (app *application) addInvoice(w http.ResponseWriter, r *http.Request) {
-	data := app.newTemplateData(r)
-	data.Form = addInvoiceForm{}
-	app.render(w, http.StatusOK, "add_invoice.tmpl", data)
+	app.renderInvoiceForm(w, r, http.StatusOK, newAddInvoiceForm(), nil)
 }
 
 func (app *application) addInvoicePost(w http.ResponseWriter, r *http.Request) {
-
-	err := r.ParseForm()
-	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
-		return
-	}
-	netto, err := strconv.ParseFloat(r.PostForm.Get("netto"), 64)
-	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
-		return
-	}
-	podatek, err := strconv.ParseFloat(r.PostForm.Get("podatek"), 64)
-	if err != nil {
+	form, err := app.parseInvoiceForm(r)
+	// corrections are only added through the correction form of the invoice they correct
+	if err != nil || form.KorektaDo != 0 {
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
-	data, err := time.Parse("2006-01-02", r.PostForm.Get("data"))
-	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
-		return
-	}
-	var inv_type models.InvoiceType
-	if r.PostForm.Get("type") == "PURC" {
-		inv_type = models.PurchaseInvoice
-	} else {
-		inv_type = models.SaleInvoice
-	}
-	nazwa := r.PostForm.Get("nazwa")
-	form := addInvoiceForm{
-		Nr_faktury: r.PostForm.Get("nr_faktury"),
-		NIP:        strings.ReplaceAll(strings.ReplaceAll(r.PostForm.Get("nip"), "-", ""), " ", ""),
-		Netto:      netto,
-		Podatek:    podatek,
-		Data:       data,
-		Nazwa:      nazwa,
-		Inv_type:   inv_type,
-	}
-
-	form.CheckField(validator.NotBlank(form.Nr_faktury), "nr_faktury", "Nr faktury nie może być pusty.")
-	form.CheckField(validator.NotBlank(form.NIP), "nip", "NIP nie może być pusty.")
-	form.CheckField(validator.NotBlank(form.Nazwa), "nazwa", "Nazwa firmy nie może być pusta.")
-	form.CheckField(validator.LengthNIP(form.NIP), "nip", "NIP musi mieć 10 cyfr.")
-	form.CheckField(validator.NumberNIP(form.NIP), "nip", "NIP musi składać się wyłącznie z cyfr.")
-	form.CheckField(validator.NotZero(form.Netto), "netto", "Wartość netto nie może wynosić zero.")
-	form.CheckField(validator.NotZero(form.Podatek), "podatek", "Wartość podatku nie może wynosić zero.")
-
 	if !form.Valid() {
-		tmpData := app.newTemplateData(r)
-		tmpData.Form = form
-		app.render(w, http.StatusUnprocessableEntity, "add_invoice.tmpl", tmpData)
+		app.renderInvoiceForm(w, r, http.StatusUnprocessableEntity, form, nil)
 		return
 	}
 	company_nip := app.getNIP(r)
-	id, err := app.invoices.Insert(form.NIP, form.Nr_faktury, float64(form.Netto), float64(form.Podatek), form.Data, form.Inv_type, form.Nazwa, company_nip)
+	inv := form.invoice()
+	id, err := app.invoices.Insert(inv, form.Nazwa, company_nip)
 	if err != nil {
-		app.serverError(w, err)
+		if errors.Is(err, models.ErrPeriodLocked) {
+			form.AddFieldError("data", periodLockedMessage(inv.Okres))
+			app.renderInvoiceForm(w, r, http.StatusUnprocessableEntity, form, nil)
+		} else if errors.Is(err, models.ErrNoExchangeRate) {
+			form.AddFieldError("waluta", noRateMessage(form.Waluta, inv.RateDay()))
+			app.renderInvoiceForm(w, r, http.StatusUnprocessableEntity, form, nil)
+		} else {
+			app.serverError(w, err)
+		}
 		return
 	}
 
-	app.sessionManager.Put(r.Context(), "flash", "Dodano fakturę.")
+	app.sessionManager.Put(r.Context(), "flash", "Dodano fakturę."+mppMessage(form, inv))
 
 	http.Redirect(w, r, fmt.Sprintf("/viewinvoice/%d", id), http.StatusSeeOther)
 }
 
-func (app *application) viewInvoice(w http.ResponseWriter, r *http.Request) {
-	// add current date to the newTemplateData constructor, check against it whether to display the delete button.
+func (app *application) editInvoice(w http.ResponseWriter, r *http.Request) {
 	params := httprouter.ParamsFromContext(r.Context())
 	id, err := strconv.Atoi(params.ByName("id"))
 	if err != nil || id < 1 {
@@ -167,10 +319,6 @@ func (app *application) viewInvoice(w http.ResponseWriter, r *http.Request) {
 	}
 	company_nip := app.getNIP(r)
 	inv, cname, err := app.invoices.Get(id, company_nip)
-	data := app.newTemplateData(r)
-	data.Invoice = inv
-	data.InvDeletable = inv.IsPreviousMonth()
-	data.CompanyName = cname
 	if err != nil {
 		if errors.Is(err, models.ErrNoRecord) {
 			app.notFound(w)
@@ -179,124 +327,290 @@ func (app *application) viewInvoice(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
-
-	app.render(w, http.StatusOK, "view_invoice.tmpl", data)
+	app.renderInvoiceForm(w, r, http.StatusOK, newEditInvoiceForm(inv, cname), inv)
 }
 
-func (app *application) deleteInvoice(w http.ResponseWriter, r *http.Request) {
-	company_nip := app.getNIP(r)
+func (app *application) editInvoicePost(w http.ResponseWriter, r *http.Request) {
 	params := httprouter.ParamsFromContext(r.Context())
 	id, err := strconv.Atoi(params.ByName("id"))
-	if err != nil {
+	if err != nil || id < 1 {
 		app.notFound(w)
 		return
 	}
-	err = app.invoices.Delete(id, company_nip)
+	company_nip := app.getNIP(r)
+	stored, _, err := app.invoices.Get(id, company_nip)
 	if err != nil {
-		app.serverError(w, err)
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	form, err := app.parseInvoiceForm(r)
+	if err != nil || form.KorektaDo != stored.KorektaDo {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	if !form.Valid() {
+		app.renderInvoiceForm(w, r, http.StatusUnprocessableEntity, form, stored)
+		return
+	}
+	inv := form.invoice()
+	inv.Id = id
+	userId := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	err = app.invoices.Update(inv, form.Nazwa, company_nip, userId)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else if errors.Is(err, models.ErrNotCorrectable) {
+			// the corrected invoice was changed into a document that is not corrected by invoices
+			app.sessionManager.Put(r.Context(), "flash", notCorrectableMessage)
+			http.Redirect(w, r, fmt.Sprintf("/viewinvoice/%d", id), http.StatusSeeOther)
+		} else if errors.Is(err, models.ErrPeriodLocked) {
+			// either the stored or the new period may be the locked one
+			locked := inv.Okres
+			if ok, _ := app.locks.Locked(company_nip, stored.Okres); ok {
+				locked = stored.Okres
+			}
+			form.AddFieldError("data", periodLockedMessage(locked))
+			app.renderInvoiceForm(w, r, http.StatusUnprocessableEntity, form, stored)
+		} else if errors.Is(err, models.ErrNoExchangeRate) {
+			form.AddFieldError("waluta", noRateMessage(form.Waluta, inv.RateDay()))
+			app.renderInvoiceForm(w, r, http.StatusUnprocessableEntity, form, stored)
+		} else {
+			app.serverError(w, err)
+		}
 		return
 	}
 
-	app.sessionManager.Put(r.Context(), "flash", "Usunięto fakturę.")
+	app.sessionManager.Put(r.Context(), "flash", "Zapisano zmiany faktury."+mppMessage(form, inv))
 
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	http.Redirect(w, r, fmt.Sprintf("/viewinvoice/%d", id), http.StatusSeeOther)
 }
 
-func (app *application) viewJpk(w http.ResponseWriter, r *http.Request) {
+func (app *application) correctInvoice(w http.ResponseWriter, r *http.Request) {
 	params := httprouter.ParamsFromContext(r.Context())
 	id, err := strconv.Atoi(params.ByName("id"))
-	if err != nil {
+	if err != nil || id < 1 {
 		app.notFound(w)
 		return
 	}
 	company_nip := app.getNIP(r)
-	data := app.newTemplateData(r)
-	data.Jpk, data.JpkMetadata, err = app.jpks.Get(id, company_nip)
+	orig, cname, err := app.invoices.Get(id, company_nip)
 	if err != nil {
-		app.serverError(w, err)
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
 		return
 	}
-	app.render(w, http.StatusOK, "view_jpk.tmpl", data)
-}
-
-func (app *application) viewAllJpk(w http.ResponseWriter, r *http.Request) {
-	company_nip := app.getNIP(r)
-	jpks, err := app.jpks.GetAll(company_nip)
-	if err != nil {
-		app.serverError(w, err)
+	if !orig.Correctable() {
+		app.sessionManager.Put(r.Context(), "flash", notCorrectableMessage)
+		http.Redirect(w, r, fmt.Sprintf("/viewinvoice/%d", id), http.StatusSeeOther)
+		return
 	}
-	slices.Reverse(jpks)
-	data := app.newTemplateData(r)
-	data.JpkListData = jpks
-	app.render(w, http.StatusOK, "jpk_files.tmpl", data)
+	app.renderInvoiceForm(w, r, http.StatusOK, newCorrectionForm(orig, cname), nil)
 }
 
-func (app *application) addJpk(w http.ResponseWriter, r *http.Request) {
+func (app *application) correctInvoicePost(w http.ResponseWriter, r *http.Request) {
 	params := httprouter.ParamsFromContext(r.Context())
-	company_nip := app.getNIP(r)
-	data := app.newTemplateData(r)
-	date, err := time.Parse("2006-01", params.ByName("date"))
-	data.CurrentDate = date
-	invoices, err := app.invoices.GetAll(company_nip, data.CurrentDate)
-	if err != nil {
-		app.serverError(w, err)
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
 		return
 	}
-
-	jpk, err := app.jpks.NewJpk(invoices, data.CurrentDate)
-
-	if err != nil {
-		app.serverError(w, err)
+	form, err := app.parseInvoiceForm(r)
+	if err != nil || form.KorektaDo != id {
+		app.clientError(w, http.StatusBadRequest)
 		return
 	}
-	Header := `<?xml version="1.0" encoding="UTF-8"?>` + "\n"
-	out, err := xml.MarshalIndent(jpk, "", "  ")
-	if err != nil {
-		app.serverError(w, err)
+	if !form.Valid() {
+		app.renderInvoiceForm(w, r, http.StatusUnprocessableEntity, form, nil)
 		return
 	}
-	out = []byte(Header + string(out))
-	id, err := app.jpks.InsertDB(jpk, string(out), company_nip)
+	company_nip := app.getNIP(r)
+	inv := form.invoice()
+	korektaId, err := app.invoices.Insert(inv, form.Nazwa, company_nip)
 	if err != nil {
-		app.serverError(w, err)
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else if errors.Is(err, models.ErrNotCorrectable) {
+			app.sessionManager.Put(r.Context(), "flash", notCorrectableMessage)
+			http.Redirect(w, r, fmt.Sprintf("/viewinvoice/%d", id), http.StatusSeeOther)
+		} else if errors.Is(err, models.ErrPeriodLocked) {
+			form.AddFieldError("data", periodLockedMessage(inv.Okres))
+			app.renderInvoiceForm(w, r, http.StatusUnprocessableEntity, form, nil)
+		} else {
+			app.serverError(w, err)
+		}
 		return
 	}
 
-	app.sessionManager.Put(r.Context(), "flash", "Wygenerowano JPK.")
-
-	// redirect to view jpk.
-	http.Redirect(w, r, fmt.Sprintf("/jpk/view/%d", id), http.StatusSeeOther)
+	app.sessionManager.Put(r.Context(), "flash", "Dodano korektę faktury.")
 
+	http.Redirect(w, r, fmt.Sprintf("/viewinvoice/%d", korektaId), http.StatusSeeOther)
 }
 
-func (app *application) deleteJpk(w http.ResponseWriter, r *http.Request) {
-	params := httprouter.ParamsFromContext(r.Context())
-	id, err := strconv.Atoi(params.ByName("id"))
+// parseInvoiceForm reads and validates the invoice form shared by adding and editing. The error is only
+// set when the request cannot be read at all.
+func (app *application) parseInvoiceForm(r *http.Request) (addInvoiceForm, error) {
+	err := r.ParseForm()
 	if err != nil {
-		app.notFound(w)
-		return
+		return addInvoiceForm{}, err
 	}
-	company_nip := app.getNIP(r)
-	err = app.jpks.Delete(id, company_nip)
+	pozycje, err := parseInvoiceLines(r.PostForm)
 	if err != nil {
-		app.serverError(w, err)
-		return
+		return addInvoiceForm{}, err
+	}
+	data, err := time.Parse("2006-01-02", r.PostForm.Get("data"))
+	if err != nil {
+		return addInvoiceForm{}, err
+	}
+	var inv_type models.InvoiceType
+	if r.PostForm.Get("type") == "PURC" {
+		inv_type = models.PurchaseInvoice
+	} else {
+		inv_type = models.SaleInvoice
+	}
+	nazwa := r.PostForm.Get("nazwa")
+	form := addInvoiceForm{
+		Nr_faktury: r.PostForm.Get("nr_faktury"),
+		NIP:        strings.ToUpper(strings.ReplaceAll(strings.ReplaceAll(r.PostForm.Get("nip"), "-", ""), " ", "")),
+		Pozycje:    pozycje,
+		Data:       data,
+		Nazwa:      nazwa,
+		Inv_type:   inv_type,
+		Dokument:   models.DocumentType(r.PostForm.Get("dokument")),
+		Transakcja: models.TransactionType(r.PostForm.Get("transakcja")),
+		Oznaczenia: parseMarkers(r.PostForm, inv_type),
+		Waluta:     r.PostForm.Get("waluta"),
+	}
+	if korektaDo := r.PostForm.Get("korekta_do"); korektaDo != "" {
+		form.KorektaDo, err = strconv.Atoi(korektaDo)
+		if err != nil {
+			return addInvoiceForm{}, err
+		}
+		form.PrzyczynaKorekty = strings.TrimSpace(r.PostForm.Get("przyczyna_korekty"))
+		form.BladPierwotny = inv_type == models.SaleInvoice && r.PostForm.Get("blad_pierwotny") != ""
+		form.CheckField(validator.NotBlank(form.PrzyczynaKorekty), "przyczyna_korekty", "Podaj przyczynę korekty.")
+	}
+	form.DataSprzedazy, err = parseOptionalTime("2006-01-02", r.PostForm.Get("data_sprzedazy"))
+	if err != nil {
+		return addInvoiceForm{}, err
+	}
+	form.TerminPlatnosci, err = parseOptionalTime("2006-01-02", r.PostForm.Get("termin_platnosci"))
+	if err != nil {
+		return addInvoiceForm{}, err
 	}
+	form.CheckField(form.TerminPlatnosci.IsZero() || !form.TerminPlatnosci.Before(form.Data), "termin_platnosci", "Termin płatności nie może być wcześniejszy niż data wystawienia.")
+	form.SposobPlatnosci = models.PaymentMethod(r.PostForm.Get("sposob_platnosci"))
+	form.CheckField(form.SposobPlatnosci == "" || validator.PermittedValue(form.SposobPlatnosci, models.PaymentMethods...), "sposob_platnosci", "Nieprawidłowy sposób płatności.")
+	form.NrRachunku = validator.CompactAccount(r.PostForm.Get("nr_rachunku"))
+	form.CheckField(form.NrRachunku == "" || validator.AccountNumber(form.NrRachunku), "nr_rachunku", "Nieprawidłowy numer rachunku bankowego.")
+	form.Odliczenie = models.OdliczeniePelne
+	if inv_type == models.PurchaseInvoice {
+		form.Odliczenie = models.DeductionType(r.PostForm.Get("odliczenie"))
+		form.CheckField(validator.PermittedValue(form.Odliczenie, models.DeductionTypes...), "odliczenie", "Nieprawidłowy sposób odliczenia.")
+		form.DataWplywu, err = parseOptionalTime("2006-01-02", r.PostForm.Get("data_wplywu"))
+		if err != nil {
+			return addInvoiceForm{}, err
+		}
+		form.Okres, err = parseOptionalTime("2006-01", r.PostForm.Get("okres"))
+		if err != nil {
+			return addInvoiceForm{}, err
+		}
+		form.CheckField(form.DataWplywu.IsZero() || !form.DataWplywu.Before(form.Data), "data_wplywu", "Data wpływu nie może być wcześniejsza niż data wystawienia.")
+		if !form.Okres.IsZero() {
+			form.CheckField(validator.PermittedValue(form.Okres, form.invoice().DeductionPeriods()...), "okres", "Podatek naliczony można odliczyć w miesiącu otrzymania faktury lub w jednym z trzech kolejnych miesięcy.")
+		}
+	}
+	form.CheckField(validator.PermittedValue(form.Waluta, models.Waluty...), "waluta", "Nieobsługiwana waluta.")
 
-	app.sessionManager.Put(r.Context(), "flash", "Usunięto wersję roboczą JPK.")
+	form.CheckField(validator.NotBlank(form.Nr_faktury), "nr_faktury", "Nr faktury nie może być pusty.")
+	form.CheckField(validator.PermittedValue(form.Dokument, form.Inv_type.Documents()...), "dokument", "Ten rodzaj dokumentu nie pasuje do typu faktury.")
+	form.CheckField(validator.PermittedValue(form.Transakcja, form.Inv_type.Transactions()...), "transakcja", "Ten rodzaj transakcji nie pasuje do typu faktury.")
+	if form.Transakcja != models.TxKrajowa {
+		form.CheckField(form.Dokument == models.DocFaktura, "transakcja", "Transakcje zagraniczne i odwrotne obciążenie dokumentuje się fakturą VAT.")
+	}
+	// documents without a contractor NIP are reported as "brak"
+	if form.Dokument.RequiresContractor() || form.NIP != "" {
+		form.CheckField(validator.NotBlank(form.NIP), "nip", "NIP nie może być pusty.")
+		form.CheckField(validator.NotBlank(form.Nazwa), "nazwa", "Nazwa firmy nie może być pusta.")
+		kodKraju, nip := validator.SplitVatNumber(form.NIP)
+		checkVatNumber(&form.Validator, "nip", kodKraju, nip)
+		switch form.Transakcja {
+		case models.TxWDT, models.TxWNT:
+			form.CheckField(kodKraju != "PL", "nip", "WDT i WNT wymagają numeru VAT UE kontrahenta z prefiksem kraju.")
+		case models.TxOdwrotneObciazenie:
+			form.CheckField(kodKraju == "PL", "nip", "Odwrotne obciążenie krajowe wymaga polskiego NIP dostawcy.")
+		}
+	}
+	if form.Transakcja == models.TxWDT {
+		for i, l := range form.Pozycje {
+			form.CheckField(l.Stawka == models.Rate0, "pozycje", fmt.Sprintf("Pozycja %d: dostawa wewnątrzwspólnotowa jest opodatkowana stawką 0%%.", i+1))
+		}
+	}
+	form.CheckField(len(form.Pozycje) > 0, "pozycje", "Faktura musi mieć co najmniej jedną pozycję.")
+	for i, l := range form.Pozycje {
+		form.CheckField(validator.NotBlank(l.Opis), "pozycje", fmt.Sprintf("Pozycja %d: opis nie może być pusty.", i+1))
+		if form.KorektaDo != 0 {
+			// the lines of a correction are differences and may be negative
+			form.CheckField(l.Ilosc != 0, "pozycje", fmt.Sprintf("Pozycja %d: ilość nie może być zerowa.", i+1))
+			form.CheckField(l.CenaNetto != 0, "pozycje", fmt.Sprintf("Pozycja %d: cena netto nie może być zerowa.", i+1))
+		} else {
+			form.CheckField(validator.NotZero(l.Ilosc), "pozycje", fmt.Sprintf("Pozycja %d: ilość musi być większa od zera.", i+1))
+			form.CheckField(validator.NotZero(l.CenaNetto), "pozycje", fmt.Sprintf("Pozycja %d: cena netto musi być większa od zera.", i+1))
+		}
+		form.CheckField(l.InRange(), "pozycje", fmt.Sprintf("Pozycja %d: ilość, cena netto lub wartość pozycji przekracza dopuszczalny zakres.", i+1))
+		form.CheckField(validator.PermittedValue(l.Stawka, models.VatRates...), "pozycje", fmt.Sprintf("Pozycja %d: nieprawidłowa stawka VAT.", i+1))
+	}
+	for _, o := range form.Oznaczenia {
+		form.CheckField(validator.PermittedValue(o, form.Inv_type.Markers()...), "oznaczenia", fmt.Sprintf("Nieprawidłowe oznaczenie %s.", o))
+	}
+	return form, nil
+}
 
-	http.Redirect(w, r, "/jpk/viewall", http.StatusSeeOther)
+// renderInvoiceForm renders the add invoice page, or the edit page when the stored invoice is given. The
+// contractor registry is passed along for the NIP and name suggestions.
+func (app *application) renderInvoiceForm(w http.ResponseWriter, r *http.Request, status int, form addInvoiceForm, stored *models.Invoice) {
+	contractors, err := app.contractors.All(app.getNIP(r), "")
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	data := app.newTemplateData(r)
+	if form.KorektaDo != 0 {
+		data.CorrectedInvoice, _, err = app.invoices.Get(form.KorektaDo, app.getNIP(r))
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+	data.Form = form
+	data.Invoice = stored
+	data.Contractors = contractors
+	data.VatRates = models.VatRates
+	data.SaleMarkers = models.SaleMarkers
+	data.PurchaseMarkers = models.PurchaseMarkers
+	data.DocumentTypes = models.DocumentTypes
+	data.TransactionTypes = models.TransactionTypes
+	data.DeductionTypes = models.DeductionTypes
+	data.Waluty = models.Waluty
+	data.PaymentMethods = models.PaymentMethods
+	app.render(w, status, "add_invoice.tmpl", data)
 }
 
-func (app *application) downloadJpk(w http.ResponseWriter, r *http.Request) {
+func (app *application) viewInvoice(w http.ResponseWriter, r *http.Request) {
+	// add current date to the newTemplateData constructor, check against it whether to display the delete button.
 	params := httprouter.ParamsFromContext(r.Context())
 	id, err := strconv.Atoi(params.ByName("id"))
-	if err != nil {
-		app.serverError(w, err)
+	if err != nil || id < 1 {
+		app.notFound(w)
 		return
 	}
-	company_nip := app.getNIP(r)
-	fileContent, err := app.jpks.GetContent(id, company_nip)
+	data, err := app.invoiceData(r, id)
 	if err != nil {
 		if errors.Is(err, models.ErrNoRecord) {
 			app.notFound(w)
@@ -305,55 +619,1340 @@ func (app *application) downloadJpk(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"jpk_v7m_%d.xml\"", id))
-	w.Header().Set("Content-Type", "application/xml")
-	w.Header().Set("Content-Length", strconv.Itoa(len(fileContent)))
+	sposob := data.Invoice.SposobPlatnosci
+	if sposob == "" {
+		sposob = models.PlatnoscPrzelew
+	}
+	data.Form = paymentForm{Data: time.Now().Format("2006-01-02"), Sposob: sposob}
 
-	http.ServeContent(w, r, "jpk.xml", time.Now(), bytes.NewReader(fileContent))
+	app.render(w, http.StatusOK, "view_invoice.tmpl", data)
 }
 
-func (app *application) confirmJpk(w http.ResponseWriter, r *http.Request) {
+func (app *application) invoiceData(r *http.Request, id int) (*templateData, error) {
+	company_nip := app.getNIP(r)
+	inv, cname, err := app.invoices.Get(id, company_nip)
+	if err != nil {
+		return nil, err
+	}
+	data := app.newTemplateData(r)
+	data.Invoice = inv
+	data.InvDeletable = inv.IsPreviousMonth()
+	data.CompanyName = cname
+	data.InvoiceHistory, err = app.invoices.History(id, company_nip)
+	if err != nil {
+		return nil, err
+	}
+	data.PeriodLocked, err = app.locks.Locked(company_nip, inv.Okres)
+	if err != nil {
+		return nil, err
+	}
+	data.Payments, err = app.payments.ForInvoice(id, company_nip)
+	if err != nil {
+		return nil, err
+	}
+	data.Zaplacono = models.Zaplacono(data.Payments)
+	profile, err := app.profiles.Get(company_nip)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		return nil, err
+	}
+	data.MetodaKasowa = profile != nil && profile.MetodaKasowa
+	data.PaymentMethods = models.PaymentMethods
+	return data, nil
+}
+
+func (app *application) addPaymentPost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+	err = r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	data, err := app.invoiceData(r, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	form := paymentForm{
+		Data:   r.PostForm.Get("data"),
+		Kwota:  strings.TrimSpace(r.PostForm.Get("kwota")),
+		Sposob: models.PaymentMethod(r.PostForm.Get("sposob")),
+	}
+	dzien, err := time.Parse("2006-01-02", form.Data)
+	form.CheckField(err == nil, "data", "Podaj poprawną datę płatności.")
+	kwota, err := models.ParseMoney(form.Kwota)
+	form.CheckField(err == nil && kwota > 0, "kwota", "Kwota płatności musi być większa od zera.")
+	form.CheckField(validator.PermittedValue(form.Sposob, models.PaymentMethods...), "sposob", "Nieprawidłowy sposób płatności.")
+	if form.Valid() {
+		form.CheckField(data.Zaplacono+kwota <= data.Invoice.BruttoWaluta(), "kwota", fmt.Sprintf("Do zapłaty zostało %v %s.", data.Invoice.BruttoWaluta()-data.Zaplacono, data.Invoice.Waluta))
+	}
+	if !form.Valid() {
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "view_invoice.tmpl", data)
+		return
+	}
+	_, err = app.payments.Insert(&models.Payment{InvoiceId: id, Data: dzien, Kwota: kwota, Sposob: form.Sposob}, app.getNIP(r))
+	if err != nil {
+		if errors.Is(err, models.ErrPeriodLocked) {
+			app.sessionManager.Put(r.Context(), "flash", "Okres płatności jest zamknięty. Dodanie płatności wymaga odblokowania okresu i korekty JPK.")
+			http.Redirect(w, r, fmt.Sprintf("/viewinvoice/%d", id), http.StatusSeeOther)
+		} else if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash", "Dodano płatność.")
+	http.Redirect(w, r, fmt.Sprintf("/viewinvoice/%d", id), http.StatusSeeOther)
+}
+
+func (app *application) deletePaymentPost(w http.ResponseWriter, r *http.Request) {
 	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+	invoiceId, err := app.payments.Delete(id, app.getNIP(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else if errors.Is(err, models.ErrPeriodLocked) {
+			app.sessionManager.Put(r.Context(), "flash", "Okres płatności jest zamknięty. Usunięcie wymaga odblokowania okresu i korekty JPK.")
+			http.Redirect(w, r, fmt.Sprintf("/viewinvoice/%d", invoiceId), http.StatusSeeOther)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash", "Usunięto płatność.")
+	http.Redirect(w, r, fmt.Sprintf("/viewinvoice/%d", invoiceId), http.StatusSeeOther)
+}
+
+func (app *application) deleteInvoice(w http.ResponseWriter, r *http.Request) {
 	company_nip := app.getNIP(r)
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.notFound(w)
+		return
+	}
+	err = app.invoices.Delete(id, company_nip)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else if errors.Is(err, models.ErrPeriodLocked) {
+			app.sessionManager.Put(r.Context(), "flash", "Okres faktury jest zamknięty. Usunięcie wymaga odblokowania okresu i korekty JPK.")
+			http.Redirect(w, r, fmt.Sprintf("/viewinvoice/%d", id), http.StatusSeeOther)
+		} else if errors.Is(err, models.ErrHasCorrections) {
+			app.sessionManager.Put(r.Context(), "flash", "Faktura ma wystawione korekty. Usuń najpierw korekty.")
+			http.Redirect(w, r, fmt.Sprintf("/viewinvoice/%d", id), http.StatusSeeOther)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Usunięto fakturę.")
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (app *application) viewJpk(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
 	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.notFound(w)
+		return
+	}
+	company_nip := app.getNIP(r)
+	data := app.newTemplateData(r)
+	data.Jpk, data.JpkMetadata, err = app.jpks.Get(id, company_nip)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	data.JpkChain, err = app.jpks.Chain(id, company_nip)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.render(w, http.StatusOK, "view_jpk.tmpl", data)
+}
+
+func (app *application) viewAllJpk(w http.ResponseWriter, r *http.Request) {
+	company_nip := app.getNIP(r)
+	jpks, err := app.jpks.GetAll(company_nip)
+	if err != nil {
+		app.serverError(w, err)
+	}
+	slices.Reverse(jpks)
+	data := app.newTemplateData(r)
+	data.JpkListData = jpks
+	app.render(w, http.StatusOK, "jpk_files.tmpl", data)
+}
+
+func (app *application) viewLedger(w http.ResponseWriter, r *http.Request) {
+	company_nip := app.getNIP(r)
+	ledger, err := app.ledger.All(company_nip)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
+	slices.Reverse(ledger)
+	data := app.newTemplateData(r)
+	data.Ledger = ledger
+	app.render(w, http.StatusOK, "ledger.tmpl", data)
+}
+
+func (app *application) addJpk(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	date, err := time.Parse("2006-01", r.PostForm.Get("month"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	jpkParams := models.JPKParams{Okres: date, Cel: models.CelZlozenie}
+	jpkParams.ZwrotTermin = models.ZwrotTermin(r.PostForm.Get("zwrot_termin"))
+	if jpkParams.ZwrotTermin != models.ZwrotBrak {
+		jpkParams.ZwrotKwota, err = strconv.Atoi(strings.TrimSpace(r.PostForm.Get("zwrot_kwota")))
+		if err != nil || jpkParams.ZwrotKwota <= 0 || !validator.PermittedValue(jpkParams.ZwrotTermin, models.ZwrotTerminy...) {
+			app.sessionManager.Put(r.Context(), "flash", "Podaj kwotę zwrotu w pełnych złotych.")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+		if zaliczenie := strings.TrimSpace(r.PostForm.Get("zaliczenie_kwota")); zaliczenie != "" {
+			jpkParams.ZaliczenieKwota, err = strconv.Atoi(zaliczenie)
+			jpkParams.ZaliczenieRodzaj = strings.TrimSpace(r.PostForm.Get("zaliczenie_rodzaj"))
+			if err != nil || jpkParams.ZaliczenieKwota <= 0 || !validator.NotBlank(jpkParams.ZaliczenieRodzaj) || !validator.MaxChars(jpkParams.ZaliczenieRodzaj, 240) {
+				app.sessionManager.Put(r.Context(), "flash", "Podaj kwotę zwrotu zaliczaną na poczet przyszłych zobowiązań w pełnych złotych i rodzaj zobowiązania.")
+				http.Redirect(w, r, "/", http.StatusSeeOther)
+				return
+			}
+		}
+	} else if strings.TrimSpace(r.PostForm.Get("zwrot_kwota")) != "" {
+		app.sessionManager.Put(r.Context(), "flash", "Wybierz termin zwrotu.")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	company_nip := app.getNIP(r)
+	id, err := app.generateJpk(company_nip, jpkParams, nil)
+	if err != nil {
+		if errors.Is(err, models.ErrIncompleteProfile) {
+			app.sessionManager.Put(r.Context(), "flash", "Uzupełnij dane firmy przed wygenerowaniem JPK.")
+			http.Redirect(w, r, "/settings", http.StatusSeeOther)
+		} else if errors.Is(err, models.ErrRefundTooHigh) {
+			app.sessionManager.Put(r.Context(), "flash", "Kwota zwrotu nie może przekraczać nadwyżki podatku naliczonego (P_53).")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+		} else if errors.Is(err, models.ErrOffsetTooHigh) {
+			app.sessionManager.Put(r.Context(), "flash", "Kwota zaliczana na poczet przyszłych zobowiązań (P_60) nie może przekraczać kwoty zwrotu (P_54).")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+		} else if errors.Is(err, models.ErrNoDeclaration) {
+			app.sessionManager.Put(r.Context(), "flash", "Zwrot można wykazać tylko w deklaracji, składanej w pliku za ostatni miesiąc kwartału.")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+		} else if errors.Is(err, models.ErrNoSchema) {
+			app.sessionManager.Put(r.Context(), "flash", noSchemaMessage)
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Wygenerowano JPK.")
+
+	// redirect to view jpk.
+	http.Redirect(w, r, fmt.Sprintf("/jpk/view/%d", id), http.StatusSeeOther)
+
+}
+
+func (app *application) correctJpk(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.notFound(w)
+		return
+	}
 	err = r.ParseForm()
 	if err != nil {
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
-	form := confirmJpkForm{
-		UPO: r.PostForm.Get("upo"),
+	company_nip := app.getNIP(r)
+	jpk, metadata, err := app.jpks.Get(id, company_nip)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
 	}
-	form.CheckField(validator.NotBlank(form.UPO), "upo", "UPO nie może być puste.")
+	if metadata.ConfirmedAt == nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	form := correctJpkForm{
+		Uzasadnienie: strings.TrimSpace(r.PostForm.Get("uzasadnienie")),
+	}
+	form.CheckField(validator.NotBlank(form.Uzasadnienie), "uzasadnienie", "Podaj uzasadnienie korekty.")
+	// P_ORDZU takes at most 240 characters
+	form.CheckField(validator.MaxChars(form.Uzasadnienie, 240), "uzasadnienie", "Uzasadnienie korekty może mieć najwyżej 240 znaków.")
 	if !form.Valid() {
-		jpk, metadata, err := app.jpks.Get(id, company_nip)
+		data := app.newTemplateData(r)
+		data.Jpk = jpk
+		data.JpkMetadata = metadata
+		data.JpkChain, err = app.jpks.Chain(id, company_nip)
 		if err != nil {
 			app.serverError(w, err)
 			return
 		}
-		data := app.newTemplateData(r)
-		data.Jpk = jpk
-		data.JpkMetadata = metadata
 		data.Form = form
 		app.render(w, http.StatusUnprocessableEntity, "view_jpk.tmpl", data)
 		return
 	}
-	err = app.jpks.Confirm(id, form.UPO, company_nip)
 
+	okres := time.Date(metadata.Rok, time.Month(metadata.Miesiac), 1, 0, 0, 0, 0, time.UTC)
+	jpkParams := models.JPKParams{Okres: okres, Cel: models.CelKorekta, Uzasadnienie: form.Uzasadnienie}
+	// the correction keeps the refund requested in the corrected declaration
+	if jpk.Deklaracja != nil {
+		jpkParams.ZwrotKwota, jpkParams.ZwrotTermin = jpk.Deklaracja.PozycjeSzczegolowe.Zwrot()
+		jpkParams.ZaliczenieKwota, jpkParams.ZaliczenieRodzaj = jpk.Deklaracja.PozycjeSzczegolowe.Zaliczenie()
+	}
+	newId, err := app.generateJpk(company_nip, jpkParams, &id)
+	if err != nil {
+		if errors.Is(err, models.ErrIncompleteProfile) {
+			app.sessionManager.Put(r.Context(), "flash", "Uzupełnij dane firmy przed wygenerowaniem JPK.")
+			http.Redirect(w, r, "/settings", http.StatusSeeOther)
+		} else if errors.Is(err, models.ErrRefundTooHigh) {
+			app.sessionManager.Put(r.Context(), "flash", "Po korekcie nadwyżka (P_53) jest niższa niż zwrot z korygowanej deklaracji.")
+			http.Redirect(w, r, fmt.Sprintf("/jpk/view/%d", id), http.StatusSeeOther)
+		} else if errors.Is(err, models.ErrNoSchema) {
+			app.sessionManager.Put(r.Context(), "flash", noSchemaMessage)
+			http.Redirect(w, r, fmt.Sprintf("/jpk/view/%d", id), http.StatusSeeOther)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Wygenerowano korektę JPK.")
+	http.Redirect(w, r, fmt.Sprintf("/jpk/view/%d", newId), http.StatusSeeOther)
+}
+
+// generateJpk builds the file for the period from the current invoices and stores it.
+// korektaId links a correction to the file it corrects.
+func (app *application) generateJpk(company_nip string, params models.JPKParams, korektaId *int) (int, error) {
+	profile, err := app.profiles.Get(company_nip)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		return 0, err
+	}
+	if profile == nil || !profile.Complete() {
+		return 0, models.ErrIncompleteProfile
+	}
+
+	// a quarterly declaration covers the invoices of the whole quarter
+	okresy := []time.Time{params.Okres}
+	if profile.Kwartalnie && models.KwartalZamkniety(params.Okres) {
+		okresy = models.KwartalOkresy(params.Okres)
+	}
+	var invoices []*models.Invoice
+	for _, okres := range okresy {
+		inv, err := app.invoices.ForPeriod(company_nip, okres, profile.MetodaKasowa)
+		if err != nil {
+			return 0, err
+		}
+		invoices = append(invoices, inv...)
+	}
+
+	jpk, err := app.jpks.NewJpk(invoices, profile, params)
+	if err != nil {
+		return 0, err
+	}
+	Header := `<?xml version="1.0" encoding="UTF-8"?>` + "\n"
+	out, err := xml.MarshalIndent(jpk, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	out = []byte(Header + string(out))
+	// an invalid file is still stored so that the errors can be shown, but it cannot be downloaded or confirmed
+	bledy, err := models.ValidateJpk(jpk, out)
+	if err != nil {
+		return 0, err
+	}
+	return app.jpks.InsertDB(jpk, string(out), company_nip, korektaId, bledy)
+}
+
+func (app *application) deleteJpk(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.notFound(w)
+		return
+	}
+	company_nip := app.getNIP(r)
+	err = app.jpks.Delete(id, company_nip)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Usunięto wersję roboczą JPK.")
+
+	http.Redirect(w, r, "/jpk/viewall", http.StatusSeeOther)
+}
+
+func (app *application) downloadJpk(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	company_nip := app.getNIP(r)
+	fileContent, err := app.jpks.GetContent(id, company_nip)
 	if err != nil {
 		if errors.Is(err, models.ErrNoRecord) {
 			app.notFound(w)
+		} else if errors.Is(err, models.ErrInvalidJpk) {
+			app.sessionManager.Put(r.Context(), "flash", "Plik JPK zawiera błędy walidacji i nie może zostać pobrany.")
+			http.Redirect(w, r, fmt.Sprintf("/jpk/view/%d", id), http.StatusSeeOther)
 		} else {
 			app.serverError(w, err)
 		}
 		return
 	}
-	app.sessionManager.Put(r.Context(), "flash", "Zatwierdzono JPK.")
-	http.Redirect(w, r, fmt.Sprintf("/jpk/view/%d", id), http.StatusSeeOther)
+	filename, err := models.FileName(fileContent, id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	w.Header().Set("Content-Type", "application/xml")
+	w.Header().Set("Content-Length", strconv.Itoa(len(fileContent)))
+
+	http.ServeContent(w, r, "jpk.xml", time.Now(), bytes.NewReader(fileContent))
+}
+
+func (app *application) confirmJpk(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	company_nip := app.getNIP(r)
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	err = r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	form := confirmJpkForm{
+		UPO: r.PostForm.Get("upo"),
+	}
+	form.CheckField(validator.NotBlank(form.UPO), "upo", "UPO nie może być puste.")
+	if !form.Valid() {
+		jpk, metadata, err := app.jpks.Get(id, company_nip)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		if metadata.ConfirmedAt != nil {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+		data := app.newTemplateData(r)
+		data.Jpk = jpk
+		data.JpkMetadata = metadata
+		data.JpkChain, err = app.jpks.Chain(id, company_nip)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "view_jpk.tmpl", data)
+		return
+	}
+	err = app.jpks.Confirm(id, form.UPO, company_nip)
+
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else if errors.Is(err, models.ErrInvalidJpk) {
+			app.sessionManager.Put(r.Context(), "flash", "Plik JPK zawiera błędy walidacji i nie może zostać zatwierdzony.")
+			http.Redirect(w, r, fmt.Sprintf("/jpk/view/%d", id), http.StatusSeeOther)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash", "Zatwierdzono JPK.")
+	http.Redirect(w, r, fmt.Sprintf("/jpk/view/%d", id), http.StatusSeeOther)
+}
+
+func (app *application) contractorsList(w http.ResponseWriter, r *http.Request) {
+	szukaj := strings.TrimSpace(r.URL.Query().Get("q"))
+	contractors, err := app.contractors.All(app.getNIP(r), szukaj)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	data := app.newTemplateData(r)
+	data.Contractors = contractors
+	data.Szukaj = szukaj
+	app.render(w, http.StatusOK, "contractors.tmpl", data)
+}
+
+func (app *application) createContractor(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = contractorForm{KodKraju: "PL"}
+	app.render(w, http.StatusOK, "contractor.tmpl", data)
+}
+
+func (app *application) createContractorPost(w http.ResponseWriter, r *http.Request) {
+	form, err := parseContractorForm(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	form.CheckField(validator.NotBlank(form.Nip), "nip", "NIP nie może być pusty.")
+	checkVatNumber(&form.Validator, "nip", form.KodKraju, form.Nip)
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "contractor.tmpl", data)
+		return
+	}
+	c := &models.Contractor{Nip: form.Nip, Nazwa: form.Nazwa, KodKraju: form.KodKraju}
+	_, err = app.contractors.Insert(c, app.getNIP(r))
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateNip) {
+			form.AddFieldError("nip", "Kontrahent z tym NIP-em jest już w rejestrze.")
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, http.StatusUnprocessableEntity, "contractor.tmpl", data)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash", "Dodano kontrahenta.")
+	http.Redirect(w, r, "/contractors", http.StatusSeeOther)
+}
+
+func (app *application) editContractor(w http.ResponseWriter, r *http.Request) {
+	c, ok := app.contractorFromParams(w, r)
+	if !ok {
+		return
+	}
+	data, err := app.contractorData(r, c)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	data.Form = contractorForm{Nip: c.Nip, Nazwa: c.Nazwa, KodKraju: c.KodKraju}
+	app.render(w, http.StatusOK, "contractor.tmpl", data)
+}
+
+func (app *application) editContractorPost(w http.ResponseWriter, r *http.Request) {
+	c, ok := app.contractorFromParams(w, r)
+	if !ok {
+		return
+	}
+	form, err := parseContractorForm(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	// the NIP cannot be edited, a wrong one is fixed by merging
+	form.Nip = c.Nip
+	checkVatNumber(&form.Validator, "kod_kraju", form.KodKraju, form.Nip)
+	if !form.Valid() {
+		data, err := app.contractorData(r, c)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "contractor.tmpl", data)
+		return
+	}
+	c.Nazwa, c.KodKraju = form.Nazwa, form.KodKraju
+	err = app.contractors.Update(c, app.getNIP(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash", "Zapisano dane kontrahenta.")
+	http.Redirect(w, r, "/contractors", http.StatusSeeOther)
+}
+
+// mergeContractorPost moves the invoices of the contractor to the chosen entry and removes the contractor.
+func (app *application) mergeContractorPost(w http.ResponseWriter, r *http.Request) {
+	c, ok := app.contractorFromParams(w, r)
+	if !ok {
+		return
+	}
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	docelowyId, err := strconv.Atoi(r.PostForm.Get("docelowy"))
+	if err != nil || docelowyId == c.Id {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	userId := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	err = app.contractors.Merge(c.Id, docelowyId, app.getNIP(r), userId)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else if errors.Is(err, models.ErrPeriodLocked) {
+			app.sessionManager.Put(r.Context(), "flash", "Nie można połączyć kontrahentów: część faktur należy do zamkniętego okresu.")
+			http.Redirect(w, r, fmt.Sprintf("/contractors/edit/%d", c.Id), http.StatusSeeOther)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Połączono kontrahenta %s, przeniesiono faktur: %d.", c.Nip, c.Faktury))
+	http.Redirect(w, r, "/contractors", http.StatusSeeOther)
+}
+
+// contractorFromParams loads the contractor named in the URL. When it returns false the response is
+// already written.
+func (app *application) contractorFromParams(w http.ResponseWriter, r *http.Request) (*models.Contractor, bool) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return nil, false
+	}
+	c, err := app.contractors.Get(id, app.getNIP(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return nil, false
+	}
+	return c, true
+}
+
+// contractorData prepares the edit page of the contractor with the other entries it can be merged into.
+func (app *application) contractorData(r *http.Request, c *models.Contractor) (*templateData, error) {
+	all, err := app.contractors.All(app.getNIP(r), "")
+	if err != nil {
+		return nil, err
+	}
+	data := app.newTemplateData(r)
+	data.Contractor = c
+	for _, other := range all {
+		if other.Id != c.Id {
+			data.Contractors = append(data.Contractors, other)
+		}
+	}
+	return data, nil
+}
+
+func parseContractorForm(r *http.Request) (contractorForm, error) {
+	err := r.ParseForm()
+	if err != nil {
+		return contractorForm{}, err
+	}
+	form := contractorForm{
+		Nip:      strings.ToUpper(strings.ReplaceAll(strings.ReplaceAll(r.PostForm.Get("nip"), "-", ""), " ", "")),
+		Nazwa:    strings.TrimSpace(r.PostForm.Get("nazwa")),
+		KodKraju: strings.ToUpper(strings.TrimSpace(r.PostForm.Get("kod_kraju"))),
+	}
+	// a number entered with its prefix decides the country
+	if kodKraju, nip := validator.SplitVatNumber(form.Nip); form.Nip != "" && nip != form.Nip {
+		form.KodKraju, form.Nip = kodKraju, nip
+	}
+	form.CheckField(validator.NotBlank(form.Nazwa), "nazwa", "Nazwa firmy nie może być pusta.")
+	form.CheckField(validator.Matches(form.KodKraju, validator.KodKrajuRegex), "kod_kraju", "Kod kraju musi składać się z 2 liter.")
+	return form, nil
+}
+
+func (app *application) exchangeRates(w http.ResponseWriter, r *http.Request) {
+	data, err := app.exchangeRatesData(r)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	data.Form = importRatesForm{}
+	app.render(w, http.StatusOK, "rates.tmpl", data)
+}
+
+// importRatesPost loads an NBP table A file, XML or the yearly CSV archive, into the exchange rate table.
+func (app *application) importRatesPost(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 10<<20)
+	err := r.ParseMultipartForm(10 << 20)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	form := importRatesForm{}
+	file, header, err := r.FormFile("plik")
+	if err != nil {
+		form.AddFieldError("plik", "Wybierz plik z tabelą kursów NBP.")
+	} else {
+		defer file.Close()
+		var rates []models.ExchangeRate
+		if strings.HasSuffix(strings.ToLower(header.Filename), ".csv") {
+			rates, err = models.ParseNbpCSV(file)
+		} else {
+			rates, err = models.ParseNbpXML(file)
+		}
+		if err != nil {
+			if !errors.Is(err, models.ErrInvalidRates) {
+				app.serverError(w, err)
+				return
+			}
+			form.AddFieldError("plik", "Nie rozpoznano pliku. Wgraj tabelę A NBP w formacie XML albo archiwum CSV.")
+		} else {
+			form.Zaimportowano, err = app.rates.Import(rates)
+			if err != nil {
+				app.serverError(w, err)
+				return
+			}
+		}
+	}
+	if !form.Valid() {
+		data, err := app.exchangeRatesData(r)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "rates.tmpl", data)
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Zaimportowano kursów: %d.", form.Zaimportowano))
+	http.Redirect(w, r, "/rates", http.StatusSeeOther)
+}
+
+func (app *application) exchangeRatesData(r *http.Request) (*templateData, error) {
+	rates, err := app.rates.Latest()
+	if err != nil {
+		return nil, err
+	}
+	data := app.newTemplateData(r)
+	data.ExchangeRates = rates
+	return data, nil
+}
+
+func (app *application) bankStatements(w http.ResponseWriter, r *http.Request) {
+	data, err := app.bankStatementsData(r)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	data.Form = importStatementForm{}
+	app.render(w, http.StatusOK, "statements.tmpl", data)
+}
+
+func (app *application) bankStatementsData(r *http.Request) (*templateData, error) {
+	company_nip := app.getNIP(r)
+	data := app.newTemplateData(r)
+	var err error
+	data.BankTransactions, err = app.statements.Pending(company_nip)
+	if err != nil {
+		return nil, err
+	}
+	data.OpenInvoices, err = app.invoices.Open(company_nip)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (app *application) importStatementPost(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 10<<20)
+	err := r.ParseMultipartForm(10 << 20)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	form := importStatementForm{}
+	file, _, err := r.FormFile("plik")
+	if err != nil {
+		form.AddFieldError("plik", "Wybierz plik z wyciągiem bankowym.")
+	} else {
+		defer file.Close()
+		txs, err := models.ParseStatement(file)
+		if err != nil {
+			if !errors.Is(err, models.ErrInvalidStatement) {
+				app.serverError(w, err)
+				return
+			}
+			form.AddFieldError("plik", "Nie rozpoznano pliku. Wgraj wyciąg w formacie MT940 albo CAMT.053.")
+		} else {
+			form.Zaimportowano, form.Dopasowano, err = app.statements.Import(txs, app.getNIP(r))
+			if err != nil {
+				app.serverError(w, err)
+				return
+			}
+		}
+	}
+	if !form.Valid() {
+		data, err := app.bankStatementsData(r)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "statements.tmpl", data)
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Zaimportowano transakcji: %d, dopasowano do faktur: %d.", form.Zaimportowano, form.Dopasowano))
+	http.Redirect(w, r, "/statements", http.StatusSeeOther)
+}
+
+func (app *application) confirmTransactionPost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+	err = r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	invoiceId, err := strconv.Atoi(r.PostForm.Get("invoice_id"))
+	if err != nil {
+		app.sessionManager.Put(r.Context(), "flash", "Wybierz fakturę, którą opłaca transakcja.")
+		http.Redirect(w, r, "/statements", http.StatusSeeOther)
+		return
+	}
+	err = app.statements.Confirm(id, invoiceId, app.getNIP(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else if errors.Is(err, models.ErrPaymentMismatch) {
+			app.sessionManager.Put(r.Context(), "flash", paymentMismatchMessage)
+			http.Redirect(w, r, "/statements", http.StatusSeeOther)
+		} else if errors.Is(err, models.ErrPeriodLocked) {
+			app.sessionManager.Put(r.Context(), "flash", "Okres płatności jest zamknięty. Dodanie płatności wymaga odblokowania okresu i korekty JPK.")
+			http.Redirect(w, r, "/statements", http.StatusSeeOther)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash", "Zapisano płatność faktury.")
+	http.Redirect(w, r, "/statements", http.StatusSeeOther)
+}
+
+const paymentMismatchMessage = "Transakcja nie pasuje do faktury: faktura jest w innej walucie, jest zapłacona albo kwota przekracza pozostałą do zapłaty."
+
+// confirmAllTransactionsPost confirms every transaction matched on import. Transactions that no longer fit
+// their invoice or fall into a locked period are left for review.
+func (app *application) confirmAllTransactionsPost(w http.ResponseWriter, r *http.Request) {
+	company_nip := app.getNIP(r)
+	txs, err := app.statements.Pending(company_nip)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	zatwierdzono, pominieto := 0, 0
+	for _, t := range txs {
+		if t.InvoiceId == 0 {
+			continue
+		}
+		err = app.statements.Confirm(t.Id, t.InvoiceId, company_nip)
+		if errors.Is(err, models.ErrPaymentMismatch) || errors.Is(err, models.ErrPeriodLocked) {
+			pominieto++
+			continue
+		}
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		zatwierdzono++
+	}
+	msg := fmt.Sprintf("Zapisano płatności: %d.", zatwierdzono)
+	if pominieto > 0 {
+		msg += fmt.Sprintf(" Do sprawdzenia pozostało dopasowań: %d.", pominieto)
+	}
+	app.sessionManager.Put(r.Context(), "flash", msg)
+	http.Redirect(w, r, "/statements", http.StatusSeeOther)
+}
+
+func (app *application) ignoreTransactionPost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+	err = app.statements.Ignore(id, app.getNIP(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash", "Pominięto transakcję.")
+	http.Redirect(w, r, "/statements", http.StatusSeeOther)
+}
+
+// splitPayments lists the purchase invoices to pay by split payment, to be exported as an Elixir file.
+func (app *application) splitPayments(w http.ResponseWriter, r *http.Request) {
+	company_nip := app.getNIP(r)
+	data := app.newTemplateData(r)
+	var err error
+	data.SplitPayments, err = app.invoices.SplitPayments(company_nip)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	profile, err := app.profiles.Get(company_nip)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, err)
+		return
+	}
+	data.CompanyProfile = profile
+	app.render(w, http.StatusOK, "split_payments.tmpl", data)
+}
+
+// splitPaymentsElixirPost sends the Elixir file with the split payment transfers of the chosen invoices.
+func (app *application) splitPaymentsElixirPost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	dzien, err := time.Parse("2006-01-02", r.PostForm.Get("data"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	company_nip := app.getNIP(r)
+	profile, err := app.profiles.Get(company_nip)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, err)
+		return
+	}
+	if profile == nil || profile.NrRachunku == "" {
+		app.sessionManager.Put(r.Context(), "flash", "Podaj w ustawieniach rachunek bankowy firmy, z którego są opłacane faktury.")
+		http.Redirect(w, r, "/mpp", http.StatusSeeOther)
+		return
+	}
+	wszystkie, err := app.invoices.SplitPayments(company_nip)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	var platnosci []*models.SplitPayment
+	for _, p := range wszystkie {
+		if slices.Contains(r.PostForm["invoice_id"], strconv.Itoa(p.InvoiceId)) {
+			platnosci = append(platnosci, p)
+		}
+	}
+	if len(platnosci) == 0 {
+		app.sessionManager.Put(r.Context(), "flash", "Wybierz faktury do zapłaty.")
+		http.Redirect(w, r, "/mpp", http.StatusSeeOther)
+		return
+	}
+	zleceniodawca := profile.PelnaNazwa
+	if profile.OsobaFizyczna {
+		zleceniodawca = profile.Imie + " " + profile.Nazwisko
+	}
+	buf := new(bytes.Buffer)
+	err = models.WriteElixir(buf, zleceniodawca, profile.NrRachunku, dzien, platnosci)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidAccount) {
+			app.sessionManager.Put(r.Context(), "flash", "Przelew w mechanizmie podzielonej płatności wymaga polskiego rachunku firmy.")
+			http.Redirect(w, r, "/mpp", http.StatusSeeOther)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"mpp_%s.pli\"", dzien.Format("2006-01-02")))
+	w.Header().Set("Content-Type", "text/plain; charset=windows-1250")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	buf.WriteTo(w)
+}
+
+// receivables shows the unpaid sale and purchase invoices by contractor and days overdue, as of today or
+// the day given in the query.
+func (app *application) receivables(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	var err error
+	if dzien := r.URL.Query().Get("dzien"); dzien != "" {
+		data.Today, err = time.Parse("2006-01-02", dzien)
+		if err != nil {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+	data.Receivables, data.Payables, err = app.invoices.Ageing(app.getNIP(r), data.Today)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.render(w, http.StatusOK, "receivables.tmpl", data)
+}
+
+func (app *application) badDebtsList(w http.ResponseWriter, r *http.Request) {
+	company_nip := app.getNIP(r)
+	data := app.newTemplateData(r)
+	var err error
+	data.BadDebts, err = app.badDebts.Candidates(company_nip, data.CurrentDate)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	data.BadDebtReliefs, err = app.badDebts.Applied(company_nip)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.render(w, http.StatusOK, "bad_debts.tmpl", data)
+}
+
+func (app *application) applyBadDebtPost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	invoiceId, err := strconv.Atoi(r.PostForm.Get("invoice_id"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	okres, err := time.Parse("2006-01", r.PostForm.Get("okres"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	if okres.After(time.Now()) {
+		app.sessionManager.Put(r.Context(), "flash", "Ulgę można zastosować najpóźniej w bieżącym okresie.")
+		http.Redirect(w, r, "/baddebts", http.StatusSeeOther)
+		return
+	}
+	err = app.badDebts.Apply(invoiceId, app.getNIP(r), okres)
+	if err != nil {
+		if errors.Is(err, models.ErrNotBadDebt) {
+			app.sessionManager.Put(r.Context(), "flash", "Ulga na złe długi nie przysługuje dla tej faktury w wybranym okresie.")
+		} else if errors.Is(err, models.ErrBadDebtApplied) {
+			app.sessionManager.Put(r.Context(), "flash", "Ulga na złe długi została już zastosowana dla tej faktury.")
+		} else if errors.Is(err, models.ErrPeriodLocked) {
+			app.sessionManager.Put(r.Context(), "flash", "Wybrany okres jest zamknięty. Zastosowanie ulgi wymaga odblokowania okresu i korekty JPK.")
+		} else {
+			app.serverError(w, err)
+			return
+		}
+		http.Redirect(w, r, "/baddebts", http.StatusSeeOther)
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Zastosowano ulgę na złe długi w okresie %s.", okres.Format("01/2006")))
+	http.Redirect(w, r, "/baddebts", http.StatusSeeOther)
+}
+
+func (app *application) deleteBadDebtPost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+	err = app.badDebts.Delete(id, app.getNIP(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else if errors.Is(err, models.ErrPeriodLocked) {
+			app.sessionManager.Put(r.Context(), "flash", "Ulga lub zapłata po jej zastosowaniu przypada na zamknięty okres. Wycofanie ulgi wymaga odblokowania okresów i korekty JPK.")
+			http.Redirect(w, r, "/baddebts", http.StatusSeeOther)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash", "Wycofano ulgę na złe długi.")
+	http.Redirect(w, r, "/baddebts", http.StatusSeeOther)
+}
+
+func (app *application) periods(w http.ResponseWriter, r *http.Request) {
+	data, err := app.periodsData(r)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	data.Form = unlockPeriodForm{}
+	app.render(w, http.StatusOK, "periods.tmpl", data)
+}
+
+func (app *application) unlockPeriodPost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	userId := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	owner, err := app.users.IsOwner(userId)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if !owner {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+	okres, err := time.Parse("2006-01", r.PostForm.Get("okres"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	form := unlockPeriodForm{
+		Rok:     okres.Year(),
+		Miesiac: int(okres.Month()),
+		Powod:   strings.TrimSpace(r.PostForm.Get("powod")),
+	}
+	form.CheckField(validator.NotBlank(form.Powod), "powod", "Podaj powód odblokowania okresu.")
+	if !form.Valid() {
+		data, err := app.periodsData(r)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "periods.tmpl", data)
+		return
+	}
+	company_nip := app.getNIP(r)
+	err = app.locks.Unlock(company_nip, form.Rok, form.Miesiac, userId, form.Powod)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Odblokowano okres %02d/%d. Po zmianach złóż korektę JPK.", form.Miesiac, form.Rok))
+	http.Redirect(w, r, "/periods", http.StatusSeeOther)
+}
+
+func (app *application) periodsData(r *http.Request) (*templateData, error) {
+	company_nip := app.getNIP(r)
+	data := app.newTemplateData(r)
+	var err error
+	data.PeriodLocks, err = app.locks.All(company_nip)
+	if err != nil {
+		return nil, err
+	}
+	data.PeriodUnlocks, err = app.locks.Unlocks(company_nip)
+	if err != nil {
+		return nil, err
+	}
+	data.IsOwner, err = app.users.IsOwner(app.sessionManager.GetInt(r.Context(), "authenticatedUserID"))
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (app *application) companyUsers(w http.ResponseWriter, r *http.Request) {
+	data, err := app.companyUsersData(r)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	data.Form = companyUserForm{}
+	app.render(w, http.StatusOK, "users.tmpl", data)
+}
+
+func (app *application) addCompanyUserPost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	owner, err := app.users.IsOwner(app.sessionManager.GetInt(r.Context(), "authenticatedUserID"))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if !owner {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+	form := companyUserForm{
+		Name:     r.PostForm.Get("name"),
+		Email:    r.PostForm.Get("email"),
+		Password: r.PostForm.Get("password"),
+	}
+	form.CheckField(validator.NotBlank(form.Name), "name", "Nazwa nie może być pusta")
+	form.CheckField(validator.NotBlank(form.Email), "email", "Email nie może być pusty")
+	form.CheckField(validator.NotBlank(form.Password), "password", "Hasło nie może być puste")
+	form.CheckField(validator.Matches(form.Email, validator.EmailRegex), "email", "Email musi być poprawny")
+	form.CheckField(validator.MinChars(form.Password, 8), "password", "Hasło musi mieć min. 8 znaków")
+	if form.Valid() {
+		err = app.users.InsertMember(form.Name, form.Email, form.Password, app.getNIP(r))
+		if errors.Is(err, models.ErrDuplicateEmail) {
+			form.AddFieldError("email", "Email address is already in use")
+		} else if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+	if !form.Valid() {
+		data, err := app.companyUsersData(r)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "users.tmpl", data)
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Dodano użytkownika %s.", form.Email))
+	http.Redirect(w, r, "/users", http.StatusSeeOther)
+}
+
+func (app *application) companyUsersData(r *http.Request) (*templateData, error) {
+	data := app.newTemplateData(r)
+	var err error
+	data.Users, err = app.users.Company(app.getNIP(r))
+	if err != nil {
+		return nil, err
+	}
+	data.IsOwner, err = app.users.IsOwner(app.sessionManager.GetInt(r.Context(), "authenticatedUserID"))
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (app *application) settings(w http.ResponseWriter, r *http.Request) {
+	company_nip := app.getNIP(r)
+	profile, err := app.profiles.Get(company_nip)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, err)
+		return
+	}
+	form := companyProfileForm{Proporcja: "100"}
+	if profile != nil {
+		form = companyProfileForm{
+			PelnaNazwa:    profile.PelnaNazwa,
+			Email:         profile.Email,
+			Telefon:       profile.Telefon,
+			KodUrzedu:     profile.KodUrzedu,
+			OsobaFizyczna: profile.OsobaFizyczna,
+			Imie:          profile.Imie,
+			Nazwisko:      profile.Nazwisko,
+			Kwartalnie:    profile.Kwartalnie,
+			Proporcja:     strconv.Itoa(profile.Proporcja),
+			MetodaKasowa:  profile.MetodaKasowa,
+			NrRachunku:    profile.NrRachunku,
+		}
+		if !profile.DataUrodzenia.IsZero() {
+			form.DataUrodzenia = profile.DataUrodzenia.Format("2006-01-02")
+		}
+	}
+	data := app.newTemplateData(r)
+	data.Form = form
+	app.render(w, http.StatusOK, "settings.tmpl", data)
+}
+
+func (app *application) settingsPost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	form := companyProfileForm{
+		PelnaNazwa:    strings.TrimSpace(r.PostForm.Get("pelna_nazwa")),
+		Email:         strings.TrimSpace(r.PostForm.Get("email")),
+		Telefon:       strings.TrimSpace(r.PostForm.Get("telefon")),
+		KodUrzedu:     strings.TrimSpace(r.PostForm.Get("kod_urzedu")),
+		OsobaFizyczna: r.PostForm.Get("osoba_fizyczna") == "1",
+		Imie:          strings.TrimSpace(r.PostForm.Get("imie")),
+		Nazwisko:      strings.TrimSpace(r.PostForm.Get("nazwisko")),
+		DataUrodzenia: r.PostForm.Get("data_urodzenia"),
+		Kwartalnie:    r.PostForm.Get("kwartalnie") == "1",
+		Proporcja:     strings.TrimSpace(r.PostForm.Get("proporcja")),
+		MetodaKasowa:  r.PostForm.Get("metoda_kasowa") == "1",
+		NrRachunku:    validator.CompactAccount(r.PostForm.Get("nr_rachunku")),
+	}
+
+	form.CheckField(validator.NotBlank(form.Email), "email", "Email nie może być pusty.")
+	form.CheckField(validator.Matches(form.Email, validator.EmailRegex), "email", "Email musi być poprawny.")
+	form.CheckField(validator.Matches(form.KodUrzedu, validator.KodUrzeduRegex), "kod_urzedu", "Kod urzędu skarbowego musi mieć 4 cyfry.")
+	proporcja, err := strconv.Atoi(form.Proporcja)
+	form.CheckField(err == nil && proporcja >= 0 && proporcja <= 100, "proporcja", "Proporcja musi być liczbą całkowitą od 0 do 100.")
+	form.CheckField(form.NrRachunku == "" || validator.AccountNumber(form.NrRachunku), "nr_rachunku", "Nieprawidłowy numer rachunku bankowego.")
+	var dataUrodzenia time.Time
+	if form.OsobaFizyczna {
+		form.CheckField(validator.NotBlank(form.Imie), "imie", "Imię nie może być puste.")
+		form.CheckField(validator.NotBlank(form.Nazwisko), "nazwisko", "Nazwisko nie może być puste.")
+		dataUrodzenia, err = time.Parse("2006-01-02", form.DataUrodzenia)
+		form.CheckField(err == nil, "data_urodzenia", "Podaj poprawną datę urodzenia.")
+	} else {
+		form.CheckField(validator.NotBlank(form.PelnaNazwa), "pelna_nazwa", "Pełna nazwa nie może być pusta.")
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "settings.tmpl", data)
+		return
+	}
+
+	profile := &models.CompanyProfile{
+		Nip:           app.getNIP(r),
+		PelnaNazwa:    form.PelnaNazwa,
+		Email:         form.Email,
+		Telefon:       form.Telefon,
+		KodUrzedu:     form.KodUrzedu,
+		OsobaFizyczna: form.OsobaFizyczna,
+		Imie:          form.Imie,
+		Nazwisko:      form.Nazwisko,
+		DataUrodzenia: dataUrodzenia,
+		Kwartalnie:    form.Kwartalnie,
+		Proporcja:     proporcja,
+		MetodaKasowa:  form.MetodaKasowa,
+		NrRachunku:    form.NrRachunku,
+	}
+	err = app.profiles.Save(profile)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Zapisano dane firmy.")
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
 }
 
 func (app *application) userSignUp(w http.ResponseWriter, r *http.Request) {
@@ -383,7 +1982,9 @@ func (app *application) userSignUpPost(w http.ResponseWriter, r *http.Request) {
 	form.CheckField(validator.NotBlank(form.Company), "company", "Nazwa firmy nie może być pusta")
 	form.CheckField(validator.Matches(form.Email, validator.EmailRegex), "email", "Email musi być poprawny")
 	form.CheckField(validator.MinChars(form.Password, 8), "password", "Hasło musi mieć min. 8 znaków")
-	form.CheckField(validator.LengthNIP(form.Nip), "nip", "NIP musi być poprawny")
+	form.CheckField(validator.LengthNIP(form.Nip), "nip", "NIP musi mieć 10 cyfr")
+	form.CheckField(validator.NumberNIP(form.Nip), "nip", "NIP musi składać się wyłącznie z cyfr")
+	form.CheckField(validator.ChecksumNIP(form.Nip), "nip", "NIP ma nieprawidłową cyfrę kontrolną")
 
 	if !form.Valid() {
 		data := app.newTemplateData(r)
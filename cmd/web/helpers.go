@@ -3,10 +3,16 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"math"
 	"net/http"
+	"net/url"
 	"runtime/debug"
+	"strconv"
+	"strings"
 	"time"
 
+	"app.greyhouse.es/internal/models"
+	"app.greyhouse.es/internal/validator"
 	"github.com/justinas/nosurf"
 )
 
@@ -49,6 +55,7 @@ func (app *application) render(w http.ResponseWriter, status int, page string, d
 func (app *application) newTemplateData(r *http.Request) *templateData {
 	return &templateData{
 		CurrentDate: time.Now(),  
+		Today:       time.Now(),
 		Flash:           app.sessionManager.PopString(r.Context(), "flash"),
 		IsAuthenticated: app.isAuthenticated(r),
 		CSRFToken:       nosurf.Token(r),
@@ -63,6 +70,120 @@ func (app *application) isAuthenticated(r *http.Request) bool {
 	return isAuthenticated
 }
 
+// parseQuantity reads an optional quantity field, an empty input counts as zero. ParseFloat also takes
+// "inf" and "nan", which are not quantities.
+func parseQuantity(value string) (float64, error) {
+	value = strings.ReplaceAll(strings.TrimSpace(value), ",", ".")
+	if value == "" {
+		return 0, nil
+	}
+	q, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsInf(q, 0) || math.IsNaN(q) {
+		return 0, models.ErrInvalidAmount
+	}
+	return q, nil
+}
+
+// parseInvoiceLines reads the repeated line fields of the invoice form. Rows left completely empty are skipped.
+func parseInvoiceLines(form url.Values) ([]models.InvoiceLine, error) {
+	opisy := form["opis"]
+	var pozycje []models.InvoiceLine
+	for i := range opisy {
+		ilosc, cena := field(form, "ilosc", i), field(form, "cena", i)
+		if strings.TrimSpace(opisy[i]) == "" && ilosc == "" && cena == "" {
+			continue
+		}
+		l := models.InvoiceLine{
+			Opis:      strings.TrimSpace(opisy[i]),
+			Jednostka: strings.TrimSpace(field(form, "jednostka", i)),
+			Stawka:    models.VatRate(field(form, "stawka", i)),
+		}
+		var err error
+		l.Ilosc, err = parseQuantity(ilosc)
+		if err != nil {
+			return nil, err
+		}
+		l.CenaNetto, err = models.ParseMoney(cena)
+		if err != nil {
+			return nil, err
+		}
+		// a line out of range is left without values, the form validation reports it
+		_ = l.Compute()
+		pozycje = append(pozycje, l)
+	}
+	return pozycje, nil
+}
+
+func field(form url.Values, key string, i int) string {
+	if i < len(form[key]) {
+		return form[key][i]
+	}
+	return ""
+}
+
+// parseMarkers reads the checked markings of the invoice type. Sale and purchase markings are separate
+// checkbox groups on the form, since MPP appears in both.
+func parseMarkers(form url.Values, inv_type models.InvoiceType) []models.Marker {
+	key := "oznaczenia_sale"
+	if inv_type == models.PurchaseInvoice {
+		key = "oznaczenia_purc"
+	}
+	var oznaczenia []models.Marker
+	for _, v := range form[key] {
+		oznaczenia = append(oznaczenia, models.Marker(v))
+	}
+	return oznaczenia
+}
+
+// parseOptionalTime parses an optional date field, a blank value is the zero time.
+func parseOptionalTime(layout, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(layout, value)
+}
+
+// filterByDocument keeps the invoices of the given document type, all of them when it is empty.
+func filterByDocument(invoices []*models.Invoice, dokument models.DocumentType) []*models.Invoice {
+	if dokument == "" {
+		return invoices
+	}
+	filtered := []*models.Invoice{}
+	for _, inv := range invoices {
+		if inv.Dokument == dokument {
+			filtered = append(filtered, inv)
+		}
+	}
+	return filtered
+}
+
+// checkVatNumber validates a contractor's tax number: a Polish one as NIP, a foreign one against the
+// format of its country.
+func checkVatNumber(v *validator.Validator, key, kodKraju, numer string) {
+	if kodKraju == "PL" {
+		v.CheckField(validator.LengthNIP(numer), key, "NIP musi mieć 10 cyfr.")
+		v.CheckField(validator.NumberNIP(numer), key, "NIP musi składać się wyłącznie z cyfr.")
+		v.CheckField(validator.ChecksumNIP(numer), key, "NIP ma nieprawidłową cyfrę kontrolną.")
+		return
+	}
+	v.CheckField(validator.VatNumber(kodKraju, numer), key, fmt.Sprintf("Numer VAT nie pasuje do formatu numerów z kraju %s.", kodKraju))
+}
+
+func noRateMessage(waluta string, data time.Time) string {
+	return fmt.Sprintf("Brak kursu %s z tabeli NBP sprzed %s. Zaimportuj tabelę kursów.", waluta, data.Format("2006-01-02"))
+}
+
+const noSchemaMessage = "Ta wersja aplikacji nie zawiera schematu XSD formularza, więc nie można sprawdzić pliku JPK. Zgłoś to administratorowi."
+
+const notCorrectableMessage = "Korektę wystawia się do faktury pierwotnej. Raportów kasowych i dokumentów wewnętrznych nie koryguje się fakturą."
+
+func periodLockedMessage(data time.Time) string {
+	return fmt.Sprintf("Okres %02d/%d jest zamknięty po zatwierdzeniu JPK. Zmiany wymagają odblokowania okresu i złożenia korekty JPK.", int(data.Month()), data.Year())
+}
+
 func (app *application) getNIP(r *http.Request) string {
 	nip, ok := r.Context().Value(nipContextKey).(string)
 	if !ok {
@@ -27,6 +27,14 @@ type application struct {
 	templateCache  map[string]*template.Template
 	jpks           *models.JPKModel
 	users          *models.UserModel
+	profiles       *models.CompanyProfileModel
+	ledger         *models.CarryForwardModel
+	locks          *models.PeriodLockModel
+	contractors    *models.ContractorModel
+	rates          *models.ExchangeRateModel
+	payments       *models.PaymentModel
+	badDebts       *models.BadDebtModel
+	statements     *models.StatementModel
 	sessionManager *scs.SessionManager
 }
 
@@ -67,6 +75,14 @@ func main() {
 		templateCache:  templateCache,
 		jpks:           &models.JPKModel{DB: db},
 		users:          &models.UserModel{DB: db},
+		profiles:       &models.CompanyProfileModel{DB: db},
+		ledger:         &models.CarryForwardModel{DB: db},
+		locks:          &models.PeriodLockModel{DB: db},
+		contractors:    &models.ContractorModel{DB: db},
+		rates:          &models.ExchangeRateModel{DB: db},
+		payments:       &models.PaymentModel{DB: db},
+		badDebts:       &models.BadDebtModel{DB: db},
+		statements:     &models.StatementModel{DB: db},
 		sessionManager: sessionManager,
 	}
 
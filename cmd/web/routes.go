@@ -28,13 +28,46 @@ func (app *application) routes() http.Handler {
 	router.Handler(http.MethodGet, "/addinvoice", protected.ThenFunc(app.addInvoice))
 	router.Handler(http.MethodPost, "/addinvoice", protected.ThenFunc(app.addInvoicePost))
 	router.Handler(http.MethodGet, "/viewinvoice/:id", protected.ThenFunc(app.viewInvoice))
+	router.Handler(http.MethodGet, "/editinvoice/:id", protected.ThenFunc(app.editInvoice))
+	router.Handler(http.MethodPost, "/editinvoice/:id", protected.ThenFunc(app.editInvoicePost))
+	router.Handler(http.MethodGet, "/correctinvoice/:id", protected.ThenFunc(app.correctInvoice))
+	router.Handler(http.MethodPost, "/correctinvoice/:id", protected.ThenFunc(app.correctInvoicePost))
 	router.Handler(http.MethodPost, "/jpk/create", protected.ThenFunc(app.addJpk))
 	router.Handler(http.MethodGet, "/jpk/view/:id", protected.ThenFunc(app.viewJpk))
 	router.Handler(http.MethodPost, "/jpk/delete/:id", protected.ThenFunc(app.deleteJpk))
 	router.Handler(http.MethodGet, "/jpk/viewall", protected.ThenFunc(app.viewAllJpk))
 	router.Handler(http.MethodPost, "/deleteinvoice/:id", protected.ThenFunc(app.deleteInvoice))
+	router.Handler(http.MethodPost, "/addpayment/:id", protected.ThenFunc(app.addPaymentPost))
+	router.Handler(http.MethodPost, "/deletepayment/:id", protected.ThenFunc(app.deletePaymentPost))
 	router.Handler(http.MethodGet, "/jpk/download/:id", protected.ThenFunc(app.downloadJpk))
 	router.Handler(http.MethodPost, "/jpk/confirm/:id", protected.ThenFunc(app.confirmJpk))
+	router.Handler(http.MethodPost, "/jpk/correct/:id", protected.ThenFunc(app.correctJpk))
+	router.Handler(http.MethodGet, "/jpk/ledger", protected.ThenFunc(app.viewLedger))
+	router.Handler(http.MethodGet, "/contractors", protected.ThenFunc(app.contractorsList))
+	router.Handler(http.MethodGet, "/contractors/create", protected.ThenFunc(app.createContractor))
+	router.Handler(http.MethodPost, "/contractors/create", protected.ThenFunc(app.createContractorPost))
+	router.Handler(http.MethodGet, "/contractors/edit/:id", protected.ThenFunc(app.editContractor))
+	router.Handler(http.MethodPost, "/contractors/edit/:id", protected.ThenFunc(app.editContractorPost))
+	router.Handler(http.MethodPost, "/contractors/merge/:id", protected.ThenFunc(app.mergeContractorPost))
+	router.Handler(http.MethodGet, "/rates", protected.ThenFunc(app.exchangeRates))
+	router.Handler(http.MethodPost, "/rates/import", protected.ThenFunc(app.importRatesPost))
+	router.Handler(http.MethodGet, "/receivables", protected.ThenFunc(app.receivables))
+	router.Handler(http.MethodGet, "/statements", protected.ThenFunc(app.bankStatements))
+	router.Handler(http.MethodGet, "/mpp", protected.ThenFunc(app.splitPayments))
+	router.Handler(http.MethodPost, "/mpp/elixir", protected.ThenFunc(app.splitPaymentsElixirPost))
+	router.Handler(http.MethodPost, "/statements/import", protected.ThenFunc(app.importStatementPost))
+	router.Handler(http.MethodPost, "/statements/confirm/:id", protected.ThenFunc(app.confirmTransactionPost))
+	router.Handler(http.MethodPost, "/statements/confirmall", protected.ThenFunc(app.confirmAllTransactionsPost))
+	router.Handler(http.MethodPost, "/statements/ignore/:id", protected.ThenFunc(app.ignoreTransactionPost))
+	router.Handler(http.MethodGet, "/baddebts", protected.ThenFunc(app.badDebtsList))
+	router.Handler(http.MethodPost, "/baddebts/apply", protected.ThenFunc(app.applyBadDebtPost))
+	router.Handler(http.MethodPost, "/baddebts/delete/:id", protected.ThenFunc(app.deleteBadDebtPost))
+	router.Handler(http.MethodGet, "/periods", protected.ThenFunc(app.periods))
+	router.Handler(http.MethodPost, "/periods/unlock", protected.ThenFunc(app.unlockPeriodPost))
+	router.Handler(http.MethodGet, "/users", protected.ThenFunc(app.companyUsers))
+	router.Handler(http.MethodPost, "/users", protected.ThenFunc(app.addCompanyUserPost))
+	router.Handler(http.MethodGet, "/settings", protected.ThenFunc(app.settings))
+	router.Handler(http.MethodPost, "/settings", protected.ThenFunc(app.settingsPost))
 	router.Handler(http.MethodPost, "/user/logout", protected.ThenFunc(app.userLogoutPost))
 	//
 
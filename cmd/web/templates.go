@@ -9,18 +9,53 @@ import (
 )
 
 type templateData struct {
-	Invoice         *models.Invoice
-	Invoices        []*models.Invoice
-	InvDeletable    bool
-	CompanyName     string
-	Jpk             *models.JPK
-	JpkMetadata     *models.JPKMetadata
-	JpkListData     []*models.JPKMetadata
-	Form            any
-	Flash           string
-	IsAuthenticated bool
-	CSRFToken       string
+	Invoice          *models.Invoice
+	CorrectedInvoice *models.Invoice
+	Invoices         []*models.Invoice
+	InvDeletable     bool
+	PeriodLocked     bool
+	PeriodLocks      []*models.PeriodLock
+	PeriodUnlocks    []*models.PeriodUnlock
+	IsOwner          bool
+	Users            []*models.User
+	InvoiceHistory   []*models.InvoiceChange
+	CompanyName      string
+	Contractor       *models.Contractor
+	Contractors      []*models.Contractor
+	Szukaj           string
+	VatRates         []models.VatRate
+	SaleMarkers      []models.Marker
+	PurchaseMarkers  []models.Marker
+	DocumentTypes    []models.DocumentType
+	TransactionTypes []models.TransactionType
+	DeductionTypes   []models.DeductionType
+	DokumentFilter   models.DocumentType
+	Jpk              *models.JPK
+	JpkMetadata      *models.JPKMetadata
+	JpkListData      []*models.JPKMetadata
+	JpkChain         []*models.JPKMetadata
+	Ledger           []*models.CarryForward
+	ZwrotTerminy     []models.ZwrotTermin
+	Waluty           []string
+	ExchangeRates    []*models.ExchangeRate
+	Payments         []*models.Payment
+	Zaplacono        models.Money
+	MetodaKasowa     bool
+	BadDebts         []*models.BadDebt
+	BadDebtReliefs   []*models.BadDebt
+	PaymentMethods   []models.PaymentMethod
+	Receivables      []*models.AgeingRow
+	Payables         []*models.AgeingRow
+	BankTransactions []*models.BankTransaction
+	OpenInvoices     []*models.Invoice
+	SplitPayments    []*models.SplitPayment
+	CompanyProfile   *models.CompanyProfile
+	Form             any
+	Flash            string
+	IsAuthenticated  bool
+	CSRFToken        string
 	CurrentDate time.Time
+	Today       time.Time
 }
 
 func newTemplateCache() (map[string]*template.Template, error) {
@@ -0,0 +1,294 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	mssql "github.com/microsoft/go-mssqldb"
+)
+
+// BadDebt is a domestic sale invoice left unpaid 90 days after its due date. The output VAT on the unpaid
+// part may be corrected under art. 89a, and the correction is reversed in the periods the invoice is paid
+// in afterwards. Brutto and Zaplacono are in the invoice currency.
+type BadDebt struct {
+	Id              int
+	InvoiceId       int
+	Nr_faktury      string
+	Nip             string
+	Kontrahent      string
+	Data            time.Time
+	TerminPlatnosci time.Time
+	Waluta          string
+	Brutto          Money
+	Zaplacono       Money
+	// Okres is the period the relief was applied in, zero while it has not been applied
+	Okres time.Time
+}
+
+func (d BadDebt) Niezaplacono() Money {
+	return d.Brutto - d.Zaplacono
+}
+
+// Od returns the first day the debt is presumed uncollectable.
+func (d BadDebt) Od() time.Time {
+	return zlyDlugOd(d.TerminPlatnosci)
+}
+
+// Okresy returns the periods the relief can be applied in up to the month of dzien: from the month the debt
+// became uncollectable until the end of the third year after the year of issue.
+func (d BadDebt) Okresy(dzien time.Time) []time.Time {
+	var okresy []time.Time
+	koniec := time.Date(d.Data.Year()+3, time.December, 1, 0, 0, 0, 0, time.UTC)
+	for okres := monthOf(d.Od()); !okres.After(monthOf(dzien)) && !okres.After(koniec); okres = okres.AddDate(0, 1, 0) {
+		okresy = append(okresy, okres)
+	}
+	return okresy
+}
+
+func zlyDlugOd(terminPlatnosci time.Time) time.Time {
+	return terminPlatnosci.AddDate(0, 0, 91)
+}
+
+type BadDebtModel struct {
+	DB *sql.DB
+}
+
+// badDebtCandidates selects the invoices the relief may be applied to: domestic VAT sale invoices with a
+// NIP, unpaid 90 days after the due date, neither corrected nor settled by the cash method.
+const badDebtCandidates = `SELECT i.id, i.nr_faktury, i.nip, COALESCE(c.nazwa, ''), i.data, i.termin_platnosci, COALESCE(i.waluta, 'PLN'),
+	COALESCE(i.netto_waluta, i.netto) + COALESCE(i.podatek_waluta, i.podatek),
+	COALESCE((SELECT SUM(p.kwota) FROM Payments p WHERE p.invoice_id = i.id AND p.company_nip = i.company_nip), 0)
+	FROM Invoices i LEFT JOIN Companies c ON c.company_nip = i.company_nip AND c.nip = i.nip
+	WHERE i.company_nip = @p1 AND i.type = 'SALE' AND i.termin_platnosci < DATEADD(day, -90, @p2)
+	AND COALESCE(i.doc_type, 'VAT') = 'VAT' AND COALESCE(i.transakcja, 'KRAJ') = 'KRAJ' AND i.nip <> '' AND i.korekta_do IS NULL
+	AND NOT EXISTS (SELECT 1 FROM Invoices k WHERE k.korekta_do = i.id AND k.company_nip = i.company_nip)
+	AND NOT EXISTS (SELECT 1 FROM BadDebts b WHERE b.invoice_id = i.id AND b.company_nip = i.company_nip)
+	AND COALESCE((SELECT metoda_kasowa FROM CompanyProfiles WHERE company_nip = @p1), 0) = 0
+	AND COALESCE(i.netto_waluta, i.netto) + COALESCE(i.podatek_waluta, i.podatek) >
+	COALESCE((SELECT SUM(p.kwota) FROM Payments p WHERE p.invoice_id = i.id AND p.company_nip = i.company_nip), 0)`
+
+func scanBadDebts(rows *sql.Rows, applied bool) ([]*BadDebt, error) {
+	defer rows.Close()
+	debts := []*BadDebt{}
+	for rows.Next() {
+		d := &BadDebt{}
+		dest := []any{&d.InvoiceId, &d.Nr_faktury, &d.Nip, &d.Kontrahent, &d.Data, &d.TerminPlatnosci, &d.Waluta, &d.Brutto, &d.Zaplacono}
+		if applied {
+			dest = append(dest, &d.Id, &d.Okres)
+		}
+		err := rows.Scan(dest...)
+		if err != nil {
+			return nil, err
+		}
+		debts = append(debts, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return debts, nil
+}
+
+// Candidates returns the invoices the relief can be applied to on the day, the longest overdue first.
+func (m *BadDebtModel) Candidates(company_nip string, dzien time.Time) ([]*BadDebt, error) {
+	rows, err := m.DB.Query(badDebtCandidates+" ORDER BY i.termin_platnosci, i.id", company_nip, dzien)
+	if err != nil {
+		return nil, err
+	}
+	return scanBadDebts(rows, false)
+}
+
+// Applied returns the reliefs applied by the company, the latest period first.
+func (m *BadDebtModel) Applied(company_nip string) ([]*BadDebt, error) {
+	stmt := `SELECT i.id, i.nr_faktury, i.nip, COALESCE(c.nazwa, ''), i.data, i.termin_platnosci, COALESCE(i.waluta, 'PLN'),
+	COALESCE(i.netto_waluta, i.netto) + COALESCE(i.podatek_waluta, i.podatek),
+	COALESCE((SELECT SUM(p.kwota) FROM Payments p WHERE p.invoice_id = i.id AND p.company_nip = i.company_nip), 0),
+	b.id, b.okres
+	FROM BadDebts b JOIN Invoices i ON i.id = b.invoice_id AND i.company_nip = b.company_nip
+	LEFT JOIN Companies c ON c.company_nip = i.company_nip AND c.nip = i.nip
+	WHERE b.company_nip = @p1 ORDER BY b.okres DESC, i.termin_platnosci`
+	rows, err := m.DB.Query(stmt, company_nip)
+	if err != nil {
+		return nil, err
+	}
+	return scanBadDebts(rows, true)
+}
+
+// Apply records the relief for the invoice in the settlement period. The invoice has to be a bad debt by
+// the end of the period.
+func (m *BadDebtModel) Apply(invoiceId int, company_nip string, okres time.Time) error {
+	okres = monthOf(okres)
+	rows, err := m.DB.Query(badDebtCandidates+" AND i.id = @p3", company_nip, okres.AddDate(0, 1, -1), invoiceId)
+	if err != nil {
+		return err
+	}
+	debts, err := scanBadDebts(rows, false)
+	if err != nil {
+		return err
+	}
+	if len(debts) == 0 || !containsMonth(debts[0].Okresy(okres), okres) {
+		return ErrNotBadDebt
+	}
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	locked, err := periodLocked(tx, company_nip, okres)
+	if err != nil {
+		return err
+	}
+	if locked {
+		return ErrPeriodLocked
+	}
+	_, err = tx.Exec("INSERT INTO BadDebts (invoice_id, company_nip, okres, created_at) VALUES (@p1, @p2, @p3, @p4)", invoiceId, company_nip, okres, time.Now())
+	if err != nil {
+		// one relief per invoice, enforced by UQ_BadDebts_invoice
+		var msSQLError *mssql.Error
+		if errors.As(err, &msSQLError) && (msSQLError.Number == 2627 || msSQLError.Number == 2601) {
+			return ErrBadDebtApplied
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+func containsMonth(okresy []time.Time, okres time.Time) bool {
+	for _, o := range okresy {
+		if o.Year() == okres.Year() && o.Month() == okres.Month() {
+			return true
+		}
+	}
+	return false
+}
+
+// Delete withdraws the relief. The period it was applied in and every later month the invoice was paid in
+// have to be open, since the JPK of each of them changes.
+func (m *BadDebtModel) Delete(id int, company_nip string) error {
+	var invoiceId int
+	var okres time.Time
+	err := m.DB.QueryRow("SELECT invoice_id, okres FROM BadDebts WHERE id = @p1 AND company_nip = @p2", id, company_nip).Scan(&invoiceId, &okres)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+	okresy := []time.Time{okres}
+	stmt := `SELECT DISTINCT DATEFROMPARTS(YEAR(data), MONTH(data), 1) FROM Payments
+	WHERE invoice_id = @p1 AND company_nip = @p2 AND data >= DATEADD(month, 1, @p3)`
+	rows, err := m.DB.Query(stmt, invoiceId, company_nip, okres)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var o time.Time
+		if err = rows.Scan(&o); err != nil {
+			rows.Close()
+			return err
+		}
+		okresy = append(okresy, o)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return err
+	}
+	for _, o := range okresy {
+		locked, err := periodLocked(m.DB, company_nip, o)
+		if err != nil {
+			return err
+		}
+		if locked {
+			return ErrPeriodLocked
+		}
+	}
+	_, err = m.DB.Exec("DELETE FROM BadDebts WHERE id = @p1 AND company_nip = @p2", id, company_nip)
+	return err
+}
+
+// ulga returns the relief row of the invoice: the part left unpaid after zaplacono, with the amounts
+// reversed.
+func (inv *Invoice) ulga(zaplacono Money) *Invoice {
+	part := inv.paidPart(zaplacono, inv.BruttoWaluta()-zaplacono)
+	part.Netto, part.Podatek = -part.Netto, -part.Podatek
+	part.NettoWaluta, part.PodatekWaluta = -part.NettoWaluta, -part.PodatekWaluta
+	for i := range part.Kwoty {
+		part.Kwoty[i].Netto, part.Kwoty[i].Podatek = -part.Kwoty[i].Netto, -part.Kwoty[i].Podatek
+	}
+	part.zlyDlug = true
+	return part
+}
+
+// badDebtRows returns the bad-debt corrections of the settlement month: the reliefs applied in it, reduced
+// by the payments made by its end, and the reversals of earlier reliefs by the payments made in it.
+func (m *InvoiceModel) badDebtRows(company_nip string, okres time.Time) ([]*Invoice, error) {
+	stmt := `SELECT b.invoice_id, b.okres,
+	COALESCE((SELECT SUM(p.kwota) FROM Payments p WHERE p.invoice_id = b.invoice_id AND p.company_nip = b.company_nip AND p.data < DATEFROMPARTS(@p1, @p2, 1)), 0),
+	COALESCE((SELECT SUM(p.kwota) FROM Payments p WHERE p.invoice_id = b.invoice_id AND p.company_nip = b.company_nip AND p.data >= DATEFROMPARTS(@p1, @p2, 1) AND p.data < DATEADD(month, 1, DATEFROMPARTS(@p1, @p2, 1))), 0),
+	(SELECT MAX(p.data) FROM Payments p WHERE p.invoice_id = b.invoice_id AND p.company_nip = b.company_nip AND p.data >= DATEFROMPARTS(@p1, @p2, 1) AND p.data < DATEADD(month, 1, DATEFROMPARTS(@p1, @p2, 1)))
+	FROM BadDebts b WHERE b.company_nip = @p3 AND b.okres <= DATEFROMPARTS(@p1, @p2, 1)`
+	rows, err := m.DB.Query(stmt, okres.Year(), int(okres.Month()), company_nip)
+	if err != nil {
+		return nil, err
+	}
+	type ulga struct {
+		invoiceId       int
+		okres           time.Time
+		przed, wOkresie Money
+		dataZaplaty     sql.NullTime
+	}
+	var ulgi []ulga
+	for rows.Next() {
+		var u ulga
+		err = rows.Scan(&u.invoiceId, &u.okres, &u.przed, &u.wOkresie, &u.dataZaplaty)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ulgi = append(ulgi, u)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	// only the reliefs applied in the month and the ones paid in it give a row
+	invoices, err := m.list(`company_nip = @p3 AND id IN (SELECT b.invoice_id FROM BadDebts b WHERE b.company_nip = @p3
+	AND (b.okres >= DATEFROMPARTS(@p1, @p2, 1) AND b.okres < DATEADD(month, 1, DATEFROMPARTS(@p1, @p2, 1))
+	OR EXISTS (SELECT 1 FROM Payments p WHERE p.invoice_id = b.invoice_id AND p.company_nip = b.company_nip
+	AND p.data >= DATEFROMPARTS(@p1, @p2, 1) AND p.data < DATEADD(month, 1, DATEFROMPARTS(@p1, @p2, 1)))))`,
+		okres.Year(), int(okres.Month()), company_nip)
+	if err != nil {
+		return nil, err
+	}
+	byId := map[int]*Invoice{}
+	for _, inv := range invoices {
+		byId[inv.Id] = inv
+	}
+	var wiersze []*Invoice
+	for _, u := range ulgi {
+		nowa := u.okres.Year() == okres.Year() && u.okres.Month() == okres.Month()
+		if !nowa && u.wOkresie == 0 {
+			continue
+		}
+		inv, ok := byId[u.invoiceId]
+		if !ok {
+			return nil, ErrNoRecord
+		}
+		var wiersz *Invoice
+		if nowa {
+			if u.przed+u.wOkresie >= inv.BruttoWaluta() {
+				continue
+			}
+			wiersz = inv.ulga(u.przed + u.wOkresie)
+		} else {
+			wiersz = inv.paidPart(u.przed, u.wOkresie)
+			wiersz.zlyDlug = true
+			wiersz.dataZaplaty = u.dataZaplaty.Time
+		}
+		wiersz.Okres = monthOf(okres)
+		wiersze = append(wiersze, wiersz)
+	}
+	return wiersze, nil
+}
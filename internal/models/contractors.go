@@ -0,0 +1,210 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Contractor is an entry of the company's registry of customers and suppliers. Invoices refer to it by NIP.
+type Contractor struct {
+	Id       int
+	Nip      string
+	Nazwa    string
+	KodKraju string
+	// Faktury is the number of invoices issued to or received from the contractor
+	Faktury int
+}
+
+// NumerVat is the tax number with the country prefix when it is not Polish.
+func (c *Contractor) NumerVat() string {
+	if c.KodKraju == "PL" {
+		return c.Nip
+	}
+	return c.KodKraju + c.Nip
+}
+
+type ContractorModel struct {
+	DB *sql.DB
+}
+
+// contractorsBatch caps the NIPs passed to one query, SQL Server accepts at most 2100 parameters.
+const contractorsBatch = 1000
+
+// saveContractor adds the contractor of an invoice to the registry when it is not there yet. An entry
+// already in the registry is kept as it is: its name is shared by every invoice of the contractor, so it
+// is only changed on the contractor pages, which check the locked periods and record the history.
+func saveContractor(tx *sql.Tx, company_nip, kodKraju, nip, nazwa string) error {
+	stmt := `MERGE Companies AS t USING (SELECT @p1 AS company_nip, @p2 AS nip) AS s
+	ON t.company_nip = s.company_nip AND t.nip = s.nip
+	WHEN NOT MATCHED THEN INSERT (company_nip, nip, nazwa, kod_kraju) VALUES (@p1, @p2, @p3, @p4);`
+	if kodKraju == "" {
+		kodKraju = "PL"
+	}
+	_, err := tx.Exec(stmt, company_nip, nip, nazwa, kodKraju)
+	return err
+}
+
+// contractorsByNip returns the registry entries of the given NIPs, loading them in as few queries as
+// possible.
+func contractorsByNip(db *sql.DB, company_nip string, all []string) (map[string]*Contractor, error) {
+	contractors := map[string]*Contractor{}
+	var nips []string
+	seen := map[string]bool{}
+	for _, nip := range all {
+		if !seen[nip] {
+			seen[nip] = true
+			nips = append(nips, nip)
+		}
+	}
+	for start := 0; start < len(nips); start += contractorsBatch {
+		batch := nips[start:min(start+contractorsBatch, len(nips))]
+		args := []any{company_nip}
+		params := make([]string, len(batch))
+		for i, nip := range batch {
+			args = append(args, nip)
+			params[i] = fmt.Sprintf("@p%d", i+2)
+		}
+		stmt := "SELECT id, nip, nazwa, kod_kraju FROM Companies WHERE company_nip = @p1 AND nip IN (" + strings.Join(params, ", ") + ")"
+		rows, err := db.Query(stmt, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			c := &Contractor{}
+			err = rows.Scan(&c.Id, &c.Nip, &c.Nazwa, &c.KodKraju)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			contractors[c.Nip] = c
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return contractors, nil
+}
+
+// All returns the contractors whose NIP or name contains szukaj, every contractor when it is empty.
+func (m *ContractorModel) All(company_nip string, szukaj string) ([]*Contractor, error) {
+	stmt := `SELECT c.id, c.nip, c.nazwa, c.kod_kraju, (SELECT COUNT(*) FROM Invoices i WHERE i.company_nip = c.company_nip AND i.nip = c.nip)
+	FROM Companies c WHERE c.company_nip = @p1 AND (@p2 = '' OR c.nip LIKE '%' + @p2 + '%' OR c.nazwa LIKE '%' + @p2 + '%')
+	ORDER BY c.nazwa`
+	rows, err := m.DB.Query(stmt, company_nip, szukaj)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	contractors := []*Contractor{}
+	for rows.Next() {
+		c := &Contractor{}
+		err = rows.Scan(&c.Id, &c.Nip, &c.Nazwa, &c.KodKraju, &c.Faktury)
+		if err != nil {
+			return nil, err
+		}
+		contractors = append(contractors, c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return contractors, nil
+}
+
+func (m *ContractorModel) Get(id int, company_nip string) (*Contractor, error) {
+	stmt := `SELECT c.id, c.nip, c.nazwa, c.kod_kraju, (SELECT COUNT(*) FROM Invoices i WHERE i.company_nip = c.company_nip AND i.nip = c.nip)
+	FROM Companies c WHERE c.id = @p1 AND c.company_nip = @p2`
+	c := &Contractor{}
+	err := m.DB.QueryRow(stmt, id, company_nip).Scan(&c.Id, &c.Nip, &c.Nazwa, &c.KodKraju, &c.Faktury)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+func (m *ContractorModel) Insert(c *Contractor, company_nip string) (int, error) {
+	var exists bool
+	err := m.DB.QueryRow("SELECT CASE WHEN EXISTS(SELECT 1 FROM Companies WHERE company_nip = @p1 AND nip = @p2) THEN 1 ELSE 0 END", company_nip, c.Nip).Scan(&exists)
+	if err != nil {
+		return 0, err
+	}
+	if exists {
+		return 0, ErrDuplicateNip
+	}
+	stmt := "INSERT INTO Companies (company_nip, nip, nazwa, kod_kraju) OUTPUT Inserted.id VALUES (@p1, @p2, @p3, @p4)"
+	var id int
+	err = m.DB.QueryRow(stmt, company_nip, c.Nip, c.Nazwa, c.KodKraju).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// Update corrects the name and country of the contractor. The NIP ties it to its invoices, a wrong one is
+// fixed by merging into the right entry.
+func (m *ContractorModel) Update(c *Contractor, company_nip string) error {
+	stmt := "UPDATE Companies SET nazwa = @p1, kod_kraju = @p2 WHERE id = @p3 AND company_nip = @p4"
+	res, err := m.DB.Exec(stmt, c.Nazwa, c.KodKraju, c.Id, company_nip)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
+
+// Merge moves the invoices of a duplicate entry to the kept one and removes the duplicate. Each moved
+// invoice gets a history entry for the changed NIP. Invoices in a locked period cannot be moved.
+func (m *ContractorModel) Merge(duplikatId, docelowyId int, company_nip string, userId int) error {
+	duplikat, err := m.Get(duplikatId, company_nip)
+	if err != nil {
+		return err
+	}
+	docelowy, err := m.Get(docelowyId, company_nip)
+	if err != nil {
+		return err
+	}
+	lockStmt := `SELECT CASE WHEN EXISTS(SELECT 1 FROM Invoices i JOIN PeriodLocks l
+	ON l.company_nip = i.company_nip AND l.year = YEAR(COALESCE(i.okres, i.data)) AND l.month = MONTH(COALESCE(i.okres, i.data))
+	WHERE i.company_nip = @p1 AND i.nip = @p2) THEN 1 ELSE 0 END`
+	hStmt := `INSERT INTO InvoiceHistory (invoice_id, user_id, changed_at, pole, przed, po)
+	SELECT id, @p1, @p2, 'NIP', nip, @p3 FROM Invoices WHERE company_nip = @p4 AND nip = @p5`
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var locked bool
+	err = tx.QueryRow(lockStmt, company_nip, duplikat.Nip).Scan(&locked)
+	if err != nil {
+		return err
+	}
+	if locked {
+		return ErrPeriodLocked
+	}
+	_, err = tx.Exec(hStmt, userId, time.Now(), docelowy.Nip, company_nip, duplikat.Nip)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE Invoices SET nip = @p1 WHERE company_nip = @p2 AND nip = @p3", docelowy.Nip, company_nip, duplikat.Nip)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM Companies WHERE id = @p1 AND company_nip = @p2", duplikat.Id, company_nip)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,385 @@
+package models
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PLN is the currency of the registers and the declaration. Amounts in any other currency are converted
+// at the NBP average rate.
+const PLN = "PLN"
+
+// Waluty lists the invoice currencies offered on forms.
+var Waluty = []string{PLN, "EUR", "USD", "GBP", "CHF", "CZK", "DKK", "NOK", "SEK"}
+
+// Kurs is an exchange rate in ten-thousandths of a zloty per unit of currency, the precision of the NBP
+// tables.
+type Kurs int64
+
+// ParseKurs reads a rate such as "4,3480" or "4.348".
+func ParseKurs(s string) (Kurs, error) {
+	s = strings.ReplaceAll(strings.TrimSpace(s), ",", ".")
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" || len(frac) > 6 {
+		return 0, ErrInvalidAmount
+	}
+	var v int64
+	for _, c := range whole + (frac + "0000")[:4] {
+		if c < '0' || c > '9' {
+			return 0, ErrInvalidAmount
+		}
+		v = v*10 + int64(c-'0')
+		if v > math.MaxInt64/100 {
+			return 0, ErrInvalidAmount
+		}
+	}
+	for _, c := range frac[min(len(frac), 4):] {
+		if c < '0' || c > '9' {
+			return 0, ErrInvalidAmount
+		}
+	}
+	if len(frac) > 4 && frac[4] >= '5' {
+		v++
+	}
+	return Kurs(v), nil
+}
+
+func (k Kurs) String() string {
+	return fmt.Sprintf("%d.%04d", int64(k)/10000, int64(k)%10000)
+}
+
+func (k *Kurs) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*k = 0
+	case float64:
+		*k = Kurs(math.Round(v * 10000))
+	case []byte:
+		return k.Scan(string(v))
+	case string:
+		parsed, err := ParseKurs(v)
+		if err != nil {
+			return err
+		}
+		*k = parsed
+	default:
+		return fmt.Errorf("models: cannot scan %T into Kurs", src)
+	}
+	return nil
+}
+
+func (k Kurs) Value() (driver.Value, error) {
+	return k.String(), nil
+}
+
+// Convert returns the amount in zloty, rounded to grosze.
+func (m Money) Convert(k Kurs) Money {
+	return Money(roundDiv(int64(m)*int64(k), 10000))
+}
+
+// ExchangeRate is the NBP average rate of a currency published in a table A.
+type ExchangeRate struct {
+	Waluta string
+	Data   time.Time
+	Kurs   Kurs
+	Tabela string
+}
+
+type ExchangeRateModel struct {
+	DB *sql.DB
+}
+
+// rateMaxAge is how far back a rate may be looked up. A longer gap means the tables were not imported.
+const rateMaxAge = 10 * 24 * time.Hour
+
+// rateBefore returns the rate of the last table published before the day, which is the table of the
+// previous business day.
+func rateBefore(q querier, waluta string, dzien time.Time) (*ExchangeRate, error) {
+	stmt := "SELECT waluta, data, kurs, tabela FROM ExchangeRates WHERE waluta = @p1 AND data >= @p2 AND data < @p3"
+	day := dateOf(dzien)
+	rows, err := q.Query(stmt, waluta, day.Add(-rateMaxAge).Format("2006-01-02"), day.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var rates []ExchangeRate
+	for rows.Next() {
+		var r ExchangeRate
+		err = rows.Scan(&r.Waluta, &r.Data, &r.Kurs, &r.Tabela)
+		if err != nil {
+			return nil, err
+		}
+		rates = append(rates, r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return lastTableBefore(rates, dzien)
+}
+
+// lastTableBefore picks the rate of the last table published before the day. No table is published on
+// weekends and holidays, so after them the rate comes from the last business day before. A rate older
+// than rateMaxAge is not used.
+func lastTableBefore(rates []ExchangeRate, dzien time.Time) (*ExchangeRate, error) {
+	day := dateOf(dzien)
+	var last *ExchangeRate
+	for i, r := range rates {
+		data := dateOf(r.Data)
+		if !data.Before(day) || day.Sub(data) > rateMaxAge {
+			continue
+		}
+		if last == nil || data.After(dateOf(last.Data)) {
+			last = &rates[i]
+		}
+	}
+	if last == nil {
+		return nil, ErrNoExchangeRate
+	}
+	return last, nil
+}
+
+// dateOf returns the calendar day of the time, as the dates stored in the database.
+func dateOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Import stores the rates, replacing the ones already imported for the same currency and day. It returns
+// the number of rates stored.
+func (m *ExchangeRateModel) Import(rates []ExchangeRate) (int, error) {
+	stmt := `MERGE ExchangeRates AS t USING (SELECT @p1 AS waluta, @p2 AS data) AS s
+	ON t.waluta = s.waluta AND t.data = s.data
+	WHEN MATCHED THEN UPDATE SET kurs = @p3, tabela = @p4
+	WHEN NOT MATCHED THEN INSERT (waluta, data, kurs, tabela) VALUES (@p1, @p2, @p3, @p4);`
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	for _, r := range rates {
+		_, err = tx.Exec(stmt, r.Waluta, r.Data.Format("2006-01-02"), r.Kurs, r.Tabela)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(rates), nil
+}
+
+// Latest returns the most recent rate of every invoice currency that has one.
+func (m *ExchangeRateModel) Latest() ([]*ExchangeRate, error) {
+	stmt := `SELECT r.waluta, r.data, r.kurs, r.tabela FROM ExchangeRates r
+	WHERE r.data = (SELECT MAX(data) FROM ExchangeRates WHERE waluta = r.waluta) ORDER BY r.waluta`
+	rows, err := m.DB.Query(stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rates := []*ExchangeRate{}
+	for rows.Next() {
+		r := &ExchangeRate{}
+		err = rows.Scan(&r.Waluta, &r.Data, &r.Kurs, &r.Tabela)
+		if err != nil {
+			return nil, err
+		}
+		rates = append(rates, r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return rates, nil
+}
+
+// nbpTable is a table in the format of the NBP web API. The API returns a single ExchangeRatesTable or a
+// list of them in ArrayOfExchangeRatesTable.
+type nbpTable struct {
+	No            string `xml:"No"`
+	EffectiveDate string `xml:"EffectiveDate"`
+	Rates         []struct {
+		Code string `xml:"Code"`
+		Mid  string `xml:"Mid"`
+	} `xml:"Rates>Rate"`
+}
+
+type nbpTables struct {
+	Tables []nbpTable `xml:"ExchangeRatesTable"`
+}
+
+// nbpTabelaKursow is a table in the format of the files published at nbp.pl/kursy/xml.
+type nbpTabelaKursow struct {
+	NumerTabeli    string `xml:"numer_tabeli"`
+	DataPublikacji string `xml:"data_publikacji"`
+	Pozycje        []struct {
+		Przelicznik string `xml:"przelicznik"`
+		KodWaluty   string `xml:"kod_waluty"`
+		KursSredni  string `xml:"kurs_sredni"`
+	} `xml:"pozycja"`
+}
+
+// ParseNbpXML reads the invoice currency rates of table A from either XML format published by NBP: the
+// web API one (ExchangeRatesTable) or the daily file one (tabela_kursow).
+func ParseNbpXML(r io.Reader) ([]ExchangeRate, error) {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	unmarshal := func(v any) error {
+		d := xml.NewDecoder(bytes.NewReader(body))
+		d.CharsetReader = asciiCharsetReader
+		return d.Decode(v)
+	}
+	var root struct {
+		XMLName xml.Name
+	}
+	if err = unmarshal(&root); err != nil {
+		return nil, ErrInvalidRates
+	}
+	var rates []ExchangeRate
+	switch root.XMLName.Local {
+	case "ArrayOfExchangeRatesTable", "ExchangeRatesTable":
+		var t nbpTables
+		if root.XMLName.Local == "ExchangeRatesTable" {
+			t.Tables = make([]nbpTable, 1)
+			err = unmarshal(&t.Tables[0])
+		} else {
+			err = unmarshal(&t)
+		}
+		if err != nil {
+			return nil, ErrInvalidRates
+		}
+		for _, table := range t.Tables {
+			data, err := time.Parse("2006-01-02", table.EffectiveDate)
+			if err != nil {
+				return nil, ErrInvalidRates
+			}
+			for _, rate := range table.Rates {
+				kurs, err := ParseKurs(rate.Mid)
+				if err != nil {
+					return nil, ErrInvalidRates
+				}
+				if slices.Contains(Waluty, rate.Code) {
+					rates = append(rates, ExchangeRate{Waluta: rate.Code, Data: data, Kurs: kurs, Tabela: table.No})
+				}
+			}
+		}
+	case "tabela_kursow":
+		var t nbpTabelaKursow
+		if err = unmarshal(&t); err != nil {
+			return nil, ErrInvalidRates
+		}
+		data, err := time.Parse("2006-01-02", t.DataPublikacji)
+		if err != nil {
+			return nil, ErrInvalidRates
+		}
+		for _, p := range t.Pozycje {
+			kurs, err := ParseKurs(p.KursSredni)
+			if err != nil {
+				return nil, ErrInvalidRates
+			}
+			przelicznik, err := strconv.Atoi(p.Przelicznik)
+			if err != nil || przelicznik < 1 {
+				return nil, ErrInvalidRates
+			}
+			if slices.Contains(Waluty, p.KodWaluty) {
+				rates = append(rates, ExchangeRate{Waluta: p.KodWaluty, Data: data, Kurs: kurs / Kurs(przelicznik), Tabela: t.NumerTabeli})
+			}
+		}
+	default:
+		return nil, ErrInvalidRates
+	}
+	if len(rates) == 0 {
+		return nil, ErrInvalidRates
+	}
+	return rates, nil
+}
+
+// asciiCharsetReader lets the decoder read the ISO-8859-2 files of NBP. Only codes, dates and rates are
+// read from them, which are plain ASCII, so the other characters are replaced.
+func asciiCharsetReader(charset string, input io.Reader) (io.Reader, error) {
+	body, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	for i, c := range body {
+		if c >= 0x80 {
+			body[i] = '?'
+		}
+	}
+	return bytes.NewReader(body), nil
+}
+
+// ParseNbpCSV reads the invoice currency rates from the yearly table A archive published by NBP as CSV. The header row names the columns
+// with the unit and code, e.g. "1USD" or "100HUF", the data rows start with the date as YYYYMMDD and end
+// with the table number.
+func ParseNbpCSV(r io.Reader) ([]ExchangeRate, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	type kolumna struct {
+		waluta      string
+		przelicznik int64
+	}
+	var kolumny []kolumna
+	nrTabeli := -1
+	var rates []ExchangeRate
+	for scanner.Scan() {
+		pola := strings.Split(strings.TrimRight(scanner.Text(), "\r"), ";")
+		if len(pola) < 2 {
+			continue
+		}
+		if kolumny == nil && strings.EqualFold(strings.TrimSpace(pola[0]), "data") {
+			kolumny = make([]kolumna, len(pola))
+			for i, p := range pola {
+				p = strings.TrimSpace(p)
+				j := strings.IndexFunc(p, func(c rune) bool { return c < '0' || c > '9' })
+				if j <= 0 || len(p)-j != 3 {
+					// the full table number is preferred over the sequence number of the year
+					naglowek := strings.ToLower(p)
+					if strings.Contains(naglowek, "numer tabeli") || (nrTabeli < 0 && naglowek == "nr tabeli") {
+						nrTabeli = i
+					}
+					continue
+				}
+				przelicznik, _ := strconv.ParseInt(p[:j], 10, 64)
+				kolumny[i] = kolumna{waluta: strings.ToUpper(p[j:]), przelicznik: przelicznik}
+			}
+			continue
+		}
+		data, err := time.Parse("20060102", strings.TrimSpace(pola[0]))
+		if err != nil || kolumny == nil {
+			// the rows below the header with currency names and the footer are skipped
+			continue
+		}
+		tabela := ""
+		if nrTabeli >= 0 && nrTabeli < len(pola) {
+			tabela = strings.TrimSpace(pola[nrTabeli])
+		}
+		for i, p := range pola {
+			if i >= len(kolumny) || !slices.Contains(Waluty, kolumny[i].waluta) || strings.TrimSpace(p) == "" {
+				continue
+			}
+			kurs, err := ParseKurs(p)
+			if err != nil {
+				return nil, ErrInvalidRates
+			}
+			rates = append(rates, ExchangeRate{Waluta: kolumny[i].waluta, Data: data, Kurs: kurs / Kurs(kolumny[i].przelicznik), Tabela: tabela})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(rates) == 0 {
+		return nil, ErrInvalidRates
+	}
+	return rates, nil
+}
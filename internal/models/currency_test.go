@@ -0,0 +1,208 @@
+package models
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestParseKurs(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Kurs
+		err  error
+	}{
+		{"4,3480", 43480, nil},
+		{"4.348", 43480, nil},
+		{" 4 ", 40000, nil},
+		{"0,17584", 1758, nil},
+		{"0,17585", 1759, nil},
+		{"0,123456", 1235, nil},
+		{"0,1234567", 0, ErrInvalidAmount},
+		{",5", 0, ErrInvalidAmount},
+		{"", 0, ErrInvalidAmount},
+		{"-4,34", 0, ErrInvalidAmount},
+		{"4,3x", 0, ErrInvalidAmount},
+		{"4,34561x", 0, ErrInvalidAmount},
+	}
+	for _, tt := range tests {
+		got, err := ParseKurs(tt.in)
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("ParseKurs(%q) = %d, %v; want %d, %v", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+const nbpCSV = "data;1THB;1USD;1EUR;100HUF;1CZK;nr tabeli;pe\xb3ny numer tabeli\r\n" +
+	";bat (Tajlandia);dolar ameryka\xf1ski;euro;forint (W\xeagry);korona czeska;;\r\n" +
+	"20240102;0,1150;3,9432;4,3434;1,1350;0,1758;1;001/A/NBP/2024\r\n" +
+	"20240103;0,1148;3,9909;4,3646;1,1447;;2;002/A/NBP/2024\r\n" +
+	"\r\n" +
+	"kod ISO;THB;USD;EUR;HUF;CZK;;\r\n" +
+	"liczba jednostek;1;1;1;100;1;;\r\n"
+
+func TestParseNbpCSV(t *testing.T) {
+	got, err := ParseNbpCSV(strings.NewReader(nbpCSV))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ExchangeRate{
+		{Waluta: "USD", Data: date("2024-01-02"), Kurs: 39432, Tabela: "001/A/NBP/2024"},
+		{Waluta: "EUR", Data: date("2024-01-02"), Kurs: 43434, Tabela: "001/A/NBP/2024"},
+		{Waluta: "CZK", Data: date("2024-01-02"), Kurs: 1758, Tabela: "001/A/NBP/2024"},
+		{Waluta: "USD", Data: date("2024-01-03"), Kurs: 39909, Tabela: "002/A/NBP/2024"},
+		{Waluta: "EUR", Data: date("2024-01-03"), Kurs: 43646, Tabela: "002/A/NBP/2024"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseNbpCSV() =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestParseNbpCSVInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"20240102;3,9432;4,3434\n",
+		"data;1USD;1EUR\n20240102;3,94x;4,3434\n",
+		"data;1THB\n20240102;0,1150\n",
+	}
+	for _, in := range tests {
+		if _, err := ParseNbpCSV(strings.NewReader(in)); !errors.Is(err, ErrInvalidRates) {
+			t.Errorf("ParseNbpCSV(%q) error = %v; want %v", in, err, ErrInvalidRates)
+		}
+	}
+}
+
+func TestParseNbpXML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []ExchangeRate
+	}{
+		{
+			"web API list",
+			`<?xml version="1.0" encoding="utf-8"?>
+<ArrayOfExchangeRatesTable xmlns:xsd="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+<ExchangeRatesTable><Table>A</Table><No>001/A/NBP/2024</No><EffectiveDate>2024-01-02</EffectiveDate><Rates>
+<Rate><Currency>bat (Tajlandia)</Currency><Code>THB</Code><Mid>0.1150</Mid></Rate>
+<Rate><Currency>dolar amerykański</Currency><Code>USD</Code><Mid>3.9432</Mid></Rate>
+</Rates></ExchangeRatesTable>
+<ExchangeRatesTable><Table>A</Table><No>002/A/NBP/2024</No><EffectiveDate>2024-01-03</EffectiveDate><Rates>
+<Rate><Currency>dolar amerykański</Currency><Code>USD</Code><Mid>3.9909</Mid></Rate>
+</Rates></ExchangeRatesTable>
+</ArrayOfExchangeRatesTable>`,
+			[]ExchangeRate{
+				{Waluta: "USD", Data: date("2024-01-02"), Kurs: 39432, Tabela: "001/A/NBP/2024"},
+				{Waluta: "USD", Data: date("2024-01-03"), Kurs: 39909, Tabela: "002/A/NBP/2024"},
+			},
+		},
+		{
+			"web API table",
+			`<ExchangeRatesTable><Table>A</Table><No>064/A/NBP/2024</No><EffectiveDate>2024-04-02</EffectiveDate><Rates>
+<Rate><Currency>euro</Currency><Code>EUR</Code><Mid>4.3191</Mid></Rate>
+</Rates></ExchangeRatesTable>`,
+			[]ExchangeRate{{Waluta: "EUR", Data: date("2024-04-02"), Kurs: 43191, Tabela: "064/A/NBP/2024"}},
+		},
+		{
+			"daily file in ISO-8859-2",
+			"<?xml version=\"1.0\" encoding=\"ISO-8859-2\"?>\n" +
+				`<tabela_kursow typ="A" uid="24a001"><numer_tabeli>001/A/NBP/2024</numer_tabeli><data_publikacji>2024-01-02</data_publikacji>` +
+				"<pozycja><nazwa_waluty>dolar ameryka\xf1ski</nazwa_waluty><przelicznik>1</przelicznik><kod_waluty>USD</kod_waluty><kurs_sredni>3,9432</kurs_sredni></pozycja>" +
+				"<pozycja><nazwa_waluty>forint (W\xeagry)</nazwa_waluty><przelicznik>100</przelicznik><kod_waluty>HUF</kod_waluty><kurs_sredni>1,1350</kurs_sredni></pozycja>" +
+				"<pozycja><nazwa_waluty>korona szwedzka</nazwa_waluty><przelicznik>10</przelicznik><kod_waluty>SEK</kod_waluty><kurs_sredni>3,9100</kurs_sredni></pozycja>" +
+				"</tabela_kursow>",
+			[]ExchangeRate{
+				{Waluta: "USD", Data: date("2024-01-02"), Kurs: 39432, Tabela: "001/A/NBP/2024"},
+				{Waluta: "SEK", Data: date("2024-01-02"), Kurs: 3910, Tabela: "001/A/NBP/2024"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		got, err := ParseNbpXML(strings.NewReader(tt.in))
+		if err != nil {
+			t.Errorf("%s: ParseNbpXML() error = %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: ParseNbpXML() =\n%v\nwant\n%v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseNbpXMLInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"<html></html>",
+		"<ExchangeRatesTable><No>1</No><EffectiveDate>2024-13-01</EffectiveDate></ExchangeRatesTable>",
+		"<ExchangeRatesTable><No>1</No><EffectiveDate>2024-01-02</EffectiveDate><Rates><Rate><Code>USD</Code><Mid>x</Mid></Rate></Rates></ExchangeRatesTable>",
+		"<ExchangeRatesTable><No>1</No><EffectiveDate>2024-01-02</EffectiveDate><Rates><Rate><Code>THB</Code><Mid>0.1150</Mid></Rate></Rates></ExchangeRatesTable>",
+		"<tabela_kursow><numer_tabeli>1</numer_tabeli><data_publikacji>2024-01-02</data_publikacji><pozycja><przelicznik>0</przelicznik><kod_waluty>USD</kod_waluty><kurs_sredni>3,9432</kurs_sredni></pozycja></tabela_kursow>",
+	}
+	for _, in := range tests {
+		if _, err := ParseNbpXML(strings.NewReader(in)); !errors.Is(err, ErrInvalidRates) {
+			t.Errorf("ParseNbpXML(%q) error = %v; want %v", in, err, ErrInvalidRates)
+		}
+	}
+}
+
+func TestLastTableBefore(t *testing.T) {
+	// tables of the business days around the weekends and holidays of the test cases
+	var rates []ExchangeRate
+	for _, d := range []string{
+		"2023-12-20", "2023-12-21", "2023-12-22", "2023-12-27", "2023-12-28", "2023-12-29", "2024-01-02",
+		"2024-03-14", "2024-03-15", "2024-03-18",
+		"2024-03-27", "2024-03-28", "2024-03-29", "2024-04-02",
+		"2024-04-30", "2024-05-02", "2024-05-06",
+	} {
+		rates = append(rates, ExchangeRate{Waluta: "EUR", Data: date(d), Tabela: d})
+	}
+	tests := []struct {
+		name  string
+		dzien time.Time
+		want  string
+	}{
+		{"weekday", date("2024-03-15"), "2024-03-14"},
+		{"time of day is ignored", date("2024-03-15").Add(23 * time.Hour), "2024-03-14"},
+		{"Saturday", date("2024-03-16"), "2024-03-15"},
+		{"Sunday", date("2024-03-17"), "2024-03-15"},
+		{"Monday", date("2024-03-18"), "2024-03-15"},
+		{"after Christmas", date("2023-12-27"), "2023-12-22"},
+		{"New Year's Day", date("2024-01-01"), "2023-12-29"},
+		{"after New Year's Day", date("2024-01-02"), "2023-12-29"},
+		{"after Easter Monday", date("2024-04-02"), "2024-03-29"},
+		{"Easter Sunday", date("2024-03-31"), "2024-03-29"},
+		{"after the 1 and 3 May holidays", date("2024-05-06"), "2024-05-02"},
+		{"between the May holidays", date("2024-05-02"), "2024-04-30"},
+	}
+	for _, tt := range tests {
+		got, err := lastTableBefore(rates, tt.dzien)
+		if err != nil {
+			t.Errorf("%s: lastTableBefore(%s) error = %v", tt.name, tt.dzien.Format("2006-01-02"), err)
+			continue
+		}
+		if got.Tabela != tt.want {
+			t.Errorf("%s: lastTableBefore(%s) = %s; want %s", tt.name, tt.dzien.Format("2006-01-02"), got.Tabela, tt.want)
+		}
+	}
+}
+
+func TestLastTableBeforeMissing(t *testing.T) {
+	rates := []ExchangeRate{{Waluta: "EUR", Data: date("2024-03-01")}, {Waluta: "EUR", Data: date("2024-03-15")}}
+	for _, d := range []string{"2024-03-01", "2024-02-28", "2024-03-12", "2024-03-26"} {
+		if _, err := lastTableBefore(rates, date(d)); !errors.Is(err, ErrNoExchangeRate) {
+			t.Errorf("lastTableBefore(%s) error = %v; want %v", d, err, ErrNoExchangeRate)
+		}
+	}
+	if _, err := lastTableBefore(nil, date("2024-03-15")); !errors.Is(err, ErrNoExchangeRate) {
+		t.Errorf("lastTableBefore(nil) error = %v; want %v", err, ErrNoExchangeRate)
+	}
+}
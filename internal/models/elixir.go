@@ -0,0 +1,173 @@
+package models
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// SplitPayment is a transfer paying what is left of a purchase invoice by the split payment mechanism.
+// Brutto is the amount of the transfer and Vat the part of it paid into the supplier's VAT account.
+type SplitPayment struct {
+	InvoiceId  int
+	Nr_faktury string
+	Nip        string
+	Dostawca   string
+	Rachunek   string
+	Brutto     Money
+	Vat        Money
+}
+
+// Tytul returns the transfer title in the form the banks require for the split payment.
+func (p SplitPayment) Tytul() string {
+	vat := strings.Replace(p.Vat.String(), ".", ",", 1)
+	return fmt.Sprintf("/VAT/%s/IDC/%s/INV/%s", vat, p.Nip, p.Nr_faktury)
+}
+
+// SplitPayments returns the unpaid domestic purchase invoices in zloty marked MPP, with the supplier's
+// Polish account. The VAT to pay is the part of the tax not covered by the payments made so far.
+func (m *InvoiceModel) SplitPayments(company_nip string) ([]*SplitPayment, error) {
+	stmt := `SELECT i.id, i.nr_faktury, i.nip, COALESCE(c.nazwa, ''), i.nr_rachunku, i.netto, i.podatek,
+	COALESCE((SELECT SUM(p.kwota) FROM Payments p WHERE p.invoice_id = i.id AND p.company_nip = i.company_nip), 0)
+	FROM Invoices i LEFT JOIN Companies c ON c.company_nip = i.company_nip AND c.nip = i.nip
+	WHERE i.company_nip = @p1 AND i.type = 'PURC' AND COALESCE(i.doc_type, 'VAT') IN ('VAT', 'MK') AND i.korekta_do IS NULL
+	AND COALESCE(i.waluta, 'PLN') = 'PLN' AND COALESCE(i.transakcja, 'KRAJ') = 'KRAJ' AND i.nip <> '' AND COALESCE(i.nr_rachunku, '') <> ''
+	AND EXISTS (SELECT 1 FROM InvoiceMarkers o WHERE o.invoice_id = i.id AND o.kod = 'MPP')
+	ORDER BY i.termin_platnosci, i.data, i.id`
+	rows, err := m.DB.Query(stmt, company_nip)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	platnosci := []*SplitPayment{}
+	for rows.Next() {
+		p := &SplitPayment{}
+		var netto, podatek, zaplacono Money
+		err = rows.Scan(&p.InvoiceId, &p.Nr_faktury, &p.Nip, &p.Dostawca, &p.Rachunek, &netto, &podatek, &zaplacono)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := nrbDigits(p.Rachunek); !ok || netto+podatek <= zaplacono {
+			continue
+		}
+		p.Rachunek = iban(p.Rachunek)
+		p.Brutto = netto + podatek - zaplacono
+		p.Vat = podatek - podatek.share(zaplacono, netto+podatek)
+		platnosci = append(platnosci, p)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return platnosci, nil
+}
+
+// nrbDigits returns the 26 digits of a Polish account number.
+func nrbDigits(numer string) (string, bool) {
+	numer = iban(numer)
+	if len(numer) != 28 || !strings.HasPrefix(numer, "PL") || strings.Trim(numer[2:], "0123456789") != "" {
+		return "", false
+	}
+	return numer[2:], true
+}
+
+// elixirKlasyfikacja is the order classification of a split payment transfer, an ordinary one is 51.
+const elixirKlasyfikacja = "53"
+
+// WriteElixir writes the transfers as an Elixir-O file to import into internet banking: a line of 16
+// comma-separated fields per transfer, text in quotes, multi-line text split by | into lines of 35
+// characters, encoded in Windows-1250.
+func WriteElixir(w io.Writer, zleceniodawca, rachunek string, dzien time.Time, platnosci []*SplitPayment) error {
+	nrbZleceniodawcy, ok := nrbDigits(rachunek)
+	if !ok {
+		return ErrInvalidAccount
+	}
+	out := bufio.NewWriter(w)
+	for _, p := range platnosci {
+		nrb, ok := nrbDigits(p.Rachunek)
+		if !ok {
+			return ErrInvalidAccount
+		}
+		pola := []string{
+			"110",
+			dzien.Format("20060102"),
+			fmt.Sprintf("%d", int64(p.Brutto)),
+			nrbZleceniodawcy[2:10],
+			"0",
+			elixirText(nrbZleceniodawcy, 1),
+			elixirText(nrb, 1),
+			elixirText(zleceniodawca, 4),
+			elixirText(p.Dostawca, 4),
+			"0",
+			nrb[2:10],
+			elixirText(p.Tytul(), 4),
+			`""`,
+			`""`,
+			`"` + elixirKlasyfikacja + `"`,
+			`""`,
+		}
+		_, err := out.Write(cp1250(strings.Join(pola, ",") + "\r\n"))
+		if err != nil {
+			return err
+		}
+	}
+	return out.Flush()
+}
+
+// elixirText quotes the text for an Elixir field of up to linie lines of 35 characters. Quotes and the
+// line separator cannot appear in the text, the excess is cut off.
+func elixirText(s string, linie int) string {
+	s = strings.NewReplacer(`"`, "'", "|", "/", "\r", " ", "\n", " ").Replace(strings.TrimSpace(s))
+	runes := []rune(s)
+	var wiersze []string
+	for len(runes) > 0 && len(wiersze) < linie {
+		n := min(len(runes), 35)
+		wiersze = append(wiersze, string(runes[:n]))
+		runes = runes[n:]
+	}
+	return `"` + strings.Join(wiersze, "|") + `"`
+}
+
+var cp1250Polish = map[rune]byte{
+	'ą': 0xb9, 'ć': 0xe6, 'ę': 0xea, 'ł': 0xb3, 'ń': 0xf1, 'ó': 0xf3, 'ś': 0x9c, 'ź': 0x9f, 'ż': 0xbf,
+	'Ą': 0xa5, 'Ć': 0xc6, 'Ę': 0xca, 'Ł': 0xa3, 'Ń': 0xd1, 'Ó': 0xd3, 'Ś': 0x8c, 'Ź': 0x8f, 'Ż': 0xaf,
+}
+
+// cp1250 encodes the text in Windows-1250, the encoding banks expect in Elixir files. Characters other
+// than ASCII and Polish letters are replaced by '?'.
+func cp1250(s string) []byte {
+	b := make([]byte, 0, len(s))
+	for _, c := range s {
+		switch {
+		case c < 0x80:
+			b = append(b, byte(c))
+		case cp1250Polish[c] != 0:
+			b = append(b, cp1250Polish[c])
+		default:
+			b = append(b, '?')
+		}
+	}
+	return b
+}
+
+// fromCp1250 decodes text in Windows-1250, the encoding of most bank statements. Bytes other than ASCII
+// and Polish letters are replaced by '_'.
+func fromCp1250(b []byte) string {
+	litery := make(map[byte]rune, len(cp1250Polish))
+	for c, k := range cp1250Polish {
+		litery[k] = c
+	}
+	var s strings.Builder
+	for _, k := range b {
+		switch {
+		case k < 0x80:
+			s.WriteByte(k)
+		case litery[k] != 0:
+			s.WriteRune(litery[k])
+		default:
+			s.WriteByte('_')
+		}
+	}
+	return s.String()
+}
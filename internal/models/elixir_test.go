@@ -0,0 +1,109 @@
+package models
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSplitPaymentTytul(t *testing.T) {
+	tests := []struct {
+		p    SplitPayment
+		want string
+	}{
+		{SplitPayment{Vat: 345000, Nip: "1234567890", Nr_faktury: "FV/1/2024"}, "/VAT/3450,00/IDC/1234567890/INV/FV/1/2024"},
+		{SplitPayment{Vat: 5, Nip: "5260250274", Nr_faktury: "12"}, "/VAT/0,05/IDC/5260250274/INV/12"},
+	}
+	for _, tt := range tests {
+		if got := tt.p.Tytul(); got != tt.want {
+			t.Errorf("Tytul() = %q; want %q", got, tt.want)
+		}
+	}
+}
+
+func TestWriteElixir(t *testing.T) {
+	platnosci := []*SplitPayment{
+		{Nr_faktury: "FV/1/2024", Nip: "1234567890", Dostawca: `Dostawca "Ąę" sp. z o.o.`, Rachunek: "PL27 1140 2004 0000 3002 0135 5387", Brutto: 1845000, Vat: 345000},
+		{Nr_faktury: "7", Nip: "5260250274", Dostawca: "Hurtownia", Rachunek: "27114020040000300201355387", Brutto: 12300, Vat: 2300},
+	}
+	var out bytes.Buffer
+	err := WriteElixir(&out, "Firma Ślązak", "PL61109010140000071219812874", time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC), platnosci)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `110,20240315,1845000,10901014,0,"61109010140000071219812874","27114020040000300201355387","Firma ` + "\x8cl\xb9zak" + `","Dostawca '` + "\xa5\xea" + `' sp. z o.o.",0,11402004,"/VAT/3450,00/IDC/1234567890/INV/FV/|1/2024","","","53",""` + "\r\n" +
+		`110,20240315,12300,10901014,0,"61109010140000071219812874","27114020040000300201355387","Firma ` + "\x8cl\xb9zak" + `","Hurtownia",0,11402004,"/VAT/23,00/IDC/5260250274/INV/7","","","53",""` + "\r\n"
+	if got := out.String(); got != want {
+		t.Errorf("WriteElixir() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestWriteElixirInvalidAccount(t *testing.T) {
+	dzien := time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)
+	valid := []*SplitPayment{{Rachunek: "PL27114020040000300201355387"}}
+	tests := []struct {
+		rachunek  string
+		platnosci []*SplitPayment
+	}{
+		{"DE89370400440532013000", valid},
+		{"PL6110901014", valid},
+		{"PL61109010140000071219812874", []*SplitPayment{{Rachunek: "DE89370400440532013000"}}},
+	}
+	for _, tt := range tests {
+		err := WriteElixir(&bytes.Buffer{}, "Firma", tt.rachunek, dzien, tt.platnosci)
+		if !errors.Is(err, ErrInvalidAccount) {
+			t.Errorf("WriteElixir(%q) error = %v; want %v", tt.rachunek, err, ErrInvalidAccount)
+		}
+	}
+}
+
+func TestElixirText(t *testing.T) {
+	tests := []struct {
+		in    string
+		linie int
+		want  string
+	}{
+		{"Firma", 4, `"Firma"`},
+		{` "A|B" `, 1, `"'A/B'"`},
+		{"a\r\nb", 1, `"a  b"`},
+		{strings.Repeat("x", 40), 4, `"` + strings.Repeat("x", 35) + `|xxxxx"`},
+		{strings.Repeat("x", 40), 1, `"` + strings.Repeat("x", 35) + `"`},
+		{strings.Repeat("ż", 36), 2, `"` + strings.Repeat("ż", 35) + `|ż"`},
+		{"", 4, `""`},
+	}
+	for _, tt := range tests {
+		if got := elixirText(tt.in, tt.linie); got != tt.want {
+			t.Errorf("elixirText(%q, %d) = %q; want %q", tt.in, tt.linie, got, tt.want)
+		}
+	}
+}
+
+func TestCp1250(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"abc 123,/|", "abc 123,/|"},
+		{"ąćęłńóśźż", "\xb9\xe6\xea\xb3\xf1\xf3\x9c\x9f\xbf"},
+		{"ĄĆĘŁŃÓŚŹŻ", "\xa5\xc6\xca\xa3\xd1\xd3\x8c\x8f\xaf"},
+		{"ü€", "??"},
+	}
+	for _, tt := range tests {
+		if got := string(cp1250(tt.in)); got != tt.want {
+			t.Errorf("cp1250(%q) = %q; want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFromCp1250(t *testing.T) {
+	for _, s := range []string{"abc 123,/|", "ąćęłńóśźż", "ĄĆĘŁŃÓŚŹŻ"} {
+		if got := fromCp1250(cp1250(s)); got != s {
+			t.Errorf("fromCp1250(cp1250(%q)) = %q", s, got)
+		}
+	}
+	if got := fromCp1250([]byte("\xfc\x80")); got != "__" {
+		t.Errorf("fromCp1250() = %q; want %q", got, "__")
+	}
+}
@@ -9,4 +9,20 @@ var (
 	ErrInvalidCredentials = errors.New("models: invalid credentials")
 	ErrDuplicateEmail     = errors.New("models: duplicate email")
 	ErrDuplicateNip       = errors.New("models: duplicate nip")
+	ErrIncompleteProfile  = errors.New("models: incomplete company profile")
+	ErrInvalidJpk         = errors.New("models: jpk file does not match the schema")
+	ErrNoSchema           = errors.New("models: jpk schema is not bundled")
+	ErrRefundTooHigh      = errors.New("models: refund exceeds the vat surplus")
+	ErrOffsetTooHigh      = errors.New("models: offset exceeds the refund")
+	ErrNoDeclaration      = errors.New("models: the file has no declaration part")
+	ErrPeriodLocked       = errors.New("models: period is locked by a confirmed jpk")
+	ErrNoExchangeRate     = errors.New("models: no exchange rate for the invoice date")
+	ErrInvalidRates       = errors.New("models: unrecognised exchange rate file")
+	ErrNotCorrectable     = errors.New("models: invoice cannot be corrected")
+	ErrHasCorrections     = errors.New("models: invoice has corrections")
+	ErrNotBadDebt         = errors.New("models: invoice does not qualify for bad-debt relief")
+	ErrBadDebtApplied     = errors.New("models: bad-debt relief already applied to the invoice")
+	ErrInvalidStatement   = errors.New("models: unrecognised bank statement file")
+	ErrPaymentMismatch    = errors.New("models: transaction does not fit the invoice")
+	ErrInvalidAccount     = errors.New("models: not a polish bank account number")
 )
@@ -0,0 +1,84 @@
+//go:build ignore
+
+// fetch_schemas downloads the JPK schemas published by the Ministry of Finance, with every schema they
+// import, into the schemas directory. Each file is stored unmodified under the host and path of its URL,
+// so http://crd.gov.pl/wzor/2021/12/27/11148/schemat.xsd becomes schemas/crd.gov.pl/wzor/2021/12/27/11148/schemat.xsd.
+// Files already present are kept. The downloaded files are committed, the build does not run this.
+//
+//	go generate ./internal/models
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+var roots = []string{
+	// JPK_V7M(2)
+	"http://crd.gov.pl/wzor/2021/12/27/11148/schemat.xsd",
+	// JPK_V7K(2)
+	"http://crd.gov.pl/wzor/2021/12/27/11149/schemat.xsd",
+}
+
+var schemaLocation = regexp.MustCompile(`schemaLocation="([^"]+)"`)
+
+func main() {
+	client := &http.Client{Timeout: time.Minute}
+	queue := append([]string(nil), roots...)
+	seen := map[string]bool{}
+	for len(queue) > 0 {
+		location := queue[0]
+		queue = queue[1:]
+		if seen[location] {
+			continue
+		}
+		seen[location] = true
+		u, err := url.Parse(location)
+		if err != nil {
+			log.Fatal(err)
+		}
+		data, err := fetch(client, u)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, m := range schemaLocation.FindAllSubmatch(data, -1) {
+			ref, err := u.Parse(string(m[1]))
+			if err != nil {
+				log.Fatalf("%s: %v", location, err)
+			}
+			queue = append(queue, ref.String())
+		}
+	}
+}
+
+// fetch returns the stored copy of the schema, downloading it first when it is missing.
+func fetch(client *http.Client, u *url.URL) ([]byte, error) {
+	name := filepath.Join("schemas", u.Host, filepath.FromSlash(u.Path))
+	if data, err := os.ReadFile(name); err == nil {
+		return data, nil
+	}
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", u, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return nil, err
+	}
+	log.Printf("%s -> %s", u, name)
+	return data, os.WriteFile(name, data, 0o644)
+}
@@ -0,0 +1,120 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// InvoiceChange is one field of an invoice changed by an edit, with the values as shown to the user.
+type InvoiceChange struct {
+	ChangedAt  time.Time
+	Uzytkownik string
+	Pole       string
+	Przed      string
+	Po         string
+}
+
+// History returns the changes of the invoice, the latest first.
+func (m *InvoiceModel) History(id int, company_nip string) ([]*InvoiceChange, error) {
+	stmt := `SELECT h.changed_at, COALESCE(u.name, ''), h.pole, h.przed, h.po FROM InvoiceHistory h
+	JOIN Invoices i ON i.id = h.invoice_id LEFT JOIN Users u ON u.id = h.user_id
+	WHERE h.invoice_id = @p1 AND i.company_nip = @p2 ORDER BY h.changed_at DESC, h.id`
+	rows, err := m.DB.Query(stmt, id, company_nip)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	zmiany := []*InvoiceChange{}
+	for rows.Next() {
+		z := &InvoiceChange{}
+		err := rows.Scan(&z.ChangedAt, &z.Uzytkownik, &z.Pole, &z.Przed, &z.Po)
+		if err != nil {
+			return nil, err
+		}
+		zmiany = append(zmiany, z)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return zmiany, nil
+}
+
+// diffInvoices lists the fields that differ between the stored invoice and its edited version.
+func diffInvoices(old *Invoice, oldNazwa string, inv *Invoice, nazwa string) []InvoiceChange {
+	var zmiany []InvoiceChange
+	add := func(pole, przed, po string) {
+		if przed != po {
+			zmiany = append(zmiany, InvoiceChange{Pole: pole, Przed: przed, Po: po})
+		}
+	}
+	add("Nr faktury", old.Nr_faktury, inv.Nr_faktury)
+	add("NIP", old.NumerVat(), inv.NumerVat())
+	add("Nazwa firmy", oldNazwa, nazwa)
+	add("Data", old.Data.Format("2006-01-02"), inv.Data.Format("2006-01-02"))
+	add("Data sprzedaży", formatDate(old.DataSprzedazy), formatDate(inv.DataSprzedazy))
+	add("Data wpływu", formatDate(old.DataWplywu), formatDate(inv.DataWplywu))
+	add("Okres", old.Okres.Format("2006-01"), inv.Okres.Format("2006-01"))
+	add("Termin płatności", formatDate(old.TerminPlatnosci), formatDate(inv.TerminPlatnosci))
+	add("Sposób płatności", old.SposobPlatnosci.Label(), inv.SposobPlatnosci.Label())
+	add("Rachunek bankowy", old.NrRachunku, inv.NrRachunku)
+	add("Typ faktury", string(old.Inv_type), string(inv.Inv_type))
+	add("Rodzaj dokumentu", string(old.Dokument), string(inv.Dokument))
+	add("Transakcja", string(old.Transakcja), string(inv.Transakcja))
+	add("Przyczyna korekty", old.PrzyczynaKorekty, inv.PrzyczynaKorekty)
+	add("Błąd faktury pierwotnej", yesNo(old.BladPierwotny), yesNo(inv.BladPierwotny))
+	add("Odliczenie", describeDeduction(old), describeDeduction(inv))
+	add("Waluta", old.Waluta, inv.Waluta)
+	add("Kurs", describeRate(old), describeRate(inv))
+	add("Pozycje", describeLines(old.Pozycje), describeLines(inv.Pozycje))
+	add("Oznaczenia", describeMarkers(old.Oznaczenia), describeMarkers(inv.Oznaczenia))
+	add("Netto", old.Netto.String(), inv.Netto.String())
+	add("Podatek", old.Podatek.String(), inv.Podatek.String())
+	return zmiany
+}
+
+func describeDeduction(inv *Invoice) string {
+	if inv.Odliczenie == OdliczenieProporcja {
+		return fmt.Sprintf("%s (%d%%)", inv.Odliczenie.Label(), inv.Proporcja)
+	}
+	return inv.Odliczenie.Label()
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "tak"
+	}
+	return "nie"
+}
+
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("2006-01-02")
+}
+
+func describeRate(inv *Invoice) string {
+	if !inv.Foreign() {
+		return ""
+	}
+	return fmt.Sprintf("%s z %s (%s)", inv.Kurs, inv.KursData.Format("2006-01-02"), inv.TabelaNbp)
+}
+
+func describeLines(lines []InvoiceLine) string {
+	opisy := make([]string, len(lines))
+	for i, l := range lines {
+		opisy[i] = fmt.Sprintf("%s %g %s x %s (%s)", l.Opis, l.Ilosc, l.Jednostka, l.CenaNetto, l.Stawka.Label())
+	}
+	return strings.Join(opisy, "; ")
+}
+
+func describeMarkers(oznaczenia []Marker) string {
+	kody := make([]string, len(oznaczenia))
+	for i, o := range oznaczenia {
+		kody[i] = string(o)
+	}
+	slices.Sort(kody)
+	return strings.Join(kody, ", ")
+}
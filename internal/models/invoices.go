@@ -3,6 +3,7 @@ package models
 import (
 	"database/sql"
 	"errors"
+	"slices"
 	"time"
 )
 
@@ -10,11 +11,60 @@ type Invoice struct {
 	Id         int
 	Nr_faktury string
 	Nip        string
-	Netto      float64
-	Podatek    float64
-	Data       time.Time
-	Inv_type   InvoiceType
-	Company    string
+	// KodKraju is the country of the contractor's tax number, taken from the registry
+	KodKraju string
+	// Netto, Podatek and Kwoty are in zloty. An invoice in another currency keeps its own amounts in
+	// NettoWaluta and PodatekWaluta and on the lines.
+	Netto         Money
+	Podatek       Money
+	Waluta        string
+	Kurs          Kurs
+	KursData      time.Time
+	TabelaNbp     string
+	NettoWaluta   Money
+	PodatekWaluta Money
+	// Data is the issue date. DataSprzedazy is the delivery date when it is given, DataWplywu the day a
+	// purchase document was received. Okres is the first day of the month the invoice is reported in.
+	Data          time.Time
+	DataSprzedazy time.Time
+	DataWplywu    time.Time
+	Okres         time.Time
+	// TerminPlatnosci is the payment due date, if the invoice gives one. SposobPlatnosci and NrRachunku
+	// are the payment terms: on a sale the account of the company, on a purchase the account of the
+	// supplier. Zaplacono is the sum of the payments in the invoice currency, loaded by Get and GetAll.
+	TerminPlatnosci time.Time
+	SposobPlatnosci PaymentMethod
+	NrRachunku      string
+	Zaplacono       Money
+	// KorektaDo is the id of the invoice a correction corrects, zero for an original invoice. The lines
+	// of a correction hold the differences, so its amounts may be negative. BladPierwotny marks a
+	// correction raising the value because of an error made on the original invoice.
+	KorektaDo        int
+	PrzyczynaKorekty string
+	BladPierwotny    bool
+	// OryginalNr and OryginalData identify the corrected invoice, Korekty lists the corrections of an
+	// original one. Both are loaded by Get.
+	OryginalNr     string
+	OryginalData   time.Time
+	Korekty        []*Invoice
+	okresOryginalu time.Time
+	// Odliczenie is how much of the VAT on a purchase is deducted, Proporcja the company proportion in
+	// percent when the proportion applies.
+	Odliczenie DeductionType
+	Proporcja  int
+	// zlyDlug marks a bad-debt correction row built by ForPeriod, dataZaplaty the payment reversing the
+	// relief
+	zlyDlug     bool
+	dataZaplaty time.Time
+	Inv_type    InvoiceType
+	Dokument    DocumentType
+	Transakcja  TransactionType
+	Company     string
+	Kwoty       []RateAmount
+	Pozycje     []InvoiceLine
+	Oznaczenia  []Marker
+	// MppAuto is set when the MPP marker was added because the split payment is mandatory, not by the user
+	MppAuto bool
 }
 
 type InvoiceModel struct {
@@ -28,23 +78,747 @@ const (
 	PurchaseInvoice InvoiceType = "PURC"
 )
 
-func (m *InvoiceModel) Insert(nip string, nr_faktury string, netto float64, podatek float64, data time.Time, inv_type InvoiceType, nazwa string, company_nip string) (int, error) {
-	stmt := "INSERT INTO Invoices (nip, nr_faktury, netto, podatek, data, type) OUTPUT Inserted.id VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7)"
-	m.DB.Exec("INSERT INTO Companies VALUES (@p1, @p2, 'PL')", nip, nazwa)
+// DocumentType is the kind of document behind a register row. Anything other than an ordinary VAT invoice is
+// reported as TypDokumentu of a sale or DokumentZakupu of a purchase.
+type DocumentType string
+
+const (
+	DocFaktura DocumentType = "VAT"
+	DocRO      DocumentType = "RO"
+	DocWEW     DocumentType = "WEW"
+	DocFP      DocumentType = "FP"
+	DocVATRR   DocumentType = "VAT_RR"
+	DocMK      DocumentType = "MK"
+)
+
+// DocumentTypes lists every document type in the order they are shown on forms.
+var DocumentTypes = []DocumentType{DocFaktura, DocRO, DocWEW, DocFP, DocVATRR, DocMK}
+
+func (d DocumentType) Label() string {
+	switch d {
+	case DocRO:
+		return "Raport z kasy fiskalnej (RO)"
+	case DocWEW:
+		return "Dokument wewnętrzny (WEW)"
+	case DocFP:
+		return "Faktura do paragonu (FP)"
+	case DocVATRR:
+		return "Faktura VAT RR"
+	case DocMK:
+		return "Faktura MK (dostawca rozlicza się metodą kasową)"
+	}
+	return "Faktura VAT"
+}
+
+// jpkCode is the value of TypDokumentu or DokumentZakupu, empty for an ordinary invoice.
+func (d DocumentType) jpkCode() string {
+	if d == DocFaktura {
+		return ""
+	}
+	return string(d)
+}
+
+// Payable reports whether the document is settled by payments tracked against it. Cash register reports
+// and receipt invoices are paid at the sale, internal documents are not paid at all.
+func (d DocumentType) Payable() bool {
+	return d == DocFaktura || d == DocMK || d == DocVATRR
+}
+
+// RequiresContractor reports whether the document has to name the contractor by NIP. Cash register
+// reports, internal documents, receipt invoices and RR invoices are often issued to persons without one.
+func (d DocumentType) RequiresContractor() bool {
+	return d == DocFaktura || d == DocMK
+}
+
+// Documents returns the document types allowed for the invoice type.
+func (t InvoiceType) Documents() []DocumentType {
+	if t == PurchaseInvoice {
+		return []DocumentType{DocFaktura, DocMK, DocVATRR, DocWEW}
+	}
+	return []DocumentType{DocFaktura, DocRO, DocWEW, DocFP}
+}
+
+// TransactionType tells a domestic invoice from the intra-community and reverse-charge ones, which are
+// reported in their own K_ columns. For the self-assessed purchases the lines carry the Polish rate and
+// Podatek is the tax the buyer accounts for.
+type TransactionType string
+
+const (
+	TxKrajowa            TransactionType = "KRAJ"
+	TxWDT                TransactionType = "WDT"
+	TxWNT                TransactionType = "WNT"
+	TxImportUslug        TransactionType = "IMPORT_USLUG"
+	TxImportUslug28b     TransactionType = "IMPORT_USLUG_28B"
+	TxOdwrotneObciazenie TransactionType = "OO"
+)
+
+// TransactionTypes lists every transaction type in the order they are shown on forms.
+var TransactionTypes = []TransactionType{TxKrajowa, TxWDT, TxWNT, TxImportUslug28b, TxImportUslug, TxOdwrotneObciazenie}
+
+func (t TransactionType) Label() string {
+	switch t {
+	case TxWDT:
+		return "Wewnątrzwspólnotowa dostawa towarów (WDT)"
+	case TxWNT:
+		return "Wewnątrzwspólnotowe nabycie towarów (WNT)"
+	case TxImportUslug28b:
+		return "Import usług z art. 28b"
+	case TxImportUslug:
+		return "Import usług pozostały"
+	case TxOdwrotneObciazenie:
+		return "Odwrotne obciążenie krajowe"
+	}
+	return "Krajowa"
+}
+
+// SelfAssessed reports whether the buyer accounts for the tax, reporting it both as due and as input tax.
+func (t TransactionType) SelfAssessed() bool {
+	return t == TxWNT || t == TxImportUslug || t == TxImportUslug28b || t == TxOdwrotneObciazenie
+}
+
+// Transactions returns the transaction types allowed for the invoice type.
+func (t InvoiceType) Transactions() []TransactionType {
+	if t == PurchaseInvoice {
+		return []TransactionType{TxKrajowa, TxWNT, TxImportUslug28b, TxImportUslug, TxOdwrotneObciazenie}
+	}
+	return []TransactionType{TxKrajowa, TxWDT}
+}
+
+// DeductionType is the part of the VAT on a purchase the company may deduct.
+type DeductionType string
+
+const (
+	OdliczeniePelne     DeductionType = "100"
+	OdliczeniePojazd    DeductionType = "50"
+	OdliczenieProporcja DeductionType = "WSP"
+	OdliczenieBrak      DeductionType = "0"
+)
+
+// DeductionTypes lists every deduction in the order they are shown on forms.
+var DeductionTypes = []DeductionType{OdliczeniePelne, OdliczeniePojazd, OdliczenieProporcja, OdliczenieBrak}
+
+func (d DeductionType) Label() string {
+	switch d {
+	case OdliczeniePojazd:
+		return "50% - samochód osobowy używany także prywatnie"
+	case OdliczenieProporcja:
+		return "Według proporcji (sprzedaż opodatkowana i zwolniona)"
+	case OdliczenieBrak:
+		return "Brak odliczenia"
+	}
+	return "Pełne odliczenie"
+}
+
+type VatRate string
+
+const (
+	Rate23 VatRate = "23"
+	Rate8  VatRate = "8"
+	Rate5  VatRate = "5"
+	Rate0  VatRate = "0"
+	RateZw VatRate = "zw"
+	RateNp VatRate = "np"
+)
+
+// VatRates lists the supported rates in the order they are shown on forms.
+var VatRates = []VatRate{Rate23, Rate8, Rate5, Rate0, RateZw, RateNp}
+
+// Taxed reports whether the rate carries a VAT amount. 0%, zw and np only have a net value.
+func (r VatRate) Taxed() bool {
+	return r == Rate23 || r == Rate8 || r == Rate5
+}
+
+func (r VatRate) Label() string {
+	if r == RateZw || r == RateNp {
+		return string(r)
+	}
+	return string(r) + "%"
+}
+
+// Percent returns the rate used to compute the VAT amount, zero for untaxed rates.
+func (r VatRate) Percent() int64 {
+	switch r {
+	case Rate23:
+		return 23
+	case Rate8:
+		return 8
+	case Rate5:
+		return 5
+	}
+	return 0
+}
+
+// Marker is a GTU code or a procedure marking reported on the invoice row of the JPK.
+type Marker string
+
+// SaleMarkers lists the markings of a sale row in the order of the JPK columns.
+var SaleMarkers = []Marker{
+	"GTU_01", "GTU_02", "GTU_03", "GTU_04", "GTU_05", "GTU_06", "GTU_07", "GTU_08", "GTU_09", "GTU_10", "GTU_11", "GTU_12", "GTU_13",
+	"WSTO_EE", "IED", "TP", "TT_WNT", "TT_D", "MR_T", "MR_UZ", "I_42", "I_63", "B_SPV", "B_SPV_DOSTAWA", "B_MPV_PROWIZJA", "MPP",
+}
+
+// PurchaseMarkers lists the markings of a purchase row.
+var PurchaseMarkers = []Marker{"MPP", "IMP"}
+
+// mppMarkers are the GTU codes of the goods of annex 15 to the VAT act: fuels, waste, electronics, car
+// parts and metals. The construction services of the annex have no GTU code and are marked by hand.
+var mppMarkers = []Marker{"GTU_02", "GTU_05", "GTU_06", "GTU_07", "GTU_08"}
+
+// ProgMPP is the gross amount above which an invoice for goods of annex 15 has to be paid by split payment.
+const ProgMPP Money = 1500000
+
+// WymagaMPP reports whether the split payment is mandatory for the invoice: a domestic VAT sale invoice to
+// a taxpayer, over 15 000 zł gross, with goods of annex 15 recognised by their GTU code. Purchases carry no
+// GTU codes, the supplier's MPP marking is copied by hand.
+func (inv Invoice) WymagaMPP() bool {
+	if inv.Inv_type != SaleInvoice || inv.Dokument != DocFaktura || inv.Transakcja != TxKrajowa || inv.Nip == "" || inv.KorektaDo != 0 {
+		return false
+	}
+	if inv.Brutto() <= ProgMPP {
+		return false
+	}
+	for _, o := range inv.Oznaczenia {
+		if slices.Contains(mppMarkers, o) {
+			return true
+		}
+	}
+	return false
+}
+
+// markMPP adds the MPP marker to an invoice the split payment is mandatory for. A correction is marked
+// like the invoice it corrects. A marker added here is taken away again when an edit makes the split
+// payment optional, a marker set by the user is kept. MppAuto holds the state of the stored invoice on
+// entry.
+func (inv *Invoice) markMPP(orig *Invoice) {
+	mpp := inv.WymagaMPP()
+	if orig != nil {
+		mpp = slices.Contains(orig.Oznaczenia, "MPP")
+	}
+	i := slices.Index(inv.Oznaczenia, "MPP")
+	switch {
+	case i < 0 && mpp:
+		inv.Oznaczenia = append(inv.Oznaczenia, "MPP")
+		inv.MppAuto = true
+	case i < 0:
+		inv.MppAuto = false
+	case !mpp && inv.MppAuto:
+		inv.Oznaczenia = slices.Delete(slices.Clone(inv.Oznaczenia), i, i+1)
+		inv.MppAuto = false
+	}
+}
+
+var markerLabels = map[Marker]string{
+	"GTU_01":         "Napoje alkoholowe",
+	"GTU_02":         "Paliwa",
+	"GTU_03":         "Oleje opałowe i smarowe",
+	"GTU_04":         "Wyroby tytoniowe",
+	"GTU_05":         "Odpady",
+	"GTU_06":         "Urządzenia elektroniczne",
+	"GTU_07":         "Pojazdy i części",
+	"GTU_08":         "Metale szlachetne i nieszlachetne",
+	"GTU_09":         "Leki i wyroby medyczne",
+	"GTU_10":         "Budynki, budowle i grunty",
+	"GTU_11":         "Uprawnienia do emisji gazów",
+	"GTU_12":         "Usługi niematerialne",
+	"GTU_13":         "Usługi transportowe i magazynowe",
+	"WSTO_EE":        "Sprzedaż wysyłkowa / usługi TBE w UE",
+	"IED":            "Dostawa przez interfejs elektroniczny",
+	"TP":             "Powiązania między nabywcą a dostawcą",
+	"TT_WNT":         "WNT w procedurze trójstronnej",
+	"TT_D":           "Dostawa w procedurze trójstronnej",
+	"MR_T":           "Procedura marży - usługi turystyki",
+	"MR_UZ":          "Procedura marży - towary używane",
+	"I_42":           "Procedura celna 42",
+	"I_63":           "Procedura celna 63",
+	"B_SPV":          "Transfer bonu jednego przeznaczenia",
+	"B_SPV_DOSTAWA":  "Dostawa w zamian za bon jednego przeznaczenia",
+	"B_MPV_PROWIZJA": "Pośrednictwo przy bonie różnego przeznaczenia",
+	"MPP":            "Mechanizm podzielonej płatności",
+	"IMP":            "Import towarów",
+}
+
+func (m Marker) Label() string {
+	return markerLabels[m]
+}
+
+// Markers returns the markings allowed for the invoice type.
+func (t InvoiceType) Markers() []Marker {
+	if t == PurchaseInvoice {
+		return PurchaseMarkers
+	}
+	return SaleMarkers
+}
+
+// HasMarker reports whether the invoice carries the marking.
+func (inv Invoice) HasMarker(kod Marker) bool {
+	for _, o := range inv.Oznaczenia {
+		if o == kod {
+			return true
+		}
+	}
+	return false
+}
+
+// Foreign reports whether the invoice is issued in a currency other than zloty.
+func (inv Invoice) Foreign() bool {
+	return inv.Waluta != "" && inv.Waluta != PLN
+}
+
+// NumerVat is the contractor's tax number as entered, with the country prefix when it is not Polish.
+func (inv Invoice) NumerVat() string {
+	if inv.KodKraju == "" || inv.KodKraju == "PL" {
+		return inv.Nip
+	}
+	return inv.KodKraju + inv.Nip
+}
+
+// RateAmount is the net and VAT value of an invoice at a single VAT rate.
+type RateAmount struct {
+	Stawka  VatRate
+	Netto   Money
+	Podatek Money
+}
+
+// InvoiceLine is a single position of an invoice. Netto, Podatek and Brutto are computed from the
+// quantity, unit price and rate by Compute.
+type InvoiceLine struct {
+	Id        int
+	Lp        int
+	Opis      string
+	Ilosc     float64
+	Jednostka string
+	CenaNetto Money
+	Stawka    VatRate
+	Netto     Money
+	Podatek   Money
+	Brutto    Money
+}
+
+func (l *InvoiceLine) Compute() error {
+	netto, err := l.CenaNetto.MulQty(l.Ilosc)
+	if err != nil {
+		l.Netto, l.Podatek, l.Brutto = 0, 0, 0
+		return err
+	}
+	l.Netto = netto
+	l.Podatek = l.Netto.Percent(l.Stawka.Percent())
+	l.Brutto = l.Netto + l.Podatek
+	return nil
+}
+
+// InRange reports whether the quantity, the unit price and the value of the line are within the limits.
+func (l InvoiceLine) InRange() bool {
+	_, err := l.CenaNetto.MulQty(l.Ilosc)
+	return err == nil
+}
+
+// SumLines totals the lines per VAT rate, in the order of VatRates.
+func SumLines(lines []InvoiceLine) []RateAmount {
+	var kwoty []RateAmount
+	for _, stawka := range VatRates {
+		k := RateAmount{Stawka: stawka}
+		found := false
+		for _, l := range lines {
+			if l.Stawka == stawka {
+				k.Netto += l.Netto
+				k.Podatek += l.Podatek
+				found = true
+			}
+		}
+		if found {
+			kwoty = append(kwoty, k)
+		}
+	}
+	return kwoty
+}
+
+// Insert stores the invoice with its lines. The per-rate amounts and the totals are derived from the lines.
+func (m *InvoiceModel) Insert(inv *Invoice, nazwa string, company_nip string) (int, error) {
+	err := m.prepare(inv, company_nip)
+	if err != nil {
+		return 0, err
+	}
+	locked, err := periodLocked(m.DB, company_nip, inv.Okres)
+	if err != nil {
+		return 0, err
+	}
+	if locked {
+		return 0, ErrPeriodLocked
+	}
+	stmt := `INSERT INTO Invoices (nip, nr_faktury, netto, podatek, data, type, company_nip, doc_type, waluta, kurs, kurs_data, tabela_nbp, netto_waluta, podatek_waluta, transakcja,
+	data_sprzedazy, data_wplywu, okres, korekta_do, przyczyna_korekty, blad_pierwotny, odliczenie, proporcja, termin_platnosci, sposob_platnosci, nr_rachunku, mpp_auto)
+	OUTPUT Inserted.id VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8, @p9, @p10, @p11, @p12, @p13, @p14, @p15, @p16, @p17, @p18, @p19, @p20, @p21, @p22, @p23, @p24, @p25, @p26, @p27)`
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	if inv.Nip != "" {
+		err = saveContractor(tx, company_nip, inv.KodKraju, inv.Nip, nazwa)
+		if err != nil {
+			return 0, err
+		}
+	}
 	var resId int
-	err := m.DB.QueryRow(stmt, nip, nr_faktury, netto, podatek, data, inv_type, company_nip).Scan(&resId)
+	err = tx.QueryRow(stmt, inv.Nip, inv.Nr_faktury, inv.Netto, inv.Podatek, inv.Data, inv.Inv_type, company_nip, inv.Dokument,
+		inv.Waluta, inv.Kurs, nullDate(inv.KursData), inv.TabelaNbp, inv.NettoWaluta, inv.PodatekWaluta, inv.Transakcja,
+		nullDate(inv.DataSprzedazy), nullDate(inv.DataWplywu), inv.Okres, nullId(inv.KorektaDo), inv.PrzyczynaKorekty, inv.BladPierwotny,
+		inv.Odliczenie, inv.Proporcja, nullDate(inv.TerminPlatnosci), inv.SposobPlatnosci, inv.NrRachunku, inv.MppAuto).Scan(&resId)
+	if err != nil {
+		return 0, err
+	}
+	err = insertDetails(tx, resId, inv)
 	if err != nil {
 		return 0, err
 	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
 	return resId, nil
 }
 
+// Update replaces the invoice with the edited one and records every changed field in the history under
+// the user making the change.
+func (m *InvoiceModel) Update(inv *Invoice, nazwa string, company_nip string, userId int) error {
+	old, oldNazwa, err := m.Get(inv.Id, company_nip)
+	if err != nil {
+		return err
+	}
+	inv.KorektaDo = old.KorektaDo
+	inv.MppAuto = old.MppAuto
+	err = m.prepare(inv, company_nip)
+	if err != nil {
+		return err
+	}
+	for _, okres := range []time.Time{old.Okres, inv.Okres} {
+		locked, err := periodLocked(m.DB, company_nip, okres)
+		if err != nil {
+			return err
+		}
+		if locked {
+			return ErrPeriodLocked
+		}
+	}
+	// the invoice shows the name from the registry, a different name typed in the form does not change it
+	if inv.Nip != "" {
+		zapisani, err := contractorsByNip(m.DB, company_nip, []string{inv.Nip})
+		if err != nil {
+			return err
+		}
+		if c, ok := zapisani[inv.Nip]; ok {
+			nazwa = c.Nazwa
+		}
+	}
+	zmiany := diffInvoices(old, oldNazwa, inv, nazwa)
+	if len(zmiany) == 0 {
+		return nil
+	}
+	stmt := `UPDATE Invoices SET nip = @p1, nr_faktury = @p2, netto = @p3, podatek = @p4, data = @p5, type = @p6, doc_type = @p7,
+	waluta = @p8, kurs = @p9, kurs_data = @p10, tabela_nbp = @p11, netto_waluta = @p12, podatek_waluta = @p13, transakcja = @p14,
+	data_sprzedazy = @p15, data_wplywu = @p16, okres = @p17, przyczyna_korekty = @p18, blad_pierwotny = @p19,
+	odliczenie = @p20, proporcja = @p21, termin_platnosci = @p22, sposob_platnosci = @p23, nr_rachunku = @p24, mpp_auto = @p25
+	WHERE id = @p26 AND company_nip = @p27`
+	hStmt := "INSERT INTO InvoiceHistory (invoice_id, user_id, changed_at, pole, przed, po) VALUES (@p1, @p2, @p3, @p4, @p5, @p6)"
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if inv.Nip != "" {
+		err = saveContractor(tx, company_nip, inv.KodKraju, inv.Nip, nazwa)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(stmt, inv.Nip, inv.Nr_faktury, inv.Netto, inv.Podatek, inv.Data, inv.Inv_type, inv.Dokument,
+		inv.Waluta, inv.Kurs, nullDate(inv.KursData), inv.TabelaNbp, inv.NettoWaluta, inv.PodatekWaluta, inv.Transakcja,
+		nullDate(inv.DataSprzedazy), nullDate(inv.DataWplywu), inv.Okres, inv.PrzyczynaKorekty, inv.BladPierwotny,
+		inv.Odliczenie, inv.Proporcja, nullDate(inv.TerminPlatnosci), inv.SposobPlatnosci, inv.NrRachunku, inv.MppAuto, inv.Id, company_nip)
+	if err != nil {
+		return err
+	}
+	for _, del := range []string{
+		"DELETE FROM InvoiceRates WHERE invoice_id = @p1",
+		"DELETE FROM InvoiceLines WHERE invoice_id = @p1",
+		"DELETE FROM InvoiceMarkers WHERE invoice_id = @p1",
+	} {
+		_, err = tx.Exec(del, inv.Id)
+		if err != nil {
+			return err
+		}
+	}
+	err = insertDetails(tx, inv.Id, inv)
+	if err != nil {
+		return err
+	}
+	changedAt := time.Now()
+	for _, z := range zmiany {
+		_, err = tx.Exec(hStmt, inv.Id, userId, changedAt, z.Pole, z.Przed, z.Po)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// prepare derives what is stored with the invoice but not entered on the form: the data taken over from a
+// corrected invoice, the exchange rate, the totals and the settlement month.
+func (m *InvoiceModel) prepare(inv *Invoice, company_nip string) error {
+	var orig *Invoice
+	if inv.KorektaDo != 0 {
+		var err error
+		orig, _, err = m.Get(inv.KorektaDo, company_nip)
+		if err != nil {
+			return err
+		}
+		if !orig.Correctable() {
+			return ErrNotCorrectable
+		}
+		inv.correct(orig)
+	} else {
+		err := applyRate(m.DB, inv)
+		if err != nil {
+			return err
+		}
+		err = inv.applyDeduction(m.DB, company_nip)
+		if err != nil {
+			return err
+		}
+	}
+	err := inv.computeTotals()
+	if err != nil {
+		return err
+	}
+	inv.markMPP(orig)
+	inv.setOkres()
+	return nil
+}
+
+// Correctable reports whether a correction can be issued against the invoice. Corrections are linked to
+// the original invoice, never to another correction, and cash register reports and internal documents
+// are not corrected by invoices.
+func (inv Invoice) Correctable() bool {
+	return inv.KorektaDo == 0 && inv.Dokument != DocRO && inv.Dokument != DocWEW
+}
+
+// correct takes over the contractor, the kind of invoice and the currency of the corrected invoice. A
+// correction is converted at the rate of the invoice it corrects.
+func (inv *Invoice) correct(orig *Invoice) {
+	inv.Nip, inv.KodKraju = orig.Nip, orig.KodKraju
+	inv.Inv_type, inv.Dokument, inv.Transakcja = orig.Inv_type, orig.Dokument, orig.Transakcja
+	inv.Waluta, inv.Kurs, inv.KursData, inv.TabelaNbp = orig.Waluta, orig.Kurs, orig.KursData, orig.TabelaNbp
+	inv.OryginalNr, inv.OryginalData = orig.Nr_faktury, orig.Data
+	inv.okresOryginalu = orig.Okres
+	inv.Odliczenie, inv.Proporcja = orig.Odliczenie, orig.Proporcja
+}
+
+// applyDeduction records the company proportion on a purchase deducted by it. The proportion is kept with
+// the invoice, so a later change of the company setting does not alter reported periods. A sale has
+// nothing to deduct.
+func (inv *Invoice) applyDeduction(q querier, company_nip string) error {
+	inv.Proporcja = 0
+	if inv.Inv_type != PurchaseInvoice || inv.Odliczenie == "" {
+		inv.Odliczenie = OdliczeniePelne
+		return nil
+	}
+	if inv.Odliczenie != OdliczenieProporcja {
+		return nil
+	}
+	var err error
+	inv.Proporcja, err = companyProporcja(q, company_nip)
+	return err
+}
+
+// deductedPercent is the part of the VAT on a purchase that is deducted.
+func (inv Invoice) deductedPercent() int64 {
+	switch inv.Odliczenie {
+	case OdliczeniePojazd:
+		return 50
+	case OdliczenieProporcja:
+		return int64(inv.Proporcja)
+	case OdliczenieBrak:
+		return 0
+	}
+	return 100
+}
+
+// NettoDoOdliczenia and PodatekDoOdliczenia are the part of a purchase reported in the purchase register.
+func (inv Invoice) NettoDoOdliczenia() Money {
+	return inv.Netto.Percent(inv.deductedPercent())
+}
+
+func (inv Invoice) PodatekDoOdliczenia() Money {
+	return inv.Podatek.Percent(inv.deductedPercent())
+}
+
+// PodatekNieodliczony is the VAT on a purchase that is not deducted and becomes a cost.
+func (inv Invoice) PodatekNieodliczony() Money {
+	return inv.Podatek - inv.PodatekDoOdliczenia()
+}
+
+// computeTotals derives the line values, the per-rate amounts and the totals from the lines. The lines
+// are in the invoice currency, the per-rate amounts are converted to zloty rate by rate.
+func (inv *Invoice) computeTotals() error {
+	for i := range inv.Pozycje {
+		if err := inv.Pozycje[i].Compute(); err != nil {
+			return err
+		}
+	}
+	inv.Kwoty = SumLines(inv.Pozycje)
+	inv.Netto, inv.Podatek = 0, 0
+	inv.NettoWaluta, inv.PodatekWaluta = 0, 0
+	for i := range inv.Kwoty {
+		k := &inv.Kwoty[i]
+		inv.NettoWaluta += k.Netto
+		inv.PodatekWaluta += k.Podatek
+		if inv.Foreign() {
+			k.Netto, k.Podatek = k.Netto.Convert(inv.Kurs), k.Podatek.Convert(inv.Kurs)
+		}
+		inv.Netto += k.Netto
+		inv.Podatek += k.Podatek
+	}
+	return nil
+}
+
+// TaxPoint is the day the tax on a sale becomes due: the delivery date, or the issue date when the
+// invoice does not give one.
+func (inv Invoice) TaxPoint() time.Time {
+	if inv.DataSprzedazy.IsZero() {
+		return inv.Data
+	}
+	return inv.DataSprzedazy
+}
+
+// Received is the day a purchase document was received, the issue date when it was not recorded.
+func (inv Invoice) Received() time.Time {
+	if inv.DataWplywu.IsZero() || inv.DataWplywu.Before(inv.Data) {
+		return inv.Data
+	}
+	return inv.DataWplywu
+}
+
+// DeductionPeriods returns the months the input tax of a purchase may be deducted in: the month the
+// document was received and the three following ones.
+func (inv Invoice) DeductionPeriods() []time.Time {
+	first := monthOf(inv.Received())
+	return []time.Time{first, first.AddDate(0, 1, 0), first.AddDate(0, 2, 0), first.AddDate(0, 3, 0)}
+}
+
+// DefaultOkres is the month a sale is reported in by its tax point and a purchase by its receipt.
+func (inv Invoice) DefaultOkres() time.Time {
+	if inv.Inv_type == PurchaseInvoice {
+		return monthOf(inv.Received())
+	}
+	return monthOf(inv.TaxPoint())
+}
+
+// RateDay is the day the exchange rate is taken before: the tax point, or the issue date when the invoice
+// was issued before it.
+func (inv Invoice) RateDay() time.Time {
+	if inv.DataSprzedazy.IsZero() || inv.Data.Before(inv.DataSprzedazy) {
+		return inv.Data
+	}
+	return inv.DataSprzedazy
+}
+
+// setOkres assigns a sale to the month of its tax point. A purchase keeps the deduction month chosen for
+// it and falls back to the month it was received.
+//
+// A sale correction is reported in the month it is issued, except one raising the value because of an
+// error on the original invoice, which goes back to the period of the original. A purchase correction
+// lowering the input tax is reported in the month it is received.
+func (inv *Invoice) setOkres() {
+	switch {
+	case inv.KorektaDo != 0 && inv.Inv_type == SaleInvoice:
+		if inv.BladPierwotny && inv.Brutto() > 0 {
+			inv.Okres = inv.okresOryginalu
+		} else {
+			inv.Okres = monthOf(inv.Data)
+		}
+		return
+	case inv.KorektaDo != 0 && inv.Brutto() < 0:
+		inv.Okres = monthOf(inv.Received())
+		return
+	}
+	if inv.Inv_type == PurchaseInvoice && !inv.Okres.IsZero() {
+		inv.Okres = monthOf(inv.Okres)
+		return
+	}
+	inv.Okres = inv.DefaultOkres()
+}
+
+func monthOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// applyRate sets the NBP rate of the business day before the tax point on a foreign currency invoice.
+func applyRate(q querier, inv *Invoice) error {
+	inv.Kurs, inv.KursData, inv.TabelaNbp = 0, time.Time{}, ""
+	if !inv.Foreign() {
+		inv.Waluta = PLN
+		return nil
+	}
+	r, err := rateBefore(q, inv.Waluta, inv.RateDay())
+	if err != nil {
+		return err
+	}
+	inv.Kurs, inv.KursData, inv.TabelaNbp = r.Kurs, r.Data, r.Tabela
+	return nil
+}
+
+func nullDate(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+func nullId(id int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
+
+// insertDetails writes the per-rate amounts, lines and markings of the invoice.
+func insertDetails(tx *sql.Tx, id int, inv *Invoice) error {
+	rStmt := "INSERT INTO InvoiceRates (invoice_id, stawka, netto, podatek) VALUES (@p1, @p2, @p3, @p4)"
+	lStmt := "INSERT INTO InvoiceLines (invoice_id, lp, opis, ilosc, jednostka, cena_netto, stawka, netto, podatek) VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8, @p9)"
+	oStmt := "INSERT INTO InvoiceMarkers (invoice_id, kod) VALUES (@p1, @p2)"
+	for _, k := range inv.Kwoty {
+		_, err := tx.Exec(rStmt, id, k.Stawka, k.Netto, k.Podatek)
+		if err != nil {
+			return err
+		}
+	}
+	for i := range inv.Pozycje {
+		l := &inv.Pozycje[i]
+		l.Lp = i + 1
+		_, err := tx.Exec(lStmt, id, l.Lp, l.Opis, l.Ilosc, l.Jednostka, l.CenaNetto, l.Stawka, l.Netto, l.Podatek)
+		if err != nil {
+			return err
+		}
+	}
+	for _, o := range inv.Oznaczenia {
+		_, err := tx.Exec(oStmt, id, o)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (m *InvoiceModel) Get(id int, company_nip string) (*Invoice, string, error) {
-	stmt := "SELECT id, nip, nr_faktury, netto, podatek, data, type FROM Invoices WHERE id = @p1 AND company_nip = @p2"
-	cStmt := "SELECT nazwa FROM Companies WHERE nip = @p1"
+	stmt := `SELECT id, nip, nr_faktury, netto, podatek, data, type, COALESCE(doc_type, 'VAT'), COALESCE(waluta, 'PLN'), kurs, kurs_data, COALESCE(tabela_nbp, ''), COALESCE(netto_waluta, netto), COALESCE(podatek_waluta, podatek), COALESCE(transakcja, 'KRAJ'),
+	data_sprzedazy, data_wplywu, COALESCE(okres, DATEFROMPARTS(YEAR(data), MONTH(data), 1)), korekta_do, COALESCE(przyczyna_korekty, ''), COALESCE(blad_pierwotny, 0), COALESCE(odliczenie, '100'), COALESCE(proporcja, 0),
+	termin_platnosci, COALESCE(sposob_platnosci, ''), COALESCE(nr_rachunku, ''), COALESCE(mpp_auto, 0),
+	COALESCE((SELECT SUM(p.kwota) FROM Payments p WHERE p.invoice_id = Invoices.id AND p.company_nip = Invoices.company_nip), 0)
+	FROM Invoices WHERE id = @p1 AND company_nip = @p2`
+	rStmt := "SELECT stawka, netto, podatek FROM InvoiceRates WHERE invoice_id = @p1"
+	lStmt := "SELECT id, lp, opis, ilosc, jednostka, cena_netto, stawka, netto, podatek FROM InvoiceLines WHERE invoice_id = @p1 ORDER BY lp"
+	oStmt := "SELECT kod FROM InvoiceMarkers WHERE invoice_id = @p1"
+	cStmt := "SELECT nazwa, kod_kraju FROM Companies WHERE company_nip = @p1 AND nip = @p2"
 	row := m.DB.QueryRow(stmt, id, company_nip)
 	inv := &Invoice{}
-	err := row.Scan(&inv.Id, &inv.Nip, &inv.Nr_faktury, &inv.Netto, &inv.Podatek, &inv.Data, &inv.Inv_type)
+	var kursData, dataSprzedazy, dataWplywu, terminPlatnosci sql.NullTime
+	var korektaDo sql.NullInt64
+	err := row.Scan(&inv.Id, &inv.Nip, &inv.Nr_faktury, &inv.Netto, &inv.Podatek, &inv.Data, &inv.Inv_type, &inv.Dokument, &inv.Waluta, &inv.Kurs, &kursData, &inv.TabelaNbp, &inv.NettoWaluta, &inv.PodatekWaluta, &inv.Transakcja,
+		&dataSprzedazy, &dataWplywu, &inv.Okres, &korektaDo, &inv.PrzyczynaKorekty, &inv.BladPierwotny, &inv.Odliczenie, &inv.Proporcja, &terminPlatnosci,
+		&inv.SposobPlatnosci, &inv.NrRachunku, &inv.MppAuto, &inv.Zaplacono)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, "", ErrNoRecord
@@ -52,9 +826,76 @@ func (m *InvoiceModel) Get(id int, company_nip string) (*Invoice, string, error)
 			return nil, "", err
 		}
 	}
-	cRow := m.DB.QueryRow(cStmt, inv.Nip)
+	inv.KursData = kursData.Time
+	inv.DataSprzedazy, inv.DataWplywu = dataSprzedazy.Time, dataWplywu.Time
+	inv.TerminPlatnosci = terminPlatnosci.Time
+	inv.KorektaDo = int(korektaDo.Int64)
+	rows, err := m.DB.Query(rStmt, inv.Id)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		k := RateAmount{}
+		err = rows.Scan(&k.Stawka, &k.Netto, &k.Podatek)
+		if err != nil {
+			return nil, "", err
+		}
+		inv.Kwoty = append(inv.Kwoty, k)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, "", err
+	}
+	lRows, err := m.DB.Query(lStmt, inv.Id)
+	if err != nil {
+		return nil, "", err
+	}
+	defer lRows.Close()
+	for lRows.Next() {
+		l := InvoiceLine{}
+		err = lRows.Scan(&l.Id, &l.Lp, &l.Opis, &l.Ilosc, &l.Jednostka, &l.CenaNetto, &l.Stawka, &l.Netto, &l.Podatek)
+		if err != nil {
+			return nil, "", err
+		}
+		l.Brutto = l.Netto + l.Podatek
+		inv.Pozycje = append(inv.Pozycje, l)
+	}
+	if err = lRows.Err(); err != nil {
+		return nil, "", err
+	}
+	oRows, err := m.DB.Query(oStmt, inv.Id)
+	if err != nil {
+		return nil, "", err
+	}
+	defer oRows.Close()
+	for oRows.Next() {
+		var o Marker
+		err = oRows.Scan(&o)
+		if err != nil {
+			return nil, "", err
+		}
+		inv.Oznaczenia = append(inv.Oznaczenia, o)
+	}
+	if err = oRows.Err(); err != nil {
+		return nil, "", err
+	}
+	if inv.KorektaDo != 0 {
+		err = m.DB.QueryRow("SELECT nr_faktury, data, COALESCE(okres, data) FROM Invoices WHERE id = @p1 AND company_nip = @p2", inv.KorektaDo, company_nip).Scan(&inv.OryginalNr, &inv.OryginalData, &inv.okresOryginalu)
+		if err != nil {
+			return nil, "", err
+		}
+	} else {
+		inv.Korekty, err = m.Corrections(inv.Id, company_nip)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	if inv.Nip == "" {
+		return inv, "", nil
+	}
+	cRow := m.DB.QueryRow(cStmt, company_nip, inv.Nip)
 	var cName string
-	err = cRow.Scan(&cName)
+	err = cRow.Scan(&cName, &inv.KodKraju)
 	if err != nil {
 		return nil, "", err
 	}
@@ -62,33 +903,189 @@ func (m *InvoiceModel) Get(id int, company_nip string) (*Invoice, string, error)
 
 }
 
+// Corrections returns the corrections of the invoice in the order they were issued.
+func (m *InvoiceModel) Corrections(id int, company_nip string) ([]*Invoice, error) {
+	stmt := `SELECT id, nr_faktury, data, COALESCE(okres, data), netto, podatek, COALESCE(przyczyna_korekty, '')
+	FROM Invoices WHERE korekta_do = @p1 AND company_nip = @p2 ORDER BY data, id`
+	rows, err := m.DB.Query(stmt, id, company_nip)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	korekty := []*Invoice{}
+	for rows.Next() {
+		k := &Invoice{KorektaDo: id}
+		err = rows.Scan(&k.Id, &k.Nr_faktury, &k.Data, &k.Okres, &k.Netto, &k.Podatek, &k.PrzyczynaKorekty)
+		if err != nil {
+			return nil, err
+		}
+		korekty = append(korekty, k)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return korekty, nil
+}
+
 func (m *InvoiceModel) GetAll(company_nip string, current_date time.Time) ([]*Invoice, error) {
-	stmt := "SELECT * FROM Invoices WHERE data >= DATEFROMPARTS(@p1, @p2, 1) AND data < DATEADD(month, 1, DATEFROMPARTS(@p1, @p2, 1)) AND company_nip = @p3"
-	rows, err := m.DB.Query(stmt, current_date.Year(), int(current_date.Month()), company_nip)
 	// why the hell does time.Month() return a time object while time.Year() returns an int
+	return m.list("COALESCE(okres, data) >= DATEFROMPARTS(@p1, @p2, 1) AND COALESCE(okres, data) < DATEADD(month, 1, DATEFROMPARTS(@p1, @p2, 1)) AND company_nip = @p3",
+		current_date.Year(), int(current_date.Month()), company_nip)
+}
+
+// list returns the invoices matching the condition on the Invoices table with their per-rate amounts,
+// lines and markings. The details of all the invoices are read with one query per table.
+func (m *InvoiceModel) list(where string, args ...any) ([]*Invoice, error) {
+	stmt := `SELECT id, nip, nr_faktury, netto, podatek, data, type, company_nip, COALESCE(doc_type, 'VAT'), COALESCE(waluta, 'PLN'), kurs, kurs_data, COALESCE(tabela_nbp, ''), COALESCE(netto_waluta, netto), COALESCE(podatek_waluta, podatek), COALESCE(transakcja, 'KRAJ'),
+	data_sprzedazy, data_wplywu, COALESCE(okres, DATEFROMPARTS(YEAR(data), MONTH(data), 1)), korekta_do, COALESCE(przyczyna_korekty, ''), COALESCE(blad_pierwotny, 0), COALESCE(odliczenie, '100'), COALESCE(proporcja, 0),
+	termin_platnosci, COALESCE(sposob_platnosci, ''), COALESCE(nr_rachunku, ''), COALESCE(mpp_auto, 0),
+	COALESCE((SELECT SUM(p.kwota) FROM Payments p WHERE p.invoice_id = Invoices.id AND p.company_nip = Invoices.company_nip), 0)
+	FROM Invoices WHERE ` + where
+	ids := "SELECT id FROM Invoices WHERE " + where
+	rStmt := "SELECT invoice_id, stawka, netto, podatek FROM InvoiceRates WHERE invoice_id IN (" + ids + ")"
+	lStmt := "SELECT invoice_id, id, lp, opis, ilosc, jednostka, cena_netto, stawka, netto, podatek FROM InvoiceLines WHERE invoice_id IN (" + ids + ") ORDER BY invoice_id, lp"
+	oStmt := "SELECT invoice_id, kod FROM InvoiceMarkers WHERE invoice_id IN (" + ids + ")"
+	rows, err := m.DB.Query(stmt, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	invoices := []*Invoice{}
+	byId := map[int]*Invoice{}
 	for rows.Next() {
 		inv := &Invoice{}
-		err := rows.Scan(&inv.Id, &inv.Nip, &inv.Nr_faktury, &inv.Netto, &inv.Podatek, &inv.Data, &inv.Inv_type, &inv.Company)
+		var kursData, dataSprzedazy, dataWplywu, terminPlatnosci sql.NullTime
+		var korektaDo sql.NullInt64
+		err := rows.Scan(&inv.Id, &inv.Nip, &inv.Nr_faktury, &inv.Netto, &inv.Podatek, &inv.Data, &inv.Inv_type, &inv.Company, &inv.Dokument, &inv.Waluta, &inv.Kurs, &kursData, &inv.TabelaNbp, &inv.NettoWaluta, &inv.PodatekWaluta, &inv.Transakcja,
+			&dataSprzedazy, &dataWplywu, &inv.Okres, &korektaDo, &inv.PrzyczynaKorekty, &inv.BladPierwotny, &inv.Odliczenie, &inv.Proporcja, &terminPlatnosci,
+			&inv.SposobPlatnosci, &inv.NrRachunku, &inv.MppAuto, &inv.Zaplacono)
 		if err != nil {
 			return nil, err
 		}
+		inv.KursData = kursData.Time
+		inv.DataSprzedazy, inv.DataWplywu = dataSprzedazy.Time, dataWplywu.Time
+		inv.TerminPlatnosci = terminPlatnosci.Time
+		inv.KorektaDo = int(korektaDo.Int64)
 		invoices = append(invoices, inv)
+		byId[inv.Id] = inv
 	}
 
 	if err = rows.Err(); err != nil {
 		return nil, err
 	}
-	return invoices, err
+	if len(invoices) == 0 {
+		return invoices, nil
+	}
+
+	rRows, err := m.DB.Query(rStmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rRows.Close()
+	for rRows.Next() {
+		var invId int
+		k := RateAmount{}
+		err := rRows.Scan(&invId, &k.Stawka, &k.Netto, &k.Podatek)
+		if err != nil {
+			return nil, err
+		}
+		if inv, ok := byId[invId]; ok {
+			inv.Kwoty = append(inv.Kwoty, k)
+		}
+	}
+	if err = rRows.Err(); err != nil {
+		return nil, err
+	}
+
+	lRows, err := m.DB.Query(lStmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer lRows.Close()
+	for lRows.Next() {
+		var invId int
+		l := InvoiceLine{}
+		err := lRows.Scan(&invId, &l.Id, &l.Lp, &l.Opis, &l.Ilosc, &l.Jednostka, &l.CenaNetto, &l.Stawka, &l.Netto, &l.Podatek)
+		if err != nil {
+			return nil, err
+		}
+		l.Brutto = l.Netto + l.Podatek
+		if inv, ok := byId[invId]; ok {
+			inv.Pozycje = append(inv.Pozycje, l)
+		}
+	}
+	if err = lRows.Err(); err != nil {
+		return nil, err
+	}
+
+	oRows, err := m.DB.Query(oStmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer oRows.Close()
+	for oRows.Next() {
+		var invId int
+		var o Marker
+		err := oRows.Scan(&invId, &o)
+		if err != nil {
+			return nil, err
+		}
+		if inv, ok := byId[invId]; ok {
+			inv.Oznaczenia = append(inv.Oznaczenia, o)
+		}
+	}
+	if err = oRows.Err(); err != nil {
+		return nil, err
+	}
+	return invoices, nil
 }
 
 func (m *InvoiceModel) Delete(id int, company_nip string) error {
-	stmt := "DELETE FROM Invoices WHERE id = @p1 AND company_nip = @p2"
-	row, err := m.DB.Exec(stmt, id, company_nip)
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var okres time.Time
+	err = tx.QueryRow("SELECT COALESCE(okres, data) FROM Invoices WHERE id = @p1 AND company_nip = @p2", id, company_nip).Scan(&okres)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+	locked, err := periodLocked(tx, company_nip, okres)
+	if err != nil {
+		return err
+	}
+	if locked {
+		return ErrPeriodLocked
+	}
+	var corrected bool
+	err = tx.QueryRow("SELECT CASE WHEN EXISTS(SELECT 1 FROM Invoices WHERE korekta_do = @p1 AND company_nip = @p2) THEN 1 ELSE 0 END", id, company_nip).Scan(&corrected)
+	if err != nil {
+		return err
+	}
+	if corrected {
+		return ErrHasCorrections
+	}
+	// everything stored with the invoice goes first, the bank transactions only lose the link
+	stmts := []string{
+		"DELETE FROM InvoiceRates WHERE invoice_id = (SELECT id FROM Invoices WHERE id = @p1 AND company_nip = @p2)",
+		"DELETE FROM InvoiceHistory WHERE invoice_id = (SELECT id FROM Invoices WHERE id = @p1 AND company_nip = @p2)",
+		"UPDATE BankTransactions SET invoice_id = NULL, payment_id = NULL WHERE invoice_id = @p1 AND company_nip = @p2",
+		"DELETE FROM Payments WHERE invoice_id = @p1 AND company_nip = @p2",
+		"DELETE FROM BadDebts WHERE invoice_id = @p1 AND company_nip = @p2",
+		"DELETE FROM InvoiceMarkers WHERE invoice_id = (SELECT id FROM Invoices WHERE id = @p1 AND company_nip = @p2)",
+		"DELETE FROM InvoiceLines WHERE invoice_id = (SELECT id FROM Invoices WHERE id = @p1 AND company_nip = @p2)",
+	}
+	for _, stmt := range stmts {
+		_, err = tx.Exec(stmt, id, company_nip)
+		if err != nil {
+			return err
+		}
+	}
+	row, err := tx.Exec("DELETE FROM Invoices WHERE id = @p1 AND company_nip = @p2", id, company_nip)
 	if err != nil {
 		return err
 	}
@@ -99,16 +1096,41 @@ func (m *InvoiceModel) Delete(id int, company_nip string) error {
 	if rowsAff == 0 {
 		return ErrNoRecord
 	}
-	return nil
+	return tx.Commit()
 }
 
-func (inv Invoice) IsPreviousMonth() bool {
-	now := time.Now()
+func (inv Invoice) Brutto() Money {
+	return inv.Netto + inv.Podatek
+}
 
-	before := now.AddDate(0, -1, -now.Day()+1)
-	after := before.AddDate(0, 1, 0)
-	if inv.Data.Before(before) || inv.Data.After(after) {
-		return false
+// NettoPoKorektach is the net value of the invoice with all its corrections.
+func (inv Invoice) NettoPoKorektach() Money {
+	netto := inv.Netto
+	for _, k := range inv.Korekty {
+		netto += k.Netto
+	}
+	return netto
+}
+
+// PodatekPoKorektach is the VAT of the invoice with all its corrections.
+func (inv Invoice) PodatekPoKorektach() Money {
+	podatek := inv.Podatek
+	for _, k := range inv.Korekty {
+		podatek += k.Podatek
 	}
-	return true
+	return podatek
+}
+
+func (inv Invoice) BruttoPoKorektach() Money {
+	return inv.NettoPoKorektach() + inv.PodatekPoKorektach()
+}
+
+// BruttoWaluta is the gross amount in the invoice currency.
+func (inv Invoice) BruttoWaluta() Money {
+	return inv.NettoWaluta + inv.PodatekWaluta
+}
+
+func (inv Invoice) IsPreviousMonth() bool {
+	previous := monthOf(time.Now()).AddDate(0, -1, 0)
+	return inv.Okres.Year() == previous.Year() && inv.Okres.Month() == previous.Month()
 }
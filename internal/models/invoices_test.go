@@ -0,0 +1,44 @@
+package models
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMarkMPP(t *testing.T) {
+	sprzedaz := func(netto Money, auto bool, oznaczenia ...Marker) *Invoice {
+		return &Invoice{Inv_type: SaleInvoice, Dokument: DocFaktura, Transakcja: TxKrajowa, Nip: "1234567890",
+			Netto: netto, Oznaczenia: oznaczenia, MppAuto: auto}
+	}
+	tests := []struct {
+		name     string
+		inv      *Invoice
+		orig     *Invoice
+		want     []Marker
+		wantAuto bool
+	}{
+		{"required", sprzedaz(ProgMPP+1, false, "GTU_06"), nil, []Marker{"GTU_06", "MPP"}, true},
+		{"at the threshold", sprzedaz(ProgMPP, false, "GTU_06"), nil, []Marker{"GTU_06"}, false},
+		{"no goods of annex 15", sprzedaz(ProgMPP+1, false, "GTU_12"), nil, []Marker{"GTU_12"}, false},
+		{"set by the user", sprzedaz(100, false, "MPP"), nil, []Marker{"MPP"}, false},
+		{"required and set by the user", sprzedaz(ProgMPP+1, false, "GTU_06", "MPP"), nil, []Marker{"GTU_06", "MPP"}, false},
+		{"added, still required", sprzedaz(ProgMPP+1, true, "GTU_06", "MPP"), nil, []Marker{"GTU_06", "MPP"}, true},
+		{"added, amount lowered", sprzedaz(100, true, "GTU_06", "MPP"), nil, []Marker{"GTU_06"}, false},
+		{"added, goods of annex 15 removed", sprzedaz(ProgMPP+1, true, "MPP", "TP"), nil, []Marker{"TP"}, false},
+		{"added, unticked", sprzedaz(100, true, "GTU_06"), nil, []Marker{"GTU_06"}, false},
+		{"correction of a marked invoice", &Invoice{KorektaDo: 1}, &Invoice{Oznaczenia: []Marker{"MPP"}}, []Marker{"MPP"}, true},
+		{"correction of an unmarked invoice", &Invoice{KorektaDo: 1}, &Invoice{}, nil, false},
+		{"purchase", &Invoice{Inv_type: PurchaseInvoice, Netto: ProgMPP + 1, Oznaczenia: []Marker{"GTU_06"}}, nil, []Marker{"GTU_06"}, false},
+	}
+	for _, tt := range tests {
+		form := tt.inv.Oznaczenia
+		before := slices.Clone(form)
+		tt.inv.markMPP(tt.orig)
+		if !slices.Equal(tt.inv.Oznaczenia, tt.want) || tt.inv.MppAuto != tt.wantAuto {
+			t.Errorf("%s: markMPP() = %v, auto %v; want %v, auto %v", tt.name, tt.inv.Oznaczenia, tt.inv.MppAuto, tt.want, tt.wantAuto)
+		}
+		if !slices.Equal(form, before) {
+			t.Errorf("%s: markMPP() changed the markers of the form to %v", tt.name, form)
+		}
+	}
+}
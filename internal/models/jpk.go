@@ -4,7 +4,8 @@ import (
 	"database/sql"
 	"encoding/xml"
 	"errors"
-	"math"
+	"fmt"
+	"strings"
 	"time"
 )
 
@@ -19,16 +20,122 @@ type JPKMetadata struct {
 	UPO         *string
 	Rok         int
 	Miesiac     int
+	Cel         int
+	KorektaId   *int
+	// BledyWalidacji lists the schema violations found when the file was generated
+	BledyWalidacji []string
+}
+
+func (m *JPKMetadata) Valid() bool {
+	return len(m.BledyWalidacji) == 0
+}
+
+func splitErrors(s sql.NullString) []string {
+	if !s.Valid || s.String == "" {
+		return nil
+	}
+	return strings.Split(s.String, "\n")
+}
+
+// JPKParams describes the submission being generated.
+type JPKParams struct {
+	Okres        time.Time
+	Cel          int
+	Uzasadnienie string
+	// ZwrotKwota of the surplus in P_53 is refunded in ZwrotTermin, the rest is carried forward
+	ZwrotKwota  int
+	ZwrotTermin ZwrotTermin
+	// ZaliczenieKwota of the refund is offset against the future tax liability described by
+	// ZaliczenieRodzaj instead of being paid out
+	ZaliczenieKwota  int
+	ZaliczenieRodzaj string
+}
+
+// ZwrotTermin is the way the VAT surplus is refunded, each marked by its own field of the declaration.
+type ZwrotTermin string
+
+const (
+	ZwrotBrak    ZwrotTermin = ""
+	ZwrotBank15  ZwrotTermin = "15"
+	ZwrotVat25   ZwrotTermin = "VAT25"
+	ZwrotBank25  ZwrotTermin = "25"
+	ZwrotBank40  ZwrotTermin = "40"
+	ZwrotBank60  ZwrotTermin = "60"
+	ZwrotBank180 ZwrotTermin = "180"
+)
+
+// ZwrotTerminy lists the refund options in the order they are shown on forms.
+var ZwrotTerminy = []ZwrotTermin{ZwrotBank15, ZwrotVat25, ZwrotBank25, ZwrotBank40, ZwrotBank60, ZwrotBank180}
+
+func (t ZwrotTermin) Label() string {
+	switch t {
+	case ZwrotBank15:
+		return "Na rachunek bankowy w 15 dni (P_540)"
+	case ZwrotVat25:
+		return "Na rachunek VAT w 25 dni (P_55)"
+	case ZwrotBank25:
+		return "Na rachunek bankowy w 25 dni (P_56)"
+	case ZwrotBank40:
+		return "Na rachunek bankowy w 40 dni (P_560)"
+	case ZwrotBank60:
+		return "Na rachunek bankowy w 60 dni (P_57)"
+	case ZwrotBank180:
+		return "Na rachunek bankowy w 180 dni (P_58)"
+	}
+	return "Bez zwrotu"
+}
+
+const (
+	CelZlozenie = 1
+	CelKorekta  = 2
+)
+
+// jpkWariant holds what differs between the monthly JPK_V7M and the quarterly JPK_V7K.
+type jpkWariant struct {
+	namespace    string
+	kodSystemowy string
+	kodDekl      string
+	systemDekl   string
+	wariantDekl  int
+}
+
+var (
+	wariantV7M = jpkWariant{
+		namespace:    "http://crd.gov.pl/wzor/2021/12/27/11148/",
+		kodSystemowy: "JPK_V7M (2)",
+		kodDekl:      "VAT-7",
+		systemDekl:   "VAT-7 (22)",
+		wariantDekl:  22,
+	}
+	wariantV7K = jpkWariant{
+		namespace:    "http://crd.gov.pl/wzor/2021/12/27/11149/",
+		kodSystemowy: "JPK_V7K (2)",
+		kodDekl:      "VAT-7K",
+		systemDekl:   "VAT-7K (16)",
+		wariantDekl:  16,
+	}
+)
+
+// KwartalZamkniety reports whether the month closes a quarter, the only months in which a quarterly
+// taxpayer files the declaration part.
+func KwartalZamkniety(t time.Time) bool {
+	return t.Month()%3 == 0
+}
+
+// KwartalOkresy returns the first days of the months of the quarter that t belongs to.
+func KwartalOkresy(t time.Time) []time.Time {
+	first := time.Date(t.Year(), t.Month()-(t.Month()-1)%3, 1, 0, 0, 0, 0, t.Location())
+	return []time.Time{first, first.AddDate(0, 1, 0), first.AddDate(0, 2, 0)}
 }
 
 type JPK struct {
-	XMLName    xml.Name    `xml:JPK`
+	XMLName    xml.Name    `xml:"JPK"`
 	XMLTypes   string      `xml:"xmlns:etd,attr"`
 	XMLSchema  string      `xml:"xmlns:xsi,attr"`
 	XMLPattern string      `xml:"xmlns,attr"`
 	Naglowek   NaglowekJPK `xml:"Naglowek"`
 	Podmiot1   Podmiot1    `xml:"Podmiot1"`
-	Deklaracja Deklaracja  `xml:"Deklaracja"`
+	Deklaracja *Deklaracja `xml:"Deklaracja,omitempty"`
 	Ewidencja  Ewidencja   `xml:"Ewidencja"`
 }
 
@@ -38,7 +145,7 @@ type NaglowekJPK struct {
 	DataWytworzeniaJPK string        `xml:"DataWytworzeniaJPK"`
 	NazwaSystemu       string        `xml:"NazwaSystemu"`
 	CelZlozenia        CelZlozenia   `xml:"CelZlozenia"`
-	KodUrzedu          int           `xml:"KodUrzedu"`
+	KodUrzedu          string        `xml:"KodUrzedu"`
 	Rok                int           `xml:"Rok"`
 	Miesiac            int           `xml:"Miesiac"`
 }
@@ -55,15 +162,47 @@ type KodFormularza struct {
 }
 
 type Podmiot1 struct {
-	Rola             string           `xml:"rola,attr"`
-	OsobaNiefizyczna OsobaNiefizyczna `xml:"OsobaNiefizyczna"`
+	Rola             string            `xml:"rola,attr"`
+	OsobaFizyczna    *OsobaFizyczna    `xml:"OsobaFizyczna,omitempty"`
+	OsobaNiefizyczna *OsobaNiefizyczna `xml:"OsobaNiefizyczna,omitempty"`
+}
+
+type OsobaFizyczna struct {
+	NIP           string `xml:"etd:NIP"`
+	ImiePierwsze  string `xml:"etd:ImiePierwsze"`
+	Nazwisko      string `xml:"etd:Nazwisko"`
+	DataUrodzenia string `xml:"etd:DataUrodzenia"`
+	Email         string `xml:"Email"`
+	Telefon       string `xml:"Telefon,omitempty"`
 }
 
 type OsobaNiefizyczna struct {
 	NIP        string `xml:"NIP"`
 	PelnaNazwa string `xml:"PelnaNazwa"`
 	Email      string `xml:"Email"`
-	Telefon    string `xml:"Telefon"`
+	Telefon    string `xml:"Telefon,omitempty"`
+}
+
+func newPodmiot1(profile *CompanyProfile) Podmiot1 {
+	podmiot := Podmiot1{Rola: "Podatnik"}
+	if profile.OsobaFizyczna {
+		podmiot.OsobaFizyczna = &OsobaFizyczna{
+			NIP:           profile.Nip,
+			ImiePierwsze:  profile.Imie,
+			Nazwisko:      profile.Nazwisko,
+			DataUrodzenia: profile.DataUrodzenia.Format("2006-01-02"),
+			Email:         profile.Email,
+			Telefon:       profile.Telefon,
+		}
+	} else {
+		podmiot.OsobaNiefizyczna = &OsobaNiefizyczna{
+			NIP:        profile.Nip,
+			PelnaNazwa: profile.PelnaNazwa,
+			Email:      profile.Email,
+			Telefon:    profile.Telefon,
+		}
+	}
+	return podmiot
 }
 
 type Deklaracja struct {
@@ -86,17 +225,94 @@ type KodFormularzaDekl struct {
 }
 
 type PozycjeSzczegolowe struct {
-	P_37 int `xml:"P_37"`
-	P_38 int `xml:"P_38"`
-	P_39 int `xml:"P_39"`
-	P_42 int `xml:"P_42"`
-	P_43 int `xml:"P_43"`
-	P_48 int `xml:"P_48"`
-	P_51 int `xml:"P_51"`
-	P_53 int `xml:"P_53"`
-	P_62 int `xml:"P_62"`
-	P_68 int `xml:"P_68"`
-	P_69 int `xml:"P_69"`
+	P_10  int `xml:"P_10,omitempty"`
+	P_11  int `xml:"P_11,omitempty"`
+	P_13  int `xml:"P_13,omitempty"`
+	P_15  int `xml:"P_15,omitempty"`
+	P_16  int `xml:"P_16,omitempty"`
+	P_17  int `xml:"P_17,omitempty"`
+	P_18  int `xml:"P_18,omitempty"`
+	P_19  int `xml:"P_19,omitempty"`
+	P_20  int `xml:"P_20,omitempty"`
+	P_21  int `xml:"P_21,omitempty"`
+	P_23  int `xml:"P_23,omitempty"`
+	P_24  int `xml:"P_24,omitempty"`
+	P_27  int `xml:"P_27,omitempty"`
+	P_28  int `xml:"P_28,omitempty"`
+	P_29  int `xml:"P_29,omitempty"`
+	P_30  int `xml:"P_30,omitempty"`
+	P_31  int `xml:"P_31,omitempty"`
+	P_32  int `xml:"P_32,omitempty"`
+	P_37  int `xml:"P_37"`
+	P_38  int `xml:"P_38"`
+	P_39  int `xml:"P_39"`
+	P_42  int `xml:"P_42"`
+	P_43  int `xml:"P_43"`
+	P_48  int `xml:"P_48"`
+	P_51  int `xml:"P_51"`
+	P_53  int `xml:"P_53"`
+	P_54  int `xml:"P_54,omitempty"`
+	P_540 int `xml:"P_540,omitempty"`
+	P_55  int `xml:"P_55,omitempty"`
+	P_56  int `xml:"P_56,omitempty"`
+	P_560 int `xml:"P_560,omitempty"`
+	P_57  int `xml:"P_57,omitempty"`
+	P_58  int `xml:"P_58,omitempty"`
+	// P_59 marks the part of the refund in P_60 offset against the future liability named in P_61
+	P_59 int    `xml:"P_59,omitempty"`
+	P_60 int    `xml:"P_60,omitempty"`
+	P_61 string `xml:"P_61,omitempty"`
+	P_62 int    `xml:"P_62"`
+	P_68 int    `xml:"P_68"`
+	P_69 int    `xml:"P_69"`
+	// P_ORDZU is the justification required when the declaration is corrected
+	P_ORDZU string `xml:"P_ORDZU,omitempty"`
+}
+
+// Zwrot returns the refund requested in the declaration, used to carry it over into a correction.
+func (p PozycjeSzczegolowe) Zwrot() (int, ZwrotTermin) {
+	switch {
+	case p.P_540 == 1:
+		return p.P_54, ZwrotBank15
+	case p.P_55 == 1:
+		return p.P_54, ZwrotVat25
+	case p.P_56 == 1:
+		return p.P_54, ZwrotBank25
+	case p.P_560 == 1:
+		return p.P_54, ZwrotBank40
+	case p.P_57 == 1:
+		return p.P_54, ZwrotBank60
+	case p.P_58 == 1:
+		return p.P_54, ZwrotBank180
+	}
+	return 0, ZwrotBrak
+}
+
+// Zaliczenie returns the part of the refund offset against a future tax liability and the kind of the
+// liability.
+func (p PozycjeSzczegolowe) Zaliczenie() (int, string) {
+	if p.P_59 != 1 {
+		return 0, ""
+	}
+	return p.P_60, p.P_61
+}
+
+func (p *PozycjeSzczegolowe) setZwrot(kwota int, termin ZwrotTermin) {
+	p.P_54 = kwota
+	switch termin {
+	case ZwrotBank15:
+		p.P_540 = 1
+	case ZwrotVat25:
+		p.P_55 = 1
+	case ZwrotBank25:
+		p.P_56 = 1
+	case ZwrotBank40:
+		p.P_560 = 1
+	case ZwrotBank60:
+		p.P_57 = 1
+	case ZwrotBank180:
+		p.P_58 = 1
+	}
 }
 
 type Ewidencja struct {
@@ -107,94 +323,344 @@ type Ewidencja struct {
 }
 
 type SprzedazWiersz struct {
-	LpSprzedazy        int     `xml:"LpSprzedazy"`
-	KodKrajuNadaniaTIN string  `xml:"KodKrajuNadaniaTIN"`
-	NrKontrahenta      string  `xml:"NrKontrahenta"`
-	NazwaKontrahenta   string  `xml:"NazwaKontrahenta"`
-	DowodSprzedazy     string  `xml:"DowodSprzedazy"`
-	DataWystawienia    string  `xml:"DataWystawienia"`
-	K_19               float64 `xml:"K_19"`
-	K_20               float64 `xml:"K_20"`
+	LpSprzedazy        int    `xml:"LpSprzedazy"`
+	KodKrajuNadaniaTIN string `xml:"KodKrajuNadaniaTIN,omitempty"`
+	NrKontrahenta      string `xml:"NrKontrahenta"`
+	NazwaKontrahenta   string `xml:"NazwaKontrahenta"`
+	DowodSprzedazy     string `xml:"DowodSprzedazy"`
+	DataWystawienia    string `xml:"DataWystawienia"`
+	DataSprzedazy      string `xml:"DataSprzedazy,omitempty"`
+	TypDokumentu       string `xml:"TypDokumentu,omitempty"`
+	GTU_01             int    `xml:"GTU_01,omitempty"`
+	GTU_02             int    `xml:"GTU_02,omitempty"`
+	GTU_03             int    `xml:"GTU_03,omitempty"`
+	GTU_04             int    `xml:"GTU_04,omitempty"`
+	GTU_05             int    `xml:"GTU_05,omitempty"`
+	GTU_06             int    `xml:"GTU_06,omitempty"`
+	GTU_07             int    `xml:"GTU_07,omitempty"`
+	GTU_08             int    `xml:"GTU_08,omitempty"`
+	GTU_09             int    `xml:"GTU_09,omitempty"`
+	GTU_10             int    `xml:"GTU_10,omitempty"`
+	GTU_11             int    `xml:"GTU_11,omitempty"`
+	GTU_12             int    `xml:"GTU_12,omitempty"`
+	GTU_13             int    `xml:"GTU_13,omitempty"`
+	WSTO_EE            int    `xml:"WSTO_EE,omitempty"`
+	IED                int    `xml:"IED,omitempty"`
+	TP                 int    `xml:"TP,omitempty"`
+	TT_WNT             int    `xml:"TT_WNT,omitempty"`
+	TT_D               int    `xml:"TT_D,omitempty"`
+	MR_T               int    `xml:"MR_T,omitempty"`
+	MR_UZ              int    `xml:"MR_UZ,omitempty"`
+	I_42               int    `xml:"I_42,omitempty"`
+	I_63               int    `xml:"I_63,omitempty"`
+	B_SPV              int    `xml:"B_SPV,omitempty"`
+	B_SPV_DOSTAWA      int    `xml:"B_SPV_DOSTAWA,omitempty"`
+	B_MPV_PROWIZJA     int    `xml:"B_MPV_PROWIZJA,omitempty"`
+	MPP                int    `xml:"MPP,omitempty"`
+	// KorektaPodstawyOpodt marks a bad-debt correction, dated by the due date of the relieved invoice or
+	// the payment reversing the relief
+	KorektaPodstawyOpodt int    `xml:"KorektaPodstawyOpodt,omitempty"`
+	TerminPlatnosci      string `xml:"TerminPlatnosci,omitempty"`
+	DataZaplaty          string `xml:"DataZaplaty,omitempty"`
+	K_10                 Money  `xml:"K_10,omitempty"`
+	K_11                 Money  `xml:"K_11,omitempty"`
+	K_13                 Money  `xml:"K_13,omitempty"`
+	K_15                 Money  `xml:"K_15,omitempty"`
+	K_16                 Money  `xml:"K_16,omitempty"`
+	K_17                 Money  `xml:"K_17,omitempty"`
+	K_18                 Money  `xml:"K_18,omitempty"`
+	K_19                 Money  `xml:"K_19,omitempty"`
+	K_20                 Money  `xml:"K_20,omitempty"`
+	K_21                 Money  `xml:"K_21,omitempty"`
+	K_23                 Money  `xml:"K_23,omitempty"`
+	K_24                 Money  `xml:"K_24,omitempty"`
+	K_27                 Money  `xml:"K_27,omitempty"`
+	K_28                 Money  `xml:"K_28,omitempty"`
+	K_29                 Money  `xml:"K_29,omitempty"`
+	K_30                 Money  `xml:"K_30,omitempty"`
+	K_31                 Money  `xml:"K_31,omitempty"`
+	K_32                 Money  `xml:"K_32,omitempty"`
+}
+
+// mark sets the JPK column of a GTU code or procedure marking.
+func (w *SprzedazWiersz) mark(kod Marker) {
+	columns := map[Marker]*int{
+		"GTU_01":         &w.GTU_01,
+		"GTU_02":         &w.GTU_02,
+		"GTU_03":         &w.GTU_03,
+		"GTU_04":         &w.GTU_04,
+		"GTU_05":         &w.GTU_05,
+		"GTU_06":         &w.GTU_06,
+		"GTU_07":         &w.GTU_07,
+		"GTU_08":         &w.GTU_08,
+		"GTU_09":         &w.GTU_09,
+		"GTU_10":         &w.GTU_10,
+		"GTU_11":         &w.GTU_11,
+		"GTU_12":         &w.GTU_12,
+		"GTU_13":         &w.GTU_13,
+		"WSTO_EE":        &w.WSTO_EE,
+		"IED":            &w.IED,
+		"TP":             &w.TP,
+		"TT_WNT":         &w.TT_WNT,
+		"TT_D":           &w.TT_D,
+		"MR_T":           &w.MR_T,
+		"MR_UZ":          &w.MR_UZ,
+		"I_42":           &w.I_42,
+		"I_63":           &w.I_63,
+		"B_SPV":          &w.B_SPV,
+		"B_SPV_DOSTAWA":  &w.B_SPV_DOSTAWA,
+		"B_MPV_PROWIZJA": &w.B_MPV_PROWIZJA,
+		"MPP":            &w.MPP,
+	}
+	if c, ok := columns[kod]; ok {
+		*c = 1
+	}
+}
+
+// addAmount books the amount into the K_ columns matching its VAT rate.
+func (w *SprzedazWiersz) addAmount(k RateAmount) {
+	switch k.Stawka {
+	case Rate23:
+		w.K_19 += k.Netto
+		w.K_20 += k.Podatek
+	case Rate8:
+		w.K_17 += k.Netto
+		w.K_18 += k.Podatek
+	case Rate5:
+		w.K_15 += k.Netto
+		w.K_16 += k.Podatek
+	case Rate0:
+		w.K_13 += k.Netto
+	case RateZw:
+		w.K_10 += k.Netto
+	case RateNp:
+		w.K_11 += k.Netto
+	}
+}
+
+// addTransaction books the invoice into the K_ columns of its transaction type. An intra-community supply
+// only has a net value, the self-assessed purchases carry the tax due.
+func (w *SprzedazWiersz) addTransaction(i *Invoice) {
+	switch i.Transakcja {
+	case TxWDT:
+		w.K_21 += i.Netto
+	case TxWNT:
+		w.K_23 += i.Netto
+		w.K_24 += i.Podatek
+	case TxImportUslug:
+		w.K_27 += i.Netto
+		w.K_28 += i.Podatek
+	case TxImportUslug28b:
+		w.K_29 += i.Netto
+		w.K_30 += i.Podatek
+	case TxOdwrotneObciazenie:
+		w.K_31 += i.Netto
+		w.K_32 += i.Podatek
+	default:
+		for _, k := range i.Kwoty {
+			w.addAmount(k)
+		}
+	}
+}
+
+// add sums the K_ columns of another row, used to total the register for the declaration.
+func (w *SprzedazWiersz) add(o SprzedazWiersz) {
+	w.K_10 += o.K_10
+	w.K_11 += o.K_11
+	w.K_13 += o.K_13
+	w.K_15 += o.K_15
+	w.K_16 += o.K_16
+	w.K_17 += o.K_17
+	w.K_18 += o.K_18
+	w.K_19 += o.K_19
+	w.K_20 += o.K_20
+	w.K_21 += o.K_21
+	w.K_23 += o.K_23
+	w.K_24 += o.K_24
+	w.K_27 += o.K_27
+	w.K_28 += o.K_28
+	w.K_29 += o.K_29
+	w.K_30 += o.K_30
+	w.K_31 += o.K_31
+	w.K_32 += o.K_32
+}
+
+func (w SprzedazWiersz) Netto() Money {
+	return w.K_10 + w.K_11 + w.K_13 + w.K_15 + w.K_17 + w.K_19 + w.K_21 + w.K_23 + w.K_27 + w.K_29 + w.K_31
+}
+
+func (w SprzedazWiersz) Podatek() Money {
+	return w.K_16 + w.K_18 + w.K_20 + w.K_24 + w.K_28 + w.K_30 + w.K_32
 }
 
 type SprzedazCtrl struct {
-	LiczbaWierszySprzedazy int     `xml:"LiczbaWierszySprzedazy"`
-	PodatekNalezny         float64 `xml:"PodatekNalezny"`
+	LiczbaWierszySprzedazy int   `xml:"LiczbaWierszySprzedazy"`
+	PodatekNalezny         Money `xml:"PodatekNalezny"`
 }
 
 type ZakupWiersz struct {
-	LpZakupu           int     `xml:"LpZakupu"`
-	KodKrajuNadaniaTIN string  `xml:"KodKrajuNadaniaTIN"`
-	NrDostawcy         string  `xml:"NrDostawcy"`
-	NazwaDostawcy      string  `xml:"NazwaDostawcy"`
-	DowodZakupu        string  `xml:"DowodZakupu"`
-	DataZakupu         string  `xml:"DataZakupu"`
-	K_42               float64 `xml:"K_42"`
-	K_43               float64 `xml:"K_43"`
+	LpZakupu           int    `xml:"LpZakupu"`
+	KodKrajuNadaniaTIN string `xml:"KodKrajuNadaniaTIN,omitempty"`
+	NrDostawcy         string `xml:"NrDostawcy"`
+	NazwaDostawcy      string `xml:"NazwaDostawcy"`
+	DowodZakupu        string `xml:"DowodZakupu"`
+	DataZakupu         string `xml:"DataZakupu"`
+	DataWplywu         string `xml:"DataWplywu,omitempty"`
+	DokumentZakupu     string `xml:"DokumentZakupu,omitempty"`
+	MPP                int    `xml:"MPP,omitempty"`
+	IMP                int    `xml:"IMP,omitempty"`
+	K_42               Money  `xml:"K_42"`
+	K_43               Money  `xml:"K_43"`
+}
+
+func (w *ZakupWiersz) mark(kod Marker) {
+	switch kod {
+	case "MPP":
+		w.MPP = 1
+	case "IMP":
+		w.IMP = 1
+	}
 }
 
 type ZakupCtrl struct {
-	LiczbaWierszyZakupow int     `xml:"LiczbaWierszyZakupow"`
-	PodatekNaliczony     float64 `xml:"PodatekNaliczony"`
+	LiczbaWierszyZakupow int   `xml:"LiczbaWierszyZakupow"`
+	PodatekNaliczony     Money `xml:"PodatekNaliczony"`
 }
 
-func (m *JPKModel) NewJpk(inv []*Invoice, date time.Time) (*JPK, error) {
-	var podatekNaliczony float64 = 0
-	var podatekNalezny float64 = 0
-	var podstawaSprzedazy float64 = 0
-	var podstawaZakupu float64 = 0
+// NewJpk builds the file for params.Okres. Only invoices of that month go to the ewidencja. For a quarterly
+// taxpayer the declaration is added in quarter-closing months and covers every invoice passed in, so the
+// caller hands over the whole quarter there.
+func (m *JPKModel) NewJpk(inv []*Invoice, profile *CompanyProfile, params JPKParams) (*JPK, error) {
+	date := params.Okres
+	previousPeriod := date.AddDate(0, -1, 0)
+	if profile.Kwartalnie {
+		previousPeriod = date.AddDate(0, -3, 0)
+	}
+	poprzedniVat, err := carriedForward(m.DB, profile.Nip, previousPeriod)
+	if err != nil {
+		return nil, err
+	}
+	var nips []string
+	for _, i := range inv {
+		if i.Nip != "" && i.Okres.Year() == date.Year() && i.Okres.Month() == date.Month() {
+			nips = append(nips, i.Nip)
+		}
+	}
+	contractors, err := contractorsByNip(m.DB, profile.Nip, nips)
+	if err != nil {
+		return nil, err
+	}
+	return buildJpk(inv, contractors, poprzedniVat, profile, params)
+}
+
+// buildJpk builds the file from the invoices, the registry entries of their contractors and the surplus
+// carried over from the previous period.
+func buildJpk(inv []*Invoice, contractors map[string]*Contractor, poprzedniVat int, profile *CompanyProfile, params JPKParams) (*JPK, error) {
+	var podatekNaliczony Money
+	var podstawaZakupu Money
+	var sprzedaz SprzedazWiersz
+	// zleDlugi totals the bad-debt corrections, which are also part of the sales
+	var zleDlugi SprzedazWiersz
 	var sprzedazWiersz []SprzedazWiersz
+	var podatekNaleznyEwidencja, podatekNaliczonyEwidencja Money
 	var zakupWiersz []ZakupWiersz
 	var companyName string
-	var poprzedniVat int
-	previousMonth := date.AddDate(0, -1, 0)
-	previousPeriod := previousMonth.AddDate(0, -1, 0)
-	err := m.DB.QueryRow("SELECT vat FROM JpkFiles WHERE year = @p1 AND month = @p2 AND confirmed_at IS NOT NULL", date.Year(), previousPeriod.Month()).Scan(&poprzedniVat)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			poprzedniVat = 0
-		} else {
-			return nil, err
-		}
+	date := params.Okres
+	wariant := wariantV7M
+	if profile.Kwartalnie {
+		wariant = wariantV7K
 	}
 	saleCount := 0
 	purcCount := 0
 	for _, i := range inv {
-		nameRow := m.DB.QueryRow("SELECT nazwa FROM Companies WHERE nip = @p1", i.Nip)
-		err := nameRow.Scan(&companyName)
-		if err != nil {
-			return nil, err
+		wEwidencji := i.Okres.Year() == date.Year() && i.Okres.Month() == date.Month()
+		// a self-assessed purchase is also a row of the sales register, with the same tax on both sides
+		wSprzedazy := i.Inv_type == SaleInvoice || i.Transakcja.SelfAssessed()
+		if !wEwidencji {
+			// earlier months of the quarter only count towards the declaration
+			if wSprzedazy && i.Dokument != DocFP {
+				var wiersz SprzedazWiersz
+				wiersz.addTransaction(i)
+				sprzedaz.add(wiersz)
+				if i.zlyDlug {
+					zleDlugi.add(wiersz)
+				}
+			}
+			if i.Inv_type == PurchaseInvoice {
+				podatekNaliczony += i.PodatekDoOdliczenia()
+				podstawaZakupu += i.NettoDoOdliczenia()
+			}
+			continue
+		}
+		nip, kodKraju := i.Nip, ""
+		if nip == "" {
+			nip, companyName = "brak", "brak"
+		} else {
+			c, ok := contractors[nip]
+			if !ok {
+				return nil, ErrNoRecord
+			}
+			companyName, kodKraju = c.Nazwa, c.KodKraju
 		}
-		switch i.Inv_type {
-		case SaleInvoice:
+		if wSprzedazy {
 			saleCount++
-			podatekNalezny += i.Podatek
-			podstawaSprzedazy += i.Netto
-			sprzedazWiersz = append(sprzedazWiersz, SprzedazWiersz{LpSprzedazy: saleCount, KodKrajuNadaniaTIN: "PL", NrKontrahenta: i.Nip, NazwaKontrahenta: companyName, DowodSprzedazy: i.Nr_faktury, DataWystawienia: string(i.Data.Format("2006-01-02")), K_19: i.Netto, K_20: i.Podatek})
-		case PurchaseInvoice:
+			wiersz := SprzedazWiersz{LpSprzedazy: saleCount, KodKrajuNadaniaTIN: kodKraju, NrKontrahenta: nip, NazwaKontrahenta: companyName, DowodSprzedazy: i.Nr_faktury, DataWystawienia: string(i.Data.Format("2006-01-02")), TypDokumentu: i.Dokument.jpkCode()}
+			// the sale date is only reported when it differs from the issue date
+			if !i.DataSprzedazy.IsZero() && !i.DataSprzedazy.Equal(i.Data) {
+				wiersz.DataSprzedazy = i.DataSprzedazy.Format("2006-01-02")
+			}
+			wiersz.addTransaction(i)
+			if i.Inv_type == SaleInvoice {
+				for _, o := range i.Oznaczenia {
+					wiersz.mark(o)
+				}
+			}
+			if i.zlyDlug {
+				wiersz.KorektaPodstawyOpodt = 1
+				if i.dataZaplaty.IsZero() {
+					wiersz.TerminPlatnosci = i.TerminPlatnosci.Format("2006-01-02")
+				} else {
+					wiersz.DataZaplaty = i.dataZaplaty.Format("2006-01-02")
+				}
+				zleDlugi.add(wiersz)
+			}
+			// a receipt invoice repeats a sale already reported by the cash register, so it is listed
+			// but left out of the totals
+			if i.Dokument != DocFP {
+				sprzedaz.add(wiersz)
+				podatekNaleznyEwidencja += wiersz.Podatek()
+			}
+			sprzedazWiersz = append(sprzedazWiersz, wiersz)
+		}
+		// a purchase without the right to deduct is not a row of the purchase register
+		if i.Inv_type == PurchaseInvoice && i.Odliczenie != OdliczenieBrak {
 			purcCount++
-			podatekNaliczony += i.Podatek
-			podstawaZakupu += i.Netto
-			zakupWiersz = append(zakupWiersz, ZakupWiersz{LpZakupu: purcCount, KodKrajuNadaniaTIN: "PL", NrDostawcy: i.Nip, NazwaDostawcy: companyName, DowodZakupu: i.Nr_faktury, DataZakupu: string(i.Data.Format("2006-01-02")), K_42: i.Netto, K_43: i.Podatek})
+			podatekNaliczony += i.PodatekDoOdliczenia()
+			podatekNaliczonyEwidencja += i.PodatekDoOdliczenia()
+			podstawaZakupu += i.NettoDoOdliczenia()
+			wiersz := ZakupWiersz{LpZakupu: purcCount, KodKrajuNadaniaTIN: kodKraju, NrDostawcy: nip, NazwaDostawcy: companyName, DowodZakupu: i.Nr_faktury, DataZakupu: string(i.Data.Format("2006-01-02")), DokumentZakupu: i.Dokument.jpkCode(), K_42: i.NettoDoOdliczenia(), K_43: i.PodatekDoOdliczenia()}
+			if !i.DataWplywu.IsZero() {
+				wiersz.DataWplywu = i.DataWplywu.Format("2006-01-02")
+			}
+			for _, o := range i.Oznaczenia {
+				wiersz.mark(o)
+			}
+			zakupWiersz = append(zakupWiersz, wiersz)
 		}
 	}
-	var p_51 int
-	var p_53 int
-	if podatekNalezny > (podatekNaliczony + float64(poprzedniVat)) {
-		p_51 = int(math.Round(podatekNalezny) - (math.Round(podatekNaliczony) + float64(poprzedniVat)))
-		p_53 = 0
-	} else {
-		p_51 = 0
-		p_53 = int(math.Round(podatekNaliczony) + float64(poprzedniVat) - math.Round(podatekNalezny))
+	deklaracja := !profile.Kwartalnie || KwartalZamkniety(date)
+	pozycje, err := pozycjeDeklaracji(sprzedaz, zleDlugi, podstawaZakupu, podatekNaliczony, poprzedniVat, deklaracja, params)
+	if err != nil {
+		return nil, err
 	}
 
 	jpk := &JPK{
 		XMLTypes:   "http://crd.gov.pl/xml/schematy/dziedzinowe/mf/2021/06/08/eD/DefinicjeTypy/",
 		XMLSchema:  "http://www.w3.org/2001/XMLSchema-instance",
-		XMLPattern: "http://crd.gov.pl/wzor/2021/12/27/11148/",
+		XMLPattern: wariant.namespace,
 		Naglowek: NaglowekJPK{
 			KodFormularza: KodFormularza{
-				KodSystemowy: "JPK_V7M (2)",
+				KodSystemowy: wariant.kodSystemowy,
 				WersjaSchemy: "1-0E",
 				Kod:          "JPK_VAT",
 			},
@@ -203,68 +669,121 @@ func (m *JPKModel) NewJpk(inv []*Invoice, date time.Time) (*JPK, error) {
 			NazwaSystemu:       "Formularz uproszczony",
 			CelZlozenia: CelZlozenia{
 				Poz: "P_7",
-				Cel: 1,
-			},
-			KodUrzedu: 1210,
-			Rok:       time.Now().Year(),
-			Miesiac:   int(previousMonth.Month()),
-		},
-		Podmiot1: Podmiot1{
-			Rola: "Podatnik",
-			OsobaNiefizyczna: OsobaNiefizyczna{
-				NIP:        "6793194113",
-				PelnaNazwa: "Grey House sp. z o.o.",
-				Email:      "info@greyhouse.es",
-				Telefon:    "608415900",
+				Cel: params.Cel,
 			},
+			KodUrzedu: profile.KodUrzedu,
+			Rok:       date.Year(),
+			Miesiac:   int(date.Month()),
 		},
-		Deklaracja: Deklaracja{
-			Naglowek: NaglowekDekl{
-				KodFormularzaDekl: KodFormularzaDekl{
-					KodSystemowy:       "VAT-7 (22)",
-					KodPodatku:         "VAT",
-					RodzajZobowiazania: "Z",
-					WersjaSchemy:       "1-0E",
-					Kod:                "VAT-7",
-				},
-				WariantFormularzaDekl: 22,
-			},
-			PozycjeSzczegolowe: PozycjeSzczegolowe{
-				P_37: int(math.Round(podstawaSprzedazy)),
-				P_38: int(math.Round(podatekNalezny)),
-				P_39: poprzedniVat,
-				P_42: int(math.Round(podstawaZakupu)),
-				P_43: int(math.Round(podatekNaliczony)),
-				P_48: poprzedniVat + int(math.Round(podatekNaliczony)),
-				P_51: p_51,
-				P_53: p_53,
-				P_62: p_53,
-				P_68: 0,
-				P_69: 0,
-			},
-			Pouczenia: 1,
-		},
+		Podmiot1: newPodmiot1(profile),
 		Ewidencja: Ewidencja{
 			SprzedazWiersz: sprzedazWiersz,
 			SprzedazCtrl: SprzedazCtrl{
 				LiczbaWierszySprzedazy: saleCount,
-				PodatekNalezny:         math.Round(podatekNalezny*100) / 100,
+				PodatekNalezny:         podatekNaleznyEwidencja,
 			},
 			ZakupWiersz: zakupWiersz,
 			ZakupCtrl: ZakupCtrl{
 				LiczbaWierszyZakupow: purcCount,
-				PodatekNaliczony:     math.Round(podatekNaliczony*100) / 100,
+				PodatekNaliczony:     podatekNaliczonyEwidencja,
 			},
 		},
 	}
+	if deklaracja {
+		jpk.Deklaracja = &Deklaracja{
+			Naglowek: NaglowekDekl{
+				KodFormularzaDekl: KodFormularzaDekl{
+					KodSystemowy:       wariant.systemDekl,
+					KodPodatku:         "VAT",
+					RodzajZobowiazania: "Z",
+					WersjaSchemy:       "1-0E",
+					Kod:                wariant.kodDekl,
+				},
+				WariantFormularzaDekl: wariant.wariantDekl,
+			},
+			PozycjeSzczegolowe: pozycje,
+			Pouczenia:          1,
+		}
+	}
 	return jpk, nil
 }
 
-func (m *JPKModel) InsertDB(jpk *JPK, jpk_data, company_nip string) (int, error) {
-	// implement insertion to DB after creation
-	stmt := "INSERT INTO JpkFiles(year, month, xml_content, generated_at, company_nip) OUTPUT Inserted.id VALUES(@p1, @p2, @p3, @p4, @p5)"
+// pozycjeDeklaracji computes the declaration fields from the sales of the period, the bad-debt corrections
+// among them, the deductible purchases and the surplus carried over from the previous period, with the
+// refund and offset requested in params. deklaracja is false in the months a quarterly taxpayer files no
+// declaration, where no refund can be requested.
+func pozycjeDeklaracji(sprzedaz, zleDlugi SprzedazWiersz, podstawaZakupu, podatekNaliczony Money, poprzedniVat int, deklaracja bool, params JPKParams) (PozycjeSzczegolowe, error) {
+	// declaration fields are rounded to whole zloty one by one, the totals are sums of the rounded fields
+	pozycje := PozycjeSzczegolowe{
+		P_10: sprzedaz.K_10.Zlote(),
+		P_11: sprzedaz.K_11.Zlote(),
+		P_13: sprzedaz.K_13.Zlote(),
+		P_15: sprzedaz.K_15.Zlote(),
+		P_16: sprzedaz.K_16.Zlote(),
+		P_17: sprzedaz.K_17.Zlote(),
+		P_18: sprzedaz.K_18.Zlote(),
+		P_19: sprzedaz.K_19.Zlote(),
+		P_20: sprzedaz.K_20.Zlote(),
+		P_21: sprzedaz.K_21.Zlote(),
+		P_23: sprzedaz.K_23.Zlote(),
+		P_24: sprzedaz.K_24.Zlote(),
+		P_27: sprzedaz.K_27.Zlote(),
+		P_28: sprzedaz.K_28.Zlote(),
+		P_29: sprzedaz.K_29.Zlote(),
+		P_30: sprzedaz.K_30.Zlote(),
+		P_31: sprzedaz.K_31.Zlote(),
+		P_32: sprzedaz.K_32.Zlote(),
+		P_39: poprzedniVat,
+		P_42: podstawaZakupu.Zlote(),
+		P_43: podatekNaliczony.Zlote(),
+		P_68: zleDlugi.Netto().Zlote(),
+		P_69: zleDlugi.Podatek().Zlote(),
+	}
+	pozycje.P_37 = pozycje.P_10 + pozycje.P_11 + pozycje.P_13 + pozycje.P_15 + pozycje.P_17 + pozycje.P_19 +
+		pozycje.P_21 + pozycje.P_23 + pozycje.P_27 + pozycje.P_29 + pozycje.P_31
+	pozycje.P_38 = pozycje.P_16 + pozycje.P_18 + pozycje.P_20 + pozycje.P_24 + pozycje.P_28 + pozycje.P_30 + pozycje.P_32
+	pozycje.P_48 = pozycje.P_39 + pozycje.P_43
+	if pozycje.P_38 > pozycje.P_48 {
+		pozycje.P_51 = pozycje.P_38 - pozycje.P_48
+	} else {
+		pozycje.P_53 = pozycje.P_48 - pozycje.P_38
+	}
+	pozycje.P_62 = pozycje.P_53
+	if !deklaracja && (params.ZwrotKwota > 0 || params.ZaliczenieKwota > 0) {
+		return PozycjeSzczegolowe{}, ErrNoDeclaration
+	}
+	if params.ZaliczenieKwota > params.ZwrotKwota {
+		return PozycjeSzczegolowe{}, ErrOffsetTooHigh
+	}
+	if params.ZwrotKwota > 0 {
+		if params.ZwrotKwota > pozycje.P_53 {
+			return PozycjeSzczegolowe{}, ErrRefundTooHigh
+		}
+		pozycje.setZwrot(params.ZwrotKwota, params.ZwrotTermin)
+		if params.ZaliczenieKwota > 0 {
+			pozycje.P_59 = 1
+			pozycje.P_60 = params.ZaliczenieKwota
+			pozycje.P_61 = params.ZaliczenieRodzaj
+		}
+		// the amount offset in P_60 is a part of the refund in P_54, so only P_54 is taken off
+		pozycje.P_62 = pozycje.P_53 - pozycje.P_54
+	}
+	if params.Cel == CelKorekta {
+		pozycje.P_ORDZU = params.Uzasadnienie
+	}
+	return pozycje, nil
+}
+
+// InsertDB stores a generated file. korektaId is the file being corrected, nil for an original submission.
+// bledy are the schema violations found by ValidateJpk.
+func (m *JPKModel) InsertDB(jpk *JPK, jpk_data, company_nip string, korektaId *int, bledy []string) (int, error) {
+	stmt := "INSERT INTO JpkFiles(year, month, xml_content, generated_at, company_nip, cel, corrects_id, validation_errors) OUTPUT Inserted.id VALUES(@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8)"
+	var validationErrors sql.NullString
+	if len(bledy) > 0 {
+		validationErrors = sql.NullString{String: strings.Join(bledy, "\n"), Valid: true}
+	}
 	var resId int
-	err := m.DB.QueryRow(stmt, jpk.Naglowek.Rok, jpk.Naglowek.Miesiac, jpk_data, time.Now(), company_nip).Scan(&resId)
+	err := m.DB.QueryRow(stmt, jpk.Naglowek.Rok, jpk.Naglowek.Miesiac, jpk_data, time.Now(), company_nip, jpk.Naglowek.CelZlozenia.Cel, korektaId, validationErrors).Scan(&resId)
 	if err != nil {
 		return 0, err
 	}
@@ -272,11 +791,12 @@ func (m *JPKModel) InsertDB(jpk *JPK, jpk_data, company_nip string) (int, error)
 }
 
 func (m *JPKModel) Get(id int, company_nip string) (*JPK, *JPKMetadata, error) {
-	stmt := "SELECT xml_content, id, generated_at, confirmed_at, upo_reference_number FROM JpkFiles WHERE id = @p1 AND company_nip = @p2"
+	stmt := "SELECT xml_content, id, generated_at, confirmed_at, upo_reference_number, year, month, cel, corrects_id, validation_errors FROM JpkFiles WHERE id = @p1 AND company_nip = @p2"
 	row := m.DB.QueryRow(stmt, id, company_nip)
 	var byteArray []byte
+	var validationErrors sql.NullString
 	jpkmetadata := &JPKMetadata{}
-	err := row.Scan(&byteArray, &jpkmetadata.Id, &jpkmetadata.GeneratedAt, &jpkmetadata.ConfirmedAt, &jpkmetadata.UPO)
+	err := row.Scan(&byteArray, &jpkmetadata.Id, &jpkmetadata.GeneratedAt, &jpkmetadata.ConfirmedAt, &jpkmetadata.UPO, &jpkmetadata.Rok, &jpkmetadata.Miesiac, &jpkmetadata.Cel, &jpkmetadata.KorektaId, &validationErrors)
 	if err != nil || len(byteArray) == 0 {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil, ErrNoRecord
@@ -285,6 +805,8 @@ func (m *JPKModel) Get(id int, company_nip string) (*JPK, *JPKMetadata, error) {
 		}
 	}
 
+	jpkmetadata.BledyWalidacji = splitErrors(validationErrors)
+
 	jpk := &JPK{}
 	err = xml.Unmarshal(byteArray, jpk)
 	if err != nil {
@@ -294,7 +816,7 @@ func (m *JPKModel) Get(id int, company_nip string) (*JPK, *JPKMetadata, error) {
 }
 
 func (m *JPKModel) GetAll(company_nip string) ([]*JPKMetadata, error) {
-	stmt := "SELECT id, confirmed_at, upo_reference_number, year, month FROM JpkFiles WHERE company_nip = @p1"
+	stmt := "SELECT id, confirmed_at, upo_reference_number, year, month, cel, corrects_id, validation_errors FROM JpkFiles WHERE company_nip = @p1"
 	rows, err := m.DB.Query(stmt, company_nip)
 	if err != nil {
 		return nil, err
@@ -304,10 +826,12 @@ func (m *JPKModel) GetAll(company_nip string) ([]*JPKMetadata, error) {
 	jpkfiles := []*JPKMetadata{}
 	for rows.Next() {
 		jpkdata := &JPKMetadata{}
-		err = rows.Scan(&jpkdata.Id, &jpkdata.ConfirmedAt, &jpkdata.UPO, &jpkdata.Rok, &jpkdata.Miesiac)
+		var validationErrors sql.NullString
+		err = rows.Scan(&jpkdata.Id, &jpkdata.ConfirmedAt, &jpkdata.UPO, &jpkdata.Rok, &jpkdata.Miesiac, &jpkdata.Cel, &jpkdata.KorektaId, &validationErrors)
 		if err != nil {
 			return nil, err
 		}
+		jpkdata.BledyWalidacji = splitErrors(validationErrors)
 		jpkfiles = append(jpkfiles, jpkdata)
 	}
 
@@ -317,9 +841,71 @@ func (m *JPKModel) GetAll(company_nip string) ([]*JPKMetadata, error) {
 	return jpkfiles, nil
 }
 
+// Chain returns every file of the correction chain the given file belongs to: the original
+// submission and all corrections built on top of it, oldest first.
+func (m *JPKModel) Chain(id int, company_nip string) ([]*JPKMetadata, error) {
+	stmt := `WITH up AS (
+		SELECT id, corrects_id FROM JpkFiles WHERE id = @p1 AND company_nip = @p2
+		UNION ALL
+		SELECT f.id, f.corrects_id FROM JpkFiles f JOIN up ON f.id = up.corrects_id
+	), down AS (
+		SELECT id FROM up WHERE corrects_id IS NULL
+		UNION ALL
+		SELECT f.id FROM JpkFiles f JOIN down ON f.corrects_id = down.id
+	)
+	SELECT id, confirmed_at, upo_reference_number, year, month, cel, corrects_id FROM JpkFiles
+	WHERE id IN (SELECT id FROM down) AND company_nip = @p2 ORDER BY generated_at`
+	rows, err := m.DB.Query(stmt, id, company_nip)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	chain := []*JPKMetadata{}
+	for rows.Next() {
+		jpkdata := &JPKMetadata{}
+		err = rows.Scan(&jpkdata.Id, &jpkdata.ConfirmedAt, &jpkdata.UPO, &jpkdata.Rok, &jpkdata.Miesiac, &jpkdata.Cel, &jpkdata.KorektaId)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, jpkdata)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return chain, nil
+}
+
+// Confirm marks the file as accepted by the tax office. A file with a declaration also records its result
+// in the carry-forward ledger, replacing the entry of an earlier file for the same period.
 func (m *JPKModel) Confirm(id int, upo, company_nip string) error {
-	stmt := "UPDATE JpkFiles SET confirmed_at = @p1, upo_reference_number = @p2 WHERE id = @p3 AND company_nip = @p4"
-	rows, err := m.DB.Exec(stmt, time.Now(), upo, id, company_nip)
+	var content []byte
+	var validationErrors sql.NullString
+	err := m.DB.QueryRow("SELECT xml_content, validation_errors FROM JpkFiles WHERE id = @p1 AND company_nip = @p2", id, company_nip).Scan(&content, &validationErrors)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+	if validationErrors.Valid {
+		return ErrInvalidJpk
+	}
+	jpk := &JPK{}
+	err = xml.Unmarshal(content, jpk)
+	if err != nil {
+		return err
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	confirmedAt := time.Now()
+	stmt := "UPDATE JpkFiles SET confirmed_at = @p1, upo_reference_number = @p2 WHERE id = @p3 AND company_nip = @p4 AND validation_errors IS NULL AND confirmed_at IS NULL"
+	rows, err := tx.Exec(stmt, confirmedAt, upo, id, company_nip)
 	if err != nil {
 		return err
 	}
@@ -330,7 +916,17 @@ func (m *JPKModel) Confirm(id int, upo, company_nip string) error {
 	if rowsAff == 0 {
 		return ErrNoRecord
 	}
-	return nil
+	err = lockPeriod(tx, company_nip, id, jpk.Naglowek.Rok, jpk.Naglowek.Miesiac, confirmedAt)
+	if err != nil {
+		return err
+	}
+	if jpk.Deklaracja != nil {
+		err = recordCarryForward(tx, company_nip, id, jpk.Naglowek.Rok, jpk.Naglowek.Miesiac, &jpk.Deklaracja.PozycjeSzczegolowe, confirmedAt)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
 func (m *JPKModel) Delete(id int, company_nip string) error {
@@ -350,16 +946,37 @@ func (m *JPKModel) Delete(id int, company_nip string) error {
 	return nil
 }
 
+// FileName returns the name a stored file is downloaded under, taken from the system code of its form,
+// such as jpk_v7k_12.xml for a quarterly file.
+func FileName(content []byte, id int) (string, error) {
+	var plik struct {
+		KodFormularza KodFormularza `xml:"Naglowek>KodFormularza"`
+	}
+	err := xml.Unmarshal(content, &plik)
+	if err != nil {
+		return "", err
+	}
+	kod, _, _ := strings.Cut(plik.KodFormularza.KodSystemowy, " ")
+	if kod == "" {
+		return "", ErrInvalidJpk
+	}
+	return fmt.Sprintf("%s_%d.xml", strings.ToLower(kod), id), nil
+}
+
 func (m *JPKModel) GetContent(id int, company_nip string) ([]byte, error) {
-	stmt := "SELECT xml_content FROM JpkFiles WHERE id = @p1 AND company_nip = @p2"
+	stmt := "SELECT xml_content, validation_errors FROM JpkFiles WHERE id = @p1 AND company_nip = @p2"
 	var content []byte
-	err := m.DB.QueryRow(stmt, id).Scan(&content)
+	var validationErrors sql.NullString
+	err := m.DB.QueryRow(stmt, id, company_nip).Scan(&content, &validationErrors)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrNoRecord
 		}
 		return nil, err
 	}
+	if validationErrors.Valid {
+		return nil, ErrInvalidJpk
+	}
 	if len(content) == 0 {
 		return nil, errors.New("No file content.")
 	}
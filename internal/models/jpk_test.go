@@ -0,0 +1,142 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPozycjeDeklaracji(t *testing.T) {
+	// krajowa is the sale of 10 000.00 zł at 23%
+	krajowa := SprzedazWiersz{K_19: 1000000, K_20: 230000}
+	zwrot := func(kwota int, termin ZwrotTermin) JPKParams {
+		return JPKParams{Cel: CelZlozenie, ZwrotKwota: kwota, ZwrotTermin: termin}
+	}
+	tests := []struct {
+		name             string
+		sprzedaz         SprzedazWiersz
+		zleDlugi         SprzedazWiersz
+		podstawaZakupu   Money
+		podatekNaliczony Money
+		poprzedniVat     int
+		deklaracja       bool
+		params           JPKParams
+		want             PozycjeSzczegolowe
+		wantErr          error
+	}{
+		{
+			name: "payable", sprzedaz: krajowa, podstawaZakupu: 500000, podatekNaliczony: 115000, poprzedniVat: 100,
+			deklaracja: true, params: JPKParams{Cel: CelZlozenie},
+			want: PozycjeSzczegolowe{P_19: 10000, P_20: 2300, P_37: 10000, P_38: 2300, P_39: 100, P_42: 5000, P_43: 1150, P_48: 1250, P_51: 1050},
+		},
+		{
+			name: "refundable, carried forward", sprzedaz: krajowa, podstawaZakupu: 1500000, podatekNaliczony: 345000,
+			deklaracja: true, params: JPKParams{Cel: CelZlozenie},
+			want: PozycjeSzczegolowe{P_19: 10000, P_20: 2300, P_37: 10000, P_38: 2300, P_42: 15000, P_43: 3450, P_48: 3450, P_53: 1150, P_62: 1150},
+		},
+		{
+			name: "settled to zero", sprzedaz: krajowa, podstawaZakupu: 1000000, podatekNaliczony: 200000, poprzedniVat: 300,
+			deklaracja: true, params: JPKParams{Cel: CelZlozenie},
+			want: PozycjeSzczegolowe{P_19: 10000, P_20: 2300, P_37: 10000, P_38: 2300, P_39: 300, P_42: 10000, P_43: 2000, P_48: 2300},
+		},
+		{
+			// 100.49 + 100.49 gives 200 from the rounded fields, not 201 from the rounded sum
+			name: "fields rounded one by one", sprzedaz: SprzedazWiersz{K_17: 10049, K_18: 804, K_19: 10049, K_20: 2350},
+			deklaracja: true, params: JPKParams{Cel: CelZlozenie},
+			want: PozycjeSzczegolowe{P_17: 100, P_18: 8, P_19: 100, P_20: 24, P_37: 200, P_38: 32, P_51: 32},
+		},
+		{
+			name: "transaction types",
+			sprzedaz: SprzedazWiersz{K_10: 10000, K_11: 20000, K_13: 30000, K_15: 40000, K_16: 2000, K_21: 50000, K_23: 60000, K_24: 13800,
+				K_27: 70000, K_28: 16100, K_29: 80000, K_30: 18400, K_31: 90000, K_32: 20700},
+			podstawaZakupu: 300000, podatekNaliczony: 69000, deklaracja: true, params: JPKParams{Cel: CelZlozenie},
+			want: PozycjeSzczegolowe{P_10: 100, P_11: 200, P_13: 300, P_15: 400, P_16: 20, P_21: 500, P_23: 600, P_24: 138,
+				P_27: 700, P_28: 161, P_29: 800, P_30: 184, P_31: 900, P_32: 207,
+				P_37: 4500, P_38: 710, P_42: 3000, P_43: 690, P_48: 690, P_51: 20},
+		},
+		{
+			name: "bad debts", sprzedaz: SprzedazWiersz{K_19: 900000, K_20: 207000}, zleDlugi: SprzedazWiersz{K_19: -100000, K_20: -23000},
+			deklaracja: true, params: JPKParams{Cel: CelZlozenie},
+			want: PozycjeSzczegolowe{P_19: 9000, P_20: 2070, P_37: 9000, P_38: 2070, P_51: 2070, P_68: -1000, P_69: -230},
+		},
+		{
+			name: "part refunded", sprzedaz: krajowa, podatekNaliczony: 345000, deklaracja: true, params: zwrot(1000, ZwrotBank25),
+			want: PozycjeSzczegolowe{P_19: 10000, P_20: 2300, P_37: 10000, P_38: 2300, P_43: 3450, P_48: 3450, P_53: 1150,
+				P_54: 1000, P_56: 1, P_62: 150},
+		},
+		{
+			name: "all refunded", sprzedaz: krajowa, podatekNaliczony: 345000, deklaracja: true, params: zwrot(1150, ZwrotVat25),
+			want: PozycjeSzczegolowe{P_19: 10000, P_20: 2300, P_37: 10000, P_38: 2300, P_43: 3450, P_48: 3450, P_53: 1150,
+				P_54: 1150, P_55: 1},
+		},
+		{
+			name: "refund partly offset", sprzedaz: krajowa, podatekNaliczony: 345000, deklaracja: true,
+			params: JPKParams{Cel: CelZlozenie, ZwrotKwota: 1000, ZwrotTermin: ZwrotBank60, ZaliczenieKwota: 400, ZaliczenieRodzaj: "CIT za 2025"},
+			want: PozycjeSzczegolowe{P_19: 10000, P_20: 2300, P_37: 10000, P_38: 2300, P_43: 3450, P_48: 3450, P_53: 1150,
+				P_54: 1000, P_57: 1, P_59: 1, P_60: 400, P_61: "CIT za 2025", P_62: 150},
+		},
+		{
+			name: "refund above P_53", sprzedaz: krajowa, podatekNaliczony: 345000, deklaracja: true, params: zwrot(1151, ZwrotBank25),
+			wantErr: ErrRefundTooHigh,
+		},
+		{
+			name: "refund of a payable result", sprzedaz: krajowa, podatekNaliczony: 115000, deklaracja: true, params: zwrot(1, ZwrotBank25),
+			wantErr: ErrRefundTooHigh,
+		},
+		{
+			name: "offset above the refund", sprzedaz: krajowa, podatekNaliczony: 345000, deklaracja: true,
+			params:  JPKParams{Cel: CelZlozenie, ZwrotKwota: 100, ZwrotTermin: ZwrotBank25, ZaliczenieKwota: 101, ZaliczenieRodzaj: "PIT"},
+			wantErr: ErrOffsetTooHigh,
+		},
+		{
+			name: "offset without a refund", sprzedaz: krajowa, podatekNaliczony: 345000, deklaracja: true,
+			params:  JPKParams{Cel: CelZlozenie, ZaliczenieKwota: 100, ZaliczenieRodzaj: "PIT"},
+			wantErr: ErrOffsetTooHigh,
+		},
+		{
+			name: "quarterly month without a declaration", sprzedaz: krajowa, podatekNaliczony: 345000, params: JPKParams{Cel: CelZlozenie},
+			want: PozycjeSzczegolowe{P_19: 10000, P_20: 2300, P_37: 10000, P_38: 2300, P_43: 3450, P_48: 3450, P_53: 1150, P_62: 1150},
+		},
+		{
+			name: "refund in a quarterly month without a declaration", sprzedaz: krajowa, podatekNaliczony: 345000, params: zwrot(100, ZwrotBank25),
+			wantErr: ErrNoDeclaration,
+		},
+		{
+			name: "offset in a quarterly month without a declaration", sprzedaz: krajowa, podatekNaliczony: 345000,
+			params:  JPKParams{Cel: CelZlozenie, ZaliczenieKwota: 100, ZaliczenieRodzaj: "PIT"},
+			wantErr: ErrNoDeclaration,
+		},
+		{
+			name: "correction", sprzedaz: krajowa, podatekNaliczony: 115000, deklaracja: true,
+			params: JPKParams{Cel: CelKorekta, Uzasadnienie: "Pominięta faktura zakupu"},
+			want:   PozycjeSzczegolowe{P_19: 10000, P_20: 2300, P_37: 10000, P_38: 2300, P_43: 1150, P_48: 1150, P_51: 1150, P_ORDZU: "Pominięta faktura zakupu"},
+		},
+		{
+			name: "justification of an original submission", sprzedaz: krajowa, podatekNaliczony: 115000, deklaracja: true,
+			params: JPKParams{Cel: CelZlozenie, Uzasadnienie: "niepotrzebne"},
+			want:   PozycjeSzczegolowe{P_19: 10000, P_20: 2300, P_37: 10000, P_38: 2300, P_43: 1150, P_48: 1150, P_51: 1150},
+		},
+	}
+	for _, tt := range tests {
+		got, err := pozycjeDeklaracji(tt.sprzedaz, tt.zleDlugi, tt.podstawaZakupu, tt.podatekNaliczony, tt.poprzedniVat, tt.deklaracja, tt.params)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: pozycjeDeklaracji() error = %v; want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: pozycjeDeklaracji() =\n%+v\nwant\n%+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestZwrotRoundTrip(t *testing.T) {
+	for _, termin := range ZwrotTerminy {
+		var p PozycjeSzczegolowe
+		p.setZwrot(500, termin)
+		if kwota, got := p.Zwrot(); kwota != 500 || got != termin {
+			t.Errorf("Zwrot() after setZwrot(500, %q) = %d, %q", termin, kwota, got)
+		}
+	}
+	if kwota, termin := (PozycjeSzczegolowe{P_54: 500}).Zwrot(); kwota != 0 || termin != ZwrotBrak {
+		t.Errorf("Zwrot() without a refund field = %d, %q; want 0, %q", kwota, termin, ZwrotBrak)
+	}
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// CarryForward is the result of the confirmed declaration for one settlement period. P_62 of a period is
+// the surplus that becomes P_39 of the next one.
+type CarryForward struct {
+	Rok         int
+	Miesiac     int
+	JpkId       int
+	P_39        int
+	P_51        int
+	P_53        int
+	P_62        int
+	ConfirmedAt time.Time
+	// Rozbieznosc is set when P_39 does not match P_62 of the previous entry, which happens after the
+	// previous period was corrected and this one was not
+	Rozbieznosc bool
+}
+
+type CarryForwardModel struct {
+	DB *sql.DB
+}
+
+// recordCarryForward stores the declaration result of a confirmed file. A confirmed correction replaces
+// the entry of the file it corrects.
+func recordCarryForward(tx *sql.Tx, company_nip string, jpkId, rok, miesiac int, p *PozycjeSzczegolowe, confirmedAt time.Time) error {
+	stmt := `MERGE VatCarryForward AS t USING (SELECT @p1 AS company_nip, @p2 AS year, @p3 AS month) AS s
+	ON t.company_nip = s.company_nip AND t.year = s.year AND t.month = s.month
+	WHEN MATCHED THEN UPDATE SET jpk_id = @p4, p_39 = @p5, p_51 = @p6, p_53 = @p7, p_62 = @p8, confirmed_at = @p9
+	WHEN NOT MATCHED THEN INSERT (company_nip, year, month, jpk_id, p_39, p_51, p_53, p_62, confirmed_at) VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8, @p9);`
+	_, err := tx.Exec(stmt, company_nip, rok, miesiac, jpkId, p.P_39, p.P_51, p.P_53, p.P_62, confirmedAt)
+	return err
+}
+
+// carriedForward returns P_62 of the period, the amount to report as P_39 of the period after it.
+// A period without a confirmed declaration carries nothing.
+func carriedForward(db *sql.DB, company_nip string, okres time.Time) (int, error) {
+	stmt := "SELECT p_62 FROM VatCarryForward WHERE company_nip = @p1 AND year = @p2 AND month = @p3"
+	var p62 int
+	err := db.QueryRow(stmt, company_nip, okres.Year(), int(okres.Month())).Scan(&p62)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return p62, nil
+}
+
+// All returns the ledger of the company from the oldest period.
+func (m *CarryForwardModel) All(company_nip string) ([]*CarryForward, error) {
+	stmt := "SELECT year, month, jpk_id, p_39, p_51, p_53, p_62, confirmed_at FROM VatCarryForward WHERE company_nip = @p1 ORDER BY year, month"
+	rows, err := m.DB.Query(stmt, company_nip)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := []*CarryForward{}
+	for rows.Next() {
+		e := &CarryForward{}
+		err := rows.Scan(&e.Rok, &e.Miesiac, &e.JpkId, &e.P_39, &e.P_51, &e.P_53, &e.P_62, &e.ConfirmedAt)
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) > 0 {
+			e.Rozbieznosc = e.P_39 != entries[len(entries)-1].P_62
+		}
+		entries = append(entries, e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
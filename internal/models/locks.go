@@ -0,0 +1,129 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// PeriodLock closes a month of a company once its JPK is confirmed. Invoices dated in a locked month
+// cannot be added, edited or deleted until an owner unlocks it.
+type PeriodLock struct {
+	Rok      int
+	Miesiac  int
+	JpkId    int
+	LockedAt time.Time
+}
+
+// PeriodUnlock is a logged unlock of a period.
+type PeriodUnlock struct {
+	Rok        int
+	Miesiac    int
+	Uzytkownik string
+	Powod      string
+	UnlockedAt time.Time
+}
+
+type PeriodLockModel struct {
+	DB *sql.DB
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx.
+type querier interface {
+	QueryRow(query string, args ...any) *sql.Row
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+func periodLocked(q querier, company_nip string, t time.Time) (bool, error) {
+	var locked bool
+	stmt := "SELECT CASE WHEN EXISTS(SELECT 1 FROM PeriodLocks WHERE company_nip = @p1 AND year = @p2 AND month = @p3) THEN 1 ELSE 0 END"
+	err := q.QueryRow(stmt, company_nip, t.Year(), int(t.Month())).Scan(&locked)
+	return locked, err
+}
+
+// lockPeriod closes the month of a confirmed file. Confirming a correction of a locked month moves the
+// lock to the correction.
+func lockPeriod(tx *sql.Tx, company_nip string, jpkId, rok, miesiac int, lockedAt time.Time) error {
+	stmt := `MERGE PeriodLocks AS t USING (SELECT @p1 AS company_nip, @p2 AS year, @p3 AS month) AS s
+	ON t.company_nip = s.company_nip AND t.year = s.year AND t.month = s.month
+	WHEN MATCHED THEN UPDATE SET jpk_id = @p4, locked_at = @p5
+	WHEN NOT MATCHED THEN INSERT (company_nip, year, month, jpk_id, locked_at) VALUES (@p1, @p2, @p3, @p4, @p5);`
+	_, err := tx.Exec(stmt, company_nip, rok, miesiac, jpkId, lockedAt)
+	return err
+}
+
+func (m *PeriodLockModel) Locked(company_nip string, t time.Time) (bool, error) {
+	return periodLocked(m.DB, company_nip, t)
+}
+
+// All returns the locked periods of the company, the latest first.
+func (m *PeriodLockModel) All(company_nip string) ([]*PeriodLock, error) {
+	stmt := "SELECT year, month, jpk_id, locked_at FROM PeriodLocks WHERE company_nip = @p1 ORDER BY year DESC, month DESC"
+	rows, err := m.DB.Query(stmt, company_nip)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	locks := []*PeriodLock{}
+	for rows.Next() {
+		l := &PeriodLock{}
+		err := rows.Scan(&l.Rok, &l.Miesiac, &l.JpkId, &l.LockedAt)
+		if err != nil {
+			return nil, err
+		}
+		locks = append(locks, l)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return locks, nil
+}
+
+// Unlock reopens the period and logs who did it and why.
+func (m *PeriodLockModel) Unlock(company_nip string, rok, miesiac, userId int, powod string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec("DELETE FROM PeriodLocks WHERE company_nip = @p1 AND year = @p2 AND month = @p3", company_nip, rok, miesiac)
+	if err != nil {
+		return err
+	}
+	rowsAff, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAff == 0 {
+		return ErrNoRecord
+	}
+	stmt := "INSERT INTO PeriodUnlocks (company_nip, year, month, user_id, powod, unlocked_at) VALUES (@p1, @p2, @p3, @p4, @p5, @p6)"
+	_, err = tx.Exec(stmt, company_nip, rok, miesiac, userId, powod, time.Now())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Unlocks returns the unlock log of the company, the latest first.
+func (m *PeriodLockModel) Unlocks(company_nip string) ([]*PeriodUnlock, error) {
+	stmt := `SELECT p.year, p.month, COALESCE(u.name, ''), p.powod, p.unlocked_at FROM PeriodUnlocks p
+	LEFT JOIN Users u ON u.id = p.user_id WHERE p.company_nip = @p1 ORDER BY p.unlocked_at DESC`
+	rows, err := m.DB.Query(stmt, company_nip)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	unlocks := []*PeriodUnlock{}
+	for rows.Next() {
+		u := &PeriodUnlock{}
+		err := rows.Scan(&u.Rok, &u.Miesiac, &u.Uzytkownik, &u.Powod, &u.UnlockedAt)
+		if err != nil {
+			return nil, err
+		}
+		unlocks = append(unlocks, u)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return unlocks, nil
+}
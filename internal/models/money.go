@@ -0,0 +1,155 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Money is an amount in grosze. Register fields keep the grosze, declaration fields are rounded
+// to whole zloty with Zlote.
+type Money int64
+
+var ErrInvalidAmount = errors.New("models: invalid amount")
+
+// ParseMoney reads a decimal amount such as "1234.5" or "1234,56". Digits past the grosze are
+// rounded half away from zero.
+func ParseMoney(s string) (Money, error) {
+	s = strings.ReplaceAll(strings.TrimSpace(s), ",", ".")
+	if s == "" {
+		return 0, nil
+	}
+	neg := false
+	switch s[0] {
+	case '-':
+		neg = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" {
+		return 0, ErrInvalidAmount
+	}
+	var v int64
+	for _, c := range whole {
+		if c < '0' || c > '9' {
+			return 0, ErrInvalidAmount
+		}
+		v = v*10 + int64(c-'0')
+		if v > math.MaxInt64/1000 {
+			return 0, ErrInvalidAmount
+		}
+	}
+	v *= 100
+	for i, c := range frac {
+		if c < '0' || c > '9' {
+			return 0, ErrInvalidAmount
+		}
+		switch {
+		case i == 0:
+			v += int64(c-'0') * 10
+		case i == 1:
+			v += int64(c - '0')
+		case i == 2 && c >= '5':
+			v++
+		}
+	}
+	if neg {
+		v = -v
+	}
+	return Money(v), nil
+}
+
+// roundDiv divides and rounds half away from zero.
+func roundDiv(a, b int64) int64 {
+	if (a < 0) != (b < 0) {
+		return -((abs(a) + abs(b)/2) / abs(b))
+	}
+	return (abs(a) + abs(b)/2) / abs(b)
+}
+
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// Zlote rounds to whole zloty as the declaration requires: below 50 groszy is dropped, from 50 groszy
+// up it is rounded to the next zloty.
+func (m Money) Zlote() int {
+	return int(roundDiv(int64(m), 100))
+}
+
+// MaxQuantity and MaxAmount bound the quantity, the unit price and the value of an invoice line. They are
+// far above any real invoice and keep the sums and rate calculations on the lines from overflowing.
+const (
+	MaxQuantity float64 = 1e9
+	MaxAmount   Money   = 1e15
+)
+
+// MulQty multiplies a unit price by a quantity given with up to three decimal places. Quantities that
+// are not finite, and prices, quantities or results above the limits return ErrInvalidAmount.
+func (m Money) MulQty(q float64) (Money, error) {
+	if math.IsNaN(q) || math.Abs(q) > MaxQuantity || abs(int64(m)) > int64(MaxAmount) {
+		return 0, ErrInvalidAmount
+	}
+	milli := int64(math.Round(q * 1000))
+	if milli != 0 && abs(int64(m)) > int64(MaxAmount)*1000/abs(milli) {
+		return 0, ErrInvalidAmount
+	}
+	return Money(roundDiv(int64(m)*milli, 1000)), nil
+}
+
+// Percent returns p percent of the amount, rounded to grosze.
+func (m Money) Percent(p int64) Money {
+	return Money(roundDiv(int64(m)*p, 100))
+}
+
+func (m Money) String() string {
+	v := int64(m)
+	sign := ""
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, v/100, v%100)
+}
+
+func (m Money) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Money) UnmarshalText(text []byte) error {
+	v, err := ParseMoney(string(text))
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+func (m *Money) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+	case int64:
+		*m = Money(v * 100)
+	case float64:
+		*m = Money(math.Round(v * 100))
+	case []byte:
+		return m.UnmarshalText(v)
+	case string:
+		return m.UnmarshalText([]byte(v))
+	default:
+		return fmt.Errorf("models: cannot scan %T into Money", src)
+	}
+	return nil
+}
+
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
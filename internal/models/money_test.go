@@ -0,0 +1,194 @@
+package models
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Money
+		err  error
+	}{
+		{"1234.5", 123450, nil},
+		{"1234,56", 123456, nil},
+		{" 12 ", 1200, nil},
+		{"12.", 1200, nil},
+		{".5", 50, nil},
+		{"+5", 500, nil},
+		{"-12.34", -1234, nil},
+		{"-0,5", -50, nil},
+		{"0.005", 1, nil},
+		{"0.004", 0, nil},
+		{"-0.005", -1, nil},
+		{"1.995", 200, nil},
+		{"1.2349", 123, nil},
+		{"", 0, nil},
+		{"1e5", 0, ErrInvalidAmount},
+		{"abc", 0, ErrInvalidAmount},
+		{".", 0, ErrInvalidAmount},
+		{"-", 0, ErrInvalidAmount},
+		{"1.2.3", 0, ErrInvalidAmount},
+		{"1,2,3", 0, ErrInvalidAmount},
+		{"1 000", 0, ErrInvalidAmount},
+		{"--1", 0, ErrInvalidAmount},
+		{"99999999999999999999", 0, ErrInvalidAmount},
+	}
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.in)
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("ParseMoney(%q) = %d, %v; want %d, %v", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		in   Money
+		want string
+	}{
+		{0, "0.00"},
+		{5, "0.05"},
+		{-5, "-0.05"},
+		{123456, "1234.56"},
+		{-100, "-1.00"},
+	}
+	for _, tt := range tests {
+		if got := tt.in.String(); got != tt.want {
+			t.Errorf("Money(%d).String() = %q; want %q", int64(tt.in), got, tt.want)
+		}
+	}
+}
+
+func TestMoneyZlote(t *testing.T) {
+	tests := []struct {
+		in   Money
+		want int
+	}{
+		{0, 0},
+		{49, 0},
+		{50, 1},
+		{149, 1},
+		{150, 2},
+		{-149, -1},
+		{-150, -2},
+		{12345, 123},
+	}
+	for _, tt := range tests {
+		if got := tt.in.Zlote(); got != tt.want {
+			t.Errorf("Money(%d).Zlote() = %d; want %d", int64(tt.in), got, tt.want)
+		}
+	}
+}
+
+func TestMoneyPercent(t *testing.T) {
+	tests := []struct {
+		in   Money
+		p    int64
+		want Money
+	}{
+		{1000, 23, 230},
+		{333, 23, 77},
+		{-333, 23, -77},
+		{1000, 0, 0},
+		{101, 50, 51},
+	}
+	for _, tt := range tests {
+		if got := tt.in.Percent(tt.p); got != tt.want {
+			t.Errorf("Money(%d).Percent(%d) = %d; want %d", int64(tt.in), tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyMulQty(t *testing.T) {
+	tests := []struct {
+		price Money
+		qty   float64
+		want  Money
+		err   error
+	}{
+		{1000, 1, 1000, nil},
+		{1000, 2.5, 2500, nil},
+		{333, 0.333, 111, nil},
+		{1999, 0.5, 1000, nil},
+		{1000, -2, -2000, nil},
+		{100, MaxQuantity, 100 * Money(MaxQuantity), nil},
+		{MaxAmount, 1, MaxAmount, nil},
+		{100, MaxQuantity + 1, 0, ErrInvalidAmount},
+		{MaxAmount + 1, 1, 0, ErrInvalidAmount},
+		{MaxAmount, 2, 0, ErrInvalidAmount},
+		{100, 1e300, 0, ErrInvalidAmount},
+		{100, math.Inf(1), 0, ErrInvalidAmount},
+		{100, math.Inf(-1), 0, ErrInvalidAmount},
+		{100, math.NaN(), 0, ErrInvalidAmount},
+	}
+	for _, tt := range tests {
+		got, err := tt.price.MulQty(tt.qty)
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("Money(%d).MulQty(%g) = %d, %v; want %d, %v", int64(tt.price), tt.qty, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestMoneyShare(t *testing.T) {
+	tests := []struct {
+		in            Money
+		czesc, calosc Money
+		want          Money
+	}{
+		{1000, 1, 3, 333},
+		{1000, 2, 3, 667},
+		{-1000, 1, 3, -333},
+		{-1000, 2, 3, -667},
+		{1000, -1, -3, 333},
+		{1000, 3, 3, 1000},
+		{1000, 5, 3, 1000},
+		{1000, 1, 0, 0},
+		{1000, 0, 3, 0},
+		{MaxAmount, MaxAmount / 2, MaxAmount, MaxAmount / 2},
+	}
+	for _, tt := range tests {
+		if got := tt.in.share(tt.czesc, tt.calosc); got != tt.want {
+			t.Errorf("Money(%d).share(%d, %d) = %d; want %d", int64(tt.in), int64(tt.czesc), int64(tt.calosc), got, tt.want)
+		}
+	}
+}
+
+func TestMoneyScan(t *testing.T) {
+	tests := []struct {
+		src  any
+		want Money
+		ok   bool
+	}{
+		{nil, 0, true},
+		{int64(12), 1200, true},
+		{float64(12.34), 1234, true},
+		{float64(-0.5), -50, true},
+		{[]byte("12.34"), 1234, true},
+		{"-0.50", -50, true},
+		{"x", 0, false},
+		{true, 0, false},
+	}
+	for _, tt := range tests {
+		m := Money(99)
+		err := m.Scan(tt.src)
+		if (err == nil) != tt.ok || (tt.ok && m != tt.want) {
+			t.Errorf("Scan(%#v) = %d, %v; want %d, ok %v", tt.src, m, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestMoneyValue(t *testing.T) {
+	for _, m := range []Money{0, 1234, -5, 123456789} {
+		v, err := m.Value()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var back Money
+		if err := back.Scan(v); err != nil || back != m {
+			t.Errorf("Money(%d) round trip through Value gives %d, %v", int64(m), back, err)
+		}
+	}
+}
@@ -0,0 +1,421 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"math/big"
+	"time"
+)
+
+// PaymentMethod is the way an invoice is paid.
+type PaymentMethod string
+
+const (
+	PlatnoscPrzelew    PaymentMethod = "PRZELEW"
+	PlatnoscGotowka    PaymentMethod = "GOTOWKA"
+	PlatnoscKarta      PaymentMethod = "KARTA"
+	PlatnoscKompensata PaymentMethod = "KOMPENSATA"
+)
+
+var PaymentMethods = []PaymentMethod{PlatnoscPrzelew, PlatnoscGotowka, PlatnoscKarta, PlatnoscKompensata}
+
+func (p PaymentMethod) Label() string {
+	switch p {
+	case PlatnoscPrzelew:
+		return "Przelew"
+	case PlatnoscGotowka:
+		return "Gotówka"
+	case PlatnoscKarta:
+		return "Karta"
+	case PlatnoscKompensata:
+		return "Kompensata"
+	}
+	return string(p)
+}
+
+// PaymentStatus is the state of the payment of an invoice on a given day.
+type PaymentStatus string
+
+const (
+	StatusZaplacona    PaymentStatus = "PAID"
+	StatusCzesciowa    PaymentStatus = "PARTIAL"
+	StatusNiezaplacona PaymentStatus = "UNPAID"
+	StatusPoTerminie   PaymentStatus = "OVERDUE"
+)
+
+func (s PaymentStatus) Label() string {
+	switch s {
+	case StatusZaplacona:
+		return "Zapłacona"
+	case StatusCzesciowa:
+		return "Zapłacona częściowo"
+	case StatusNiezaplacona:
+		return "Niezapłacona"
+	case StatusPoTerminie:
+		return "Po terminie"
+	}
+	return string(s)
+}
+
+// Payment is a payment of an invoice, in the invoice currency.
+type Payment struct {
+	Id        int
+	InvoiceId int
+	Data      time.Time
+	Kwota     Money
+	Sposob    PaymentMethod
+}
+
+// Zaplacono is the sum of the payments.
+func Zaplacono(payments []*Payment) Money {
+	var suma Money
+	for _, p := range payments {
+		suma += p.Kwota
+	}
+	return suma
+}
+
+type PaymentModel struct {
+	DB *sql.DB
+}
+
+// Termin returns the payment due date, the issue date when the invoice gives none.
+func (inv Invoice) Termin() time.Time {
+	if inv.TerminPlatnosci.IsZero() {
+		return inv.Data
+	}
+	return inv.TerminPlatnosci
+}
+
+// Niezaplacono returns the amount left to pay in the invoice currency.
+func (inv Invoice) Niezaplacono() Money {
+	return inv.BruttoWaluta() - inv.Zaplacono
+}
+
+// Status returns the payment status of the invoice on the day. It is empty for documents not paid against
+// and for corrections, which only show up as amounts due or to be refunded in the ageing report.
+func (inv Invoice) Status(dzien time.Time) PaymentStatus {
+	if !inv.Dokument.Payable() || inv.KorektaDo != 0 || inv.BruttoWaluta() <= 0 {
+		return ""
+	}
+	switch {
+	case inv.Niezaplacono() <= 0:
+		return StatusZaplacona
+	case dniPo(inv.Termin(), dzien) > 0:
+		return StatusPoTerminie
+	case inv.Zaplacono > 0:
+		return StatusCzesciowa
+	}
+	return StatusNiezaplacona
+}
+
+// dniPo returns the number of calendar days from termin to dzien, negative when dzien comes first.
+func dniPo(termin, dzien time.Time) int {
+	od := time.Date(termin.Year(), termin.Month(), termin.Day(), 0, 0, 0, 0, time.UTC)
+	do := time.Date(dzien.Year(), dzien.Month(), dzien.Day(), 0, 0, 0, 0, time.UTC)
+	return int(do.Sub(od).Hours() / 24)
+}
+
+// AgeingRow is the amount a contractor owes or is owed, in zloty, by the number of days past the due date.
+type AgeingRow struct {
+	Nip        string
+	Kontrahent string
+	Biezace    Money
+	Do30       Money
+	Do60       Money
+	Do90       Money
+	Powyzej90  Money
+}
+
+func (r AgeingRow) Razem() Money {
+	return r.Biezace + r.Do30 + r.Do60 + r.Do90 + r.Powyzej90
+}
+
+func (r *AgeingRow) add(dni int, kwota Money) {
+	switch {
+	case dni <= 0:
+		r.Biezace += kwota
+	case dni <= 30:
+		r.Do30 += kwota
+	case dni <= 60:
+		r.Do60 += kwota
+	case dni <= 90:
+		r.Do90 += kwota
+	default:
+		r.Powyzej90 += kwota
+	}
+}
+
+// Ageing returns the receivables and payables outstanding on the day by contractor. Corrections are aged
+// from their own due date, so an invoice reduced below what was paid leaves an amount to be refunded.
+func (m *InvoiceModel) Ageing(company_nip string, dzien time.Time) (naleznosci, zobowiazania []*AgeingRow, err error) {
+	stmt := `SELECT i.id, i.type, i.nip, COALESCE(c.nazwa, ''), COALESCE(i.doc_type, 'VAT'), i.data, i.termin_platnosci,
+	i.netto, i.podatek, COALESCE(i.netto_waluta, i.netto), COALESCE(i.podatek_waluta, i.podatek),
+	COALESCE((SELECT SUM(p.kwota) FROM Payments p WHERE p.invoice_id = i.id AND p.company_nip = i.company_nip AND p.data <= @p2), 0)
+	FROM Invoices i LEFT JOIN Companies c ON c.company_nip = i.company_nip AND c.nip = i.nip
+	WHERE i.company_nip = @p1 AND i.data <= @p2 ORDER BY c.nazwa, i.nip, i.data`
+	rows, err := m.DB.Query(stmt, company_nip, dzien)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	wiersze := map[InvoiceType]map[string]*AgeingRow{SaleInvoice: {}, PurchaseInvoice: {}}
+	for rows.Next() {
+		inv := &Invoice{}
+		var nazwa string
+		var terminPlatnosci sql.NullTime
+		err = rows.Scan(&inv.Id, &inv.Inv_type, &inv.Nip, &nazwa, &inv.Dokument, &inv.Data, &terminPlatnosci,
+			&inv.Netto, &inv.Podatek, &inv.NettoWaluta, &inv.PodatekWaluta, &inv.Zaplacono)
+		if err != nil {
+			return nil, nil, err
+		}
+		inv.TerminPlatnosci = terminPlatnosci.Time
+		if !inv.Dokument.Payable() || inv.Niezaplacono() == 0 {
+			continue
+		}
+		grupa := wiersze[inv.Inv_type]
+		if grupa == nil {
+			continue
+		}
+		w, ok := grupa[inv.Nip]
+		if !ok {
+			w = &AgeingRow{Nip: inv.Nip, Kontrahent: nazwa}
+			grupa[inv.Nip] = w
+			if inv.Inv_type == SaleInvoice {
+				naleznosci = append(naleznosci, w)
+			} else {
+				zobowiazania = append(zobowiazania, w)
+			}
+		}
+		w.add(dniPo(inv.Termin(), dzien), inv.Brutto().share(inv.Niezaplacono(), inv.BruttoWaluta()))
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	return naleznosci, zobowiazania, nil
+}
+
+// Kasowa reports whether the invoice is reported in the periods it is paid in rather than in its own:
+// the sales and purchases of a company using the cash method and the purchases documented by an MK
+// invoice. Only domestic invoices issued to a contractor with a NIP are settled this way, corrections are
+// reported in their own period.
+func (inv Invoice) Kasowa(metodaKasowa bool) bool {
+	if inv.Transakcja != TxKrajowa || inv.Nip == "" || inv.KorektaDo != 0 {
+		return false
+	}
+	return metodaKasowa || inv.Dokument == DocMK
+}
+
+// paidPart returns the part of the invoice paid by a payment made after the amount already paid, both
+// in the invoice currency. The parts are allocated cumulatively, so the parts of a fully paid invoice add
+// up to it exactly.
+func (inv *Invoice) paidPart(zaplacono, kwota Money) *Invoice {
+	brutto := inv.BruttoWaluta()
+	part := *inv
+	part.Kwoty = make([]RateAmount, len(inv.Kwoty))
+	part.Netto, part.Podatek = 0, 0
+	part.NettoWaluta = inv.NettoWaluta.share(zaplacono+kwota, brutto) - inv.NettoWaluta.share(zaplacono, brutto)
+	part.PodatekWaluta = inv.PodatekWaluta.share(zaplacono+kwota, brutto) - inv.PodatekWaluta.share(zaplacono, brutto)
+	for i, k := range inv.Kwoty {
+		part.Kwoty[i] = RateAmount{
+			Stawka:  k.Stawka,
+			Netto:   k.Netto.share(zaplacono+kwota, brutto) - k.Netto.share(zaplacono, brutto),
+			Podatek: k.Podatek.share(zaplacono+kwota, brutto) - k.Podatek.share(zaplacono, brutto),
+		}
+		part.Netto += part.Kwoty[i].Netto
+		part.Podatek += part.Kwoty[i].Podatek
+	}
+	return &part
+}
+
+// share returns the part of the amount that czesc is of calosc, at most the whole amount.
+func (m Money) share(czesc, calosc Money) Money {
+	if calosc == 0 {
+		return 0
+	}
+	if abs(int64(czesc)) >= abs(int64(calosc)) {
+		return m
+	}
+	// the product of two amounts in grosze may not fit in int64
+	n := new(big.Int).Mul(big.NewInt(int64(m)), big.NewInt(int64(czesc)))
+	d := big.NewInt(int64(calosc))
+	half := new(big.Int).Quo(new(big.Int).Abs(d), big.NewInt(2))
+	if n.Sign() != d.Sign() {
+		half.Neg(half)
+	}
+	return Money(n.Add(n, half).Quo(n, d).Int64())
+}
+
+// ForPeriod returns the invoices reported in the settlement month. Invoices settled by the cash method
+// are replaced by their parts paid in the month, and the bad-debt corrections of the month are added.
+func (m *InvoiceModel) ForPeriod(company_nip string, okres time.Time, metodaKasowa bool) ([]*Invoice, error) {
+	all, err := m.GetAll(company_nip, okres)
+	if err != nil {
+		return nil, err
+	}
+	invoices := []*Invoice{}
+	for _, inv := range all {
+		if !inv.Kasowa(metodaKasowa) {
+			invoices = append(invoices, inv)
+		}
+	}
+	// the amount paid before the month is needed to allocate the parts cumulatively
+	stmt := `SELECT p.invoice_id,
+	COALESCE(SUM(CASE WHEN p.data < DATEFROMPARTS(@p1, @p2, 1) THEN p.kwota END), 0),
+	COALESCE(SUM(CASE WHEN p.data >= DATEFROMPARTS(@p1, @p2, 1) THEN p.kwota END), 0)
+	FROM Payments p WHERE p.company_nip = @p3 AND p.data < DATEADD(month, 1, DATEFROMPARTS(@p1, @p2, 1))
+	GROUP BY p.invoice_id
+	HAVING SUM(CASE WHEN p.data >= DATEFROMPARTS(@p1, @p2, 1) THEN 1 ELSE 0 END) > 0`
+	rows, err := m.DB.Query(stmt, okres.Year(), int(okres.Month()), company_nip)
+	if err != nil {
+		return nil, err
+	}
+	type wplaty struct {
+		invoiceId        int
+		zaplacono, kwota Money
+	}
+	var paid []wplaty
+	for rows.Next() {
+		var w wplaty
+		err = rows.Scan(&w.invoiceId, &w.zaplacono, &w.kwota)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		paid = append(paid, w)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	zaplacone, err := m.list(`company_nip = @p3 AND id IN (SELECT p.invoice_id FROM Payments p WHERE p.company_nip = @p3
+	AND p.data >= DATEFROMPARTS(@p1, @p2, 1) AND p.data < DATEADD(month, 1, DATEFROMPARTS(@p1, @p2, 1)))`,
+		okres.Year(), int(okres.Month()), company_nip)
+	if err != nil {
+		return nil, err
+	}
+	byId := map[int]*Invoice{}
+	for _, inv := range zaplacone {
+		byId[inv.Id] = inv
+	}
+	for _, w := range paid {
+		inv, ok := byId[w.invoiceId]
+		if !ok || !inv.Kasowa(metodaKasowa) {
+			continue
+		}
+		part := inv.paidPart(w.zaplacono, w.kwota)
+		part.Okres = monthOf(okres)
+		invoices = append(invoices, part)
+	}
+	ulgi, err := m.badDebtRows(company_nip, okres)
+	if err != nil {
+		return nil, err
+	}
+	return append(invoices, ulgi...), nil
+}
+
+// ForInvoice returns the payments of the invoice in the order they were made.
+func (m *PaymentModel) ForInvoice(invoiceId int, company_nip string) ([]*Payment, error) {
+	stmt := "SELECT id, invoice_id, data, kwota, COALESCE(sposob, '') FROM Payments WHERE invoice_id = @p1 AND company_nip = @p2 ORDER BY data, id"
+	rows, err := m.DB.Query(stmt, invoiceId, company_nip)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	payments := []*Payment{}
+	for rows.Next() {
+		p := &Payment{}
+		err = rows.Scan(&p.Id, &p.InvoiceId, &p.Data, &p.Kwota, &p.Sposob)
+		if err != nil {
+			return nil, err
+		}
+		payments = append(payments, p)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return payments, nil
+}
+
+// paymentLocked reports whether a payment of the invoice on the day falls into a locked period. Only
+// payments of invoices settled by the cash method or relieved as bad debts are reported, the others can
+// always be recorded. A payment made before the period of the relief changes the relief itself.
+func paymentLocked(q querier, invoiceId int, company_nip string, dzien time.Time) (bool, error) {
+	stmt := `SELECT i.nip, COALESCE(i.transakcja, 'KRAJ'), COALESCE(i.doc_type, 'VAT'), COALESCE(i.korekta_do, 0), COALESCE(p.metoda_kasowa, 0),
+	(SELECT b.okres FROM BadDebts b WHERE b.invoice_id = i.id AND b.company_nip = i.company_nip)
+	FROM Invoices i LEFT JOIN CompanyProfiles p ON p.company_nip = i.company_nip WHERE i.id = @p1 AND i.company_nip = @p2`
+	inv := &Invoice{}
+	var metodaKasowa bool
+	var ulga sql.NullTime
+	err := q.QueryRow(stmt, invoiceId, company_nip).Scan(&inv.Nip, &inv.Transakcja, &inv.Dokument, &inv.KorektaDo, &metodaKasowa, &ulga)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, ErrNoRecord
+		}
+		return false, err
+	}
+	if ulga.Valid && dzien.Before(ulga.Time) {
+		dzien = ulga.Time
+	}
+	if !inv.Kasowa(metodaKasowa) && !ulga.Valid {
+		return false, nil
+	}
+	return periodLocked(q, company_nip, dzien)
+}
+
+func (m *PaymentModel) Insert(p *Payment, company_nip string) (int, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	locked, err := paymentLocked(tx, p.InvoiceId, company_nip, p.Data)
+	if err != nil {
+		return 0, err
+	}
+	if locked {
+		return 0, ErrPeriodLocked
+	}
+	stmt := "INSERT INTO Payments (invoice_id, company_nip, data, kwota, sposob) OUTPUT Inserted.id VALUES (@p1, @p2, @p3, @p4, @p5)"
+	var id int
+	err = tx.QueryRow(stmt, p.InvoiceId, company_nip, p.Data, p.Kwota, p.Sposob).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// Delete removes the payment and returns the id of its invoice. A payment confirmed from a bank statement
+// returns its transaction to review.
+func (m *PaymentModel) Delete(id int, company_nip string) (int, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	p := &Payment{}
+	err = tx.QueryRow("SELECT invoice_id, data FROM Payments WHERE id = @p1 AND company_nip = @p2", id, company_nip).Scan(&p.InvoiceId, &p.Data)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNoRecord
+		}
+		return 0, err
+	}
+	locked, err := paymentLocked(tx, p.InvoiceId, company_nip, p.Data)
+	if err != nil {
+		return 0, err
+	}
+	if locked {
+		return p.InvoiceId, ErrPeriodLocked
+	}
+	_, err = tx.Exec("UPDATE BankTransactions SET payment_id = NULL WHERE payment_id = @p1 AND company_nip = @p2", id, company_nip)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec("DELETE FROM Payments WHERE id = @p1 AND company_nip = @p2", id, company_nip)
+	if err != nil {
+		return 0, err
+	}
+	return p.InvoiceId, tx.Commit()
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAgeingBuckets(t *testing.T) {
+	termin := date("2025-03-01")
+	tests := []struct {
+		dzien time.Time
+		dni   int
+		want  AgeingRow
+	}{
+		{date("2025-02-20"), -9, AgeingRow{Biezace: 100}},
+		{termin, 0, AgeingRow{Biezace: 100}},
+		{date("2025-03-02"), 1, AgeingRow{Do30: 100}},
+		{date("2025-03-31"), 30, AgeingRow{Do30: 100}},
+		{date("2025-04-01"), 31, AgeingRow{Do60: 100}},
+		{date("2025-04-30"), 60, AgeingRow{Do60: 100}},
+		{date("2025-05-01"), 61, AgeingRow{Do90: 100}},
+		{date("2025-05-30"), 90, AgeingRow{Do90: 100}},
+		{date("2025-05-31"), 91, AgeingRow{Powyzej90: 100}},
+	}
+	for _, tt := range tests {
+		dni := dniPo(termin, tt.dzien)
+		if dni != tt.dni {
+			t.Errorf("dniPo(%s) = %d; want %d", tt.dzien.Format(time.DateOnly), dni, tt.dni)
+		}
+		var got AgeingRow
+		got.add(dni, 100)
+		if got != tt.want {
+			t.Errorf("add(%d) = %+v; want %+v", dni, got, tt.want)
+		}
+	}
+}
+
+func TestDniPoLocalTime(t *testing.T) {
+	warszawa, err := time.LoadLocation("Europe/Warsaw")
+	if err != nil {
+		t.Skip(err)
+	}
+	// the clocks go forward on 30 March, the day is still counted whole
+	termin := time.Date(2025, time.March, 1, 0, 0, 0, 0, warszawa)
+	dzien := time.Date(2025, time.March, 31, 23, 30, 0, 0, warszawa)
+	if dni := dniPo(termin, dzien); dni != 30 {
+		t.Errorf("dniPo() = %d; want 30", dni)
+	}
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// CompanyProfile holds the taxpayer data used for Podmiot1 and the header of the JPK.
+type CompanyProfile struct {
+	Nip           string
+	PelnaNazwa    string
+	Email         string
+	Telefon       string
+	KodUrzedu     string
+	OsobaFizyczna bool
+	Imie          string
+	Nazwisko      string
+	DataUrodzenia time.Time
+	// Kwartalnie marks a quarterly small taxpayer filing JPK_V7K instead of JPK_V7M
+	Kwartalnie bool
+	// Proporcja is the percentage of the VAT on purchases used for both taxed and exempt sales that may
+	// be deducted
+	Proporcja int
+	// MetodaKasowa marks a small taxpayer settling VAT by the cash method, when its invoices are paid
+	MetodaKasowa bool
+	// NrRachunku is the account the company pays its purchase invoices from
+	NrRachunku string
+}
+
+type CompanyProfileModel struct {
+	DB *sql.DB
+}
+
+func (m *CompanyProfileModel) Get(company_nip string) (*CompanyProfile, error) {
+	stmt := "SELECT company_nip, pelna_nazwa, email, telefon, kod_urzedu, osoba_fizyczna, imie, nazwisko, data_urodzenia, kwartalnie, COALESCE(proporcja, 100), COALESCE(metoda_kasowa, 0), COALESCE(nr_rachunku, '') FROM CompanyProfiles WHERE company_nip = @p1"
+	p := &CompanyProfile{}
+	var dataUrodzenia sql.NullTime
+	err := m.DB.QueryRow(stmt, company_nip).Scan(&p.Nip, &p.PelnaNazwa, &p.Email, &p.Telefon, &p.KodUrzedu, &p.OsobaFizyczna, &p.Imie, &p.Nazwisko, &dataUrodzenia, &p.Kwartalnie, &p.Proporcja, &p.MetodaKasowa, &p.NrRachunku)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+	p.DataUrodzenia = dataUrodzenia.Time
+	return p, nil
+}
+
+func (m *CompanyProfileModel) Save(p *CompanyProfile) error {
+	stmt := `MERGE CompanyProfiles AS t USING (SELECT @p1 AS company_nip) AS s ON t.company_nip = s.company_nip
+	WHEN MATCHED THEN UPDATE SET pelna_nazwa = @p2, email = @p3, telefon = @p4, kod_urzedu = @p5, osoba_fizyczna = @p6, imie = @p7, nazwisko = @p8, data_urodzenia = @p9, kwartalnie = @p10, proporcja = @p11, metoda_kasowa = @p12, nr_rachunku = @p13
+	WHEN NOT MATCHED THEN INSERT (company_nip, pelna_nazwa, email, telefon, kod_urzedu, osoba_fizyczna, imie, nazwisko, data_urodzenia, kwartalnie, proporcja, metoda_kasowa, nr_rachunku) VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8, @p9, @p10, @p11, @p12, @p13);`
+	var dataUrodzenia sql.NullTime
+	if p.OsobaFizyczna && !p.DataUrodzenia.IsZero() {
+		dataUrodzenia = sql.NullTime{Time: p.DataUrodzenia, Valid: true}
+	}
+	_, err := m.DB.Exec(stmt, p.Nip, p.PelnaNazwa, p.Email, p.Telefon, p.KodUrzedu, p.OsobaFizyczna, p.Imie, p.Nazwisko, dataUrodzenia, p.Kwartalnie, p.Proporcja, p.MetodaKasowa, p.NrRachunku)
+	return err
+}
+
+// companyProporcja returns the deduction proportion of the company, the whole tax when it has no profile.
+func companyProporcja(q querier, company_nip string) (int, error) {
+	var proporcja int
+	err := q.QueryRow("SELECT COALESCE(proporcja, 100) FROM CompanyProfiles WHERE company_nip = @p1", company_nip).Scan(&proporcja)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 100, nil
+		}
+		return 0, err
+	}
+	return proporcja, nil
+}
+
+// Complete reports whether the profile has everything NewJpk needs to fill Podmiot1.
+func (p *CompanyProfile) Complete() bool {
+	if p.KodUrzedu == "" || p.Email == "" {
+		return false
+	}
+	if p.OsobaFizyczna {
+		return p.Imie != "" && p.Nazwisko != "" && !p.DataUrodzenia.IsZero()
+	}
+	return p.PelnaNazwa != ""
+}
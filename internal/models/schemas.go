@@ -0,0 +1,122 @@
+package models
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/jacoelho/xsd"
+	xsderrors "github.com/jacoelho/xsd/errors"
+)
+
+//go:generate go run fetch_schemas.go
+
+// The schemas directory holds the schemas published by the Ministry of Finance, unmodified, under the
+// host and path of their URL.
+//
+//go:embed schemas
+var schemaFiles embed.FS
+
+// schemaNames maps the kodSystemowy of the form to its schema.
+var schemaNames = map[string]string{
+	"JPK_V7M (2)": "crd.gov.pl/wzor/2021/12/27/11148/schemat.xsd",
+	"JPK_V7K (2)": "crd.gov.pl/wzor/2021/12/27/11149/schemat.xsd",
+}
+
+var (
+	schemasMu sync.Mutex
+	schemas   = map[string]*xsd.Schema{}
+)
+
+// loadSchema compiles the schema of the form with everything it imports. Compiled schemas are kept for
+// the next files.
+func loadSchema(kod string) (*xsd.Schema, error) {
+	schemasMu.Lock()
+	defer schemasMu.Unlock()
+	if schema, ok := schemas[kod]; ok {
+		return schema, nil
+	}
+	name, ok := schemaNames[kod]
+	if !ok {
+		return nil, fmt.Errorf("models: no schema for %q", kod)
+	}
+	root, err := fs.Sub(schemaFiles, "schemas")
+	if err != nil {
+		return nil, err
+	}
+	if _, err = fs.Stat(root, name); err != nil {
+		return nil, fmt.Errorf("%w: %s, run go generate ./internal/models and commit the files: %v", ErrNoSchema, kod, err)
+	}
+	schema, err := xsd.LoadWithOptions(localSchemas{root}, name, xsd.NewLoadOptions())
+	if err != nil {
+		return nil, fmt.Errorf("models: %s: %w", name, err)
+	}
+	schemas[kod] = schema
+	return schema, nil
+}
+
+// ValidateJpk checks the marshalled file against the published schema of its form. The returned
+// messages are shown to the user, an empty result means the file is valid. The error is only
+// set when the schema itself cannot be used.
+func ValidateJpk(jpk *JPK, content []byte) ([]string, error) {
+	schema, err := loadSchema(jpk.Naglowek.KodFormularza.KodSystemowy)
+	if err != nil {
+		return nil, err
+	}
+	err = schema.Validate(bytes.NewReader(content))
+	if err == nil {
+		return nil, nil
+	}
+	violations, ok := xsderrors.AsValidations(err)
+	if !ok {
+		return nil, err
+	}
+	bledy := make([]string, len(violations))
+	for i, v := range violations {
+		bledy[i] = v.Error()
+	}
+	return bledy, nil
+}
+
+// absoluteLocation is an import of a schema by its URL, as the published schemas import each other.
+var absoluteLocation = regexp.MustCompile(`schemaLocation="https?://`)
+
+// localSchemas serves the bundled schemas with the URLs of their imports replaced by the paths of the
+// bundled copies, relative to the importing schema, so that the schemas are never fetched from the
+// network.
+type localSchemas struct {
+	fs.FS
+}
+
+func (l localSchemas) Open(name string) (fs.File, error) {
+	f, err := l.FS.Open(name)
+	if err != nil || path.Ext(name) != ".xsd" {
+		return f, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	up := strings.Repeat("../", strings.Count(name, "/"))
+	data = absoluteLocation.ReplaceAll(data, []byte(`schemaLocation="`+up))
+	return &schemaFile{Reader: bytes.NewReader(data), info: info}, nil
+}
+
+type schemaFile struct {
+	*bytes.Reader
+	info fs.FileInfo
+}
+
+func (f *schemaFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *schemaFile) Close() error               { return nil }
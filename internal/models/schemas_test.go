@@ -0,0 +1,79 @@
+package models
+
+import (
+	"encoding/xml"
+	"errors"
+	"testing"
+)
+
+// schemaJpk builds a file of a company with one sale and one purchase, marshalled the way it is stored.
+func schemaJpk(t *testing.T, kwartalnie bool, okres string) (*JPK, []byte) {
+	t.Helper()
+	profile := &CompanyProfile{Nip: "5260250274", PelnaNazwa: "Greyhouse Sp. z o.o.", Email: "biuro@greyhouse.es",
+		KodUrzedu: "1471", Kwartalnie: kwartalnie}
+	miesiac := date(okres)
+	inv := []*Invoice{
+		{Inv_type: SaleInvoice, Dokument: DocFaktura, Transakcja: TxKrajowa, Nip: "7740001454", Nr_faktury: "FV/1/2025",
+			Data: miesiac, Okres: miesiac, Netto: 100000, Podatek: 23000, Kwoty: []RateAmount{{Stawka: Rate23, Netto: 100000, Podatek: 23000}}},
+		{Inv_type: PurchaseInvoice, Dokument: DocFaktura, Transakcja: TxKrajowa, Nip: "1234563218", Nr_faktury: "Z/7",
+			Data: miesiac, Okres: miesiac, Netto: 50000, Podatek: 11500, Odliczenie: OdliczeniePelne},
+	}
+	contractors := map[string]*Contractor{
+		"7740001454": {Nip: "7740001454", Nazwa: "Odbiorca S.A.", KodKraju: "PL"},
+		"1234563218": {Nip: "1234563218", Nazwa: "Dostawca Sp. j.", KodKraju: "PL"},
+	}
+	jpk, err := buildJpk(inv, contractors, 0, profile, JPKParams{Okres: miesiac, Cel: CelZlozenie})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := xml.MarshalIndent(jpk, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jpk, append([]byte(`<?xml version="1.0" encoding="UTF-8"?>`+"\n"), out...)
+}
+
+func TestValidateJpk(t *testing.T) {
+	tests := []struct {
+		name       string
+		kwartalnie bool
+		okres      string
+	}{
+		{"monthly", false, "2025-03-01"},
+		{"quarterly with the declaration", true, "2025-03-01"},
+		{"quarterly without the declaration", true, "2025-02-01"},
+	}
+	for _, tt := range tests {
+		jpk, content := schemaJpk(t, tt.kwartalnie, tt.okres)
+		bledy, err := ValidateJpk(jpk, content)
+		if errors.Is(err, ErrNoSchema) {
+			t.Skip(err)
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if len(bledy) > 0 {
+			t.Errorf("%s: ValidateJpk() = %q; want no errors", tt.name, bledy)
+		}
+	}
+}
+
+func TestValidateJpkInvalid(t *testing.T) {
+	jpk, _ := schemaJpk(t, false, "2025-03-01")
+	jpk.Naglowek.KodUrzedu = "14"
+	jpk.Naglowek.Miesiac = 13
+	out, err := xml.MarshalIndent(jpk, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bledy, err := ValidateJpk(jpk, out)
+	if errors.Is(err, ErrNoSchema) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bledy) == 0 {
+		t.Error("ValidateJpk() found no errors in a file with an invalid tax office code and month")
+	}
+}
@@ -0,0 +1,614 @@
+package models
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// BankTransaction is a transaction read from a bank statement. Kwota is positive for money received and
+// negative for money paid out. Rachunek and Kontrahent identify the other party.
+type BankTransaction struct {
+	Id         int
+	Data       time.Time
+	Kwota      Money
+	Waluta     string
+	Tytul      string
+	Kontrahent string
+	Rachunek   string
+	// Referencja is the bank reference of the transaction, used to skip transactions imported twice
+	Referencja string
+	// InvoiceId is the invoice proposed by matching or chosen on review, PaymentId the payment recorded
+	// when the match was confirmed. Nr_faktury is the number of the invoice.
+	InvoiceId  int
+	PaymentId  int
+	Nr_faktury string
+}
+
+// Pasuje reports whether the transaction can pay the invoice: money received pays sales, money paid out
+// pays purchases, in the currency of the invoice.
+func (t BankTransaction) Pasuje(inv *Invoice) bool {
+	if t.Waluta != inv.Waluta {
+		return false
+	}
+	if t.Kwota > 0 {
+		return inv.Inv_type == SaleInvoice
+	}
+	return t.Kwota < 0 && inv.Inv_type == PurchaseInvoice
+}
+
+// Wartosc returns the amount of the transaction without its sign.
+func (t BankTransaction) Wartosc() Money {
+	return Money(abs(int64(t.Kwota)))
+}
+
+// ParseStatement reads the transactions of a bank statement in the MT940 format or the ISO 20022 CAMT.053
+// format. The format is recognised by the content.
+func ParseStatement(r io.Reader) ([]BankTransaction, error) {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	body = bytes.TrimPrefix(body, []byte("\xef\xbb\xbf"))
+	var txs []BankTransaction
+	if bytes.HasPrefix(bytes.TrimSpace(body), []byte("<")) {
+		txs, err = parseCamt053(body)
+	} else {
+		txs, err = parseMT940(body)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(txs) == 0 {
+		return nil, ErrInvalidStatement
+	}
+	return txs, nil
+}
+
+// mt940Line is the :61: statement line: value date, optional entry date, debit or credit mark (R
+// reverses it), optional funds code, amount, transaction type, customer reference and bank reference.
+var mt940Line = regexp.MustCompile(`^(\d{6})(\d{4})?(RC|RD|C|D)[A-Z]?(\d+,\d{0,2})[NSF][A-Z0-9]{3}([^/]*)(?://(\S*))?`)
+
+// mt940Balance is the :60F: opening balance, which gives the currency of the statement.
+var mt940Balance = regexp.MustCompile(`^[CD]\d{6}([A-Z]{3})`)
+
+// parseMT940 reads an MT940 statement. Polish banks divide the :86: information into subfields marked
+// with ~, ^ or ? and a two-digit code: 20 to 25 hold the title, 27, 28, 32 and 33 the name of the other
+// party, 38 its IBAN or 30 and 31 its sort code and number. Information without subfields is taken as the
+// title. A statement that is not valid UTF-8 is read as Windows-1250.
+func parseMT940(body []byte) ([]BankTransaction, error) {
+	if !utf8.Valid(body) {
+		body = []byte(fromCp1250(body))
+	}
+	type pole struct{ tag, value string }
+	var pola []pole
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(line) > 1 && line[0] == ':' {
+			if tag, value, ok := strings.Cut(line[1:], ":"); ok {
+				pola = append(pola, pole{tag, value})
+				continue
+			}
+		}
+		if len(pola) > 0 && line != "-" && !strings.HasPrefix(line, "-}") {
+			pola[len(pola)-1].value += "\n" + line
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	var txs []BankTransaction
+	waluta := PLN
+	for _, p := range pola {
+		switch p.tag {
+		case "60F", "60M":
+			if m := mt940Balance.FindStringSubmatch(p.value); m != nil {
+				waluta = m[1]
+			}
+		case "61":
+			m := mt940Line.FindStringSubmatch(strings.ReplaceAll(p.value, "\n", ""))
+			if m == nil {
+				return nil, ErrInvalidStatement
+			}
+			data, err := time.Parse("060102", m[1])
+			if err != nil {
+				return nil, ErrInvalidStatement
+			}
+			kwota, err := ParseMoney(m[4])
+			if err != nil {
+				return nil, ErrInvalidStatement
+			}
+			if m[3] == "D" || m[3] == "RC" {
+				kwota = -kwota
+			}
+			referencja := strings.TrimSpace(m[6])
+			if referencja == "" && m[5] != "NONREF" {
+				referencja = strings.TrimSpace(m[5])
+			}
+			txs = append(txs, BankTransaction{Data: data, Kwota: kwota, Waluta: waluta, Referencja: referencja})
+		case "86":
+			if len(txs) == 0 {
+				continue
+			}
+			mt940Info(&txs[len(txs)-1], p.value)
+		}
+	}
+	return txs, nil
+}
+
+// mt940Info fills the title, the name and the account of the other party from the :86: field.
+func mt940Info(t *BankTransaction, info string) {
+	info = strings.ReplaceAll(info, "\n", "")
+	sep := strings.IndexAny(info, "~^?")
+	if sep < 0 || sep+3 > len(info) || !unicode.IsDigit(rune(info[sep+1])) || !unicode.IsDigit(rune(info[sep+2])) {
+		t.Tytul = strings.TrimSpace(info)
+		return
+	}
+	var tytul, nazwa []string
+	var rozliczeniowy, numer string
+	for _, sub := range strings.FieldsFunc(info[sep:], func(c rune) bool { return c == rune(info[sep]) }) {
+		if len(sub) < 2 {
+			continue
+		}
+		// the title is cut into subfields of fixed length, possibly in the middle of a word
+		kod, value := sub[:2], sub[2:]
+		switch kod {
+		case "20", "21", "22", "23", "24", "25":
+			tytul = append(tytul, value)
+		case "27", "28", "32", "33":
+			nazwa = append(nazwa, strings.TrimSpace(value))
+		case "30":
+			rozliczeniowy = strings.TrimSpace(value)
+		case "31":
+			numer = strings.TrimSpace(value)
+		case "38":
+			t.Rachunek = iban(value)
+		}
+	}
+	if t.Rachunek == "" && len(rozliczeniowy) == 8 && len(numer) == 16 {
+		t.Rachunek = nrb(rozliczeniowy + numer)
+	}
+	t.Tytul = strings.TrimSpace(strings.Join(tytul, ""))
+	t.Kontrahent = strings.TrimSpace(strings.Join(nazwa, " "))
+}
+
+// nrb completes the sort code and account number of a Polish bank with the control digits and returns
+// the IBAN, or an empty string when they are not digits.
+func nrb(numer string) string {
+	reszta := 0
+	for _, c := range numer + "2521" + "00" {
+		if c < '0' || c > '9' {
+			return ""
+		}
+		reszta = (reszta*10 + int(c-'0')) % 97
+	}
+	return fmt.Sprintf("PL%02d%s", 98-reszta, numer)
+}
+
+// camtAccount is an account in CAMT, identified by IBAN or by another number.
+type camtAccount struct {
+	IBAN string `xml:"Id>IBAN"`
+	Othr string `xml:"Id>Othr>Id"`
+}
+
+func (a camtAccount) numer() string {
+	if a.IBAN != "" {
+		return a.IBAN
+	}
+	return a.Othr
+}
+
+type camtAmount struct {
+	Value string `xml:",chardata"`
+	Ccy   string `xml:"Ccy,attr"`
+}
+
+type camtDetails struct {
+	Amt         *camtAmount `xml:"Amt"`
+	TxAmt       *camtAmount `xml:"AmtDtls>TxAmt>Amt"`
+	AcctSvcrRef string      `xml:"Refs>AcctSvcrRef"`
+	EndToEndId  string      `xml:"Refs>EndToEndId"`
+	Dbtr        string      `xml:"RltdPties>Dbtr>Nm"`
+	DbtrPty     string      `xml:"RltdPties>Dbtr>Pty>Nm"`
+	DbtrAcct    camtAccount `xml:"RltdPties>DbtrAcct"`
+	Cdtr        string      `xml:"RltdPties>Cdtr>Nm"`
+	CdtrPty     string      `xml:"RltdPties>Cdtr>Pty>Nm"`
+	CdtrAcct    camtAccount `xml:"RltdPties>CdtrAcct"`
+	Ustrd       []string    `xml:"RmtInf>Ustrd"`
+	Ref         []string    `xml:"RmtInf>Strd>CdtrRefInf>Ref"`
+}
+
+type camtEntry struct {
+	Amt         camtAmount    `xml:"Amt"`
+	CdtDbtInd   string        `xml:"CdtDbtInd"`
+	BookgDt     string        `xml:"BookgDt>Dt"`
+	BookgDtTm   string        `xml:"BookgDt>DtTm"`
+	ValDt       string        `xml:"ValDt>Dt"`
+	AcctSvcrRef string        `xml:"AcctSvcrRef"`
+	AddtlInf    string        `xml:"AddtlNtryInf"`
+	TxDtls      []camtDetails `xml:"NtryDtls>TxDtls"`
+}
+
+type camtDocument struct {
+	XMLName    xml.Name
+	Statements []struct {
+		Entries []camtEntry `xml:"Ntry"`
+	} `xml:"BkToCstmrStmt>Stmt"`
+}
+
+// parseCamt053 reads a CAMT.053 statement. An entry booking a batch of transfers with their own amounts
+// is split into them, so each can be matched to its invoice.
+func parseCamt053(body []byte) ([]BankTransaction, error) {
+	var doc camtDocument
+	if err := xml.Unmarshal(body, &doc); err != nil || doc.XMLName.Local != "Document" {
+		return nil, ErrInvalidStatement
+	}
+	var txs []BankTransaction
+	for _, s := range doc.Statements {
+		for _, e := range s.Entries {
+			data, err := camtDate(e)
+			if err != nil {
+				return nil, err
+			}
+			details := e.TxDtls
+			if len(details) > 1 {
+				for _, d := range details {
+					if d.amount() == nil {
+						details = details[:1]
+						break
+					}
+				}
+			}
+			if len(details) == 0 {
+				details = []camtDetails{{}}
+			}
+			for _, d := range details {
+				amt := &e.Amt
+				if len(details) > 1 {
+					amt = d.amount()
+				}
+				t, err := camtTransaction(e, d, *amt)
+				if err != nil {
+					return nil, err
+				}
+				t.Data = data
+				txs = append(txs, t)
+			}
+		}
+	}
+	return txs, nil
+}
+
+func (d camtDetails) amount() *camtAmount {
+	if d.Amt != nil {
+		return d.Amt
+	}
+	return d.TxAmt
+}
+
+func camtDate(e camtEntry) (time.Time, error) {
+	dzien := e.BookgDt
+	if dzien == "" && len(e.BookgDtTm) >= 10 {
+		dzien = e.BookgDtTm[:10]
+	}
+	if dzien == "" {
+		dzien = e.ValDt
+	}
+	data, err := time.Parse("2006-01-02", dzien)
+	if err != nil {
+		return time.Time{}, ErrInvalidStatement
+	}
+	return data, nil
+}
+
+func camtTransaction(e camtEntry, d camtDetails, amt camtAmount) (BankTransaction, error) {
+	// ParseMoney takes an empty amount for zero
+	kwota, err := ParseMoney(amt.Value)
+	if err != nil || strings.TrimSpace(amt.Value) == "" || amt.Ccy == "" {
+		return BankTransaction{}, ErrInvalidStatement
+	}
+	t := BankTransaction{Kwota: kwota, Waluta: amt.Ccy}
+	switch e.CdtDbtInd {
+	case "CRDT":
+		t.Kontrahent, t.Rachunek = firstNonEmpty(d.Dbtr, d.DbtrPty), d.DbtrAcct.numer()
+	case "DBIT":
+		t.Kwota = -kwota
+		t.Kontrahent, t.Rachunek = firstNonEmpty(d.Cdtr, d.CdtrPty), d.CdtrAcct.numer()
+	default:
+		return BankTransaction{}, ErrInvalidStatement
+	}
+	if t.Rachunek != "" {
+		t.Rachunek = iban(t.Rachunek)
+	}
+	t.Tytul = strings.TrimSpace(strings.Join(append(d.Ustrd, d.Ref...), " "))
+	if t.Tytul == "" {
+		t.Tytul = strings.TrimSpace(e.AddtlInf)
+	}
+	t.Referencja = firstNonEmpty(d.AcctSvcrRef, e.AcctSvcrRef, d.EndToEndId)
+	if t.Referencja == "NOTPROVIDED" {
+		t.Referencja = ""
+	}
+	return t, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// iban returns the account number without spaces and dashes, a Polish NRB prefixed with PL, so that
+// numbers from statements and invoices compare equal.
+func iban(numer string) string {
+	numer = strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(numer))
+	if len(numer) == 26 && strings.Trim(numer, "0123456789") == "" {
+		return "PL" + numer
+	}
+	return numer
+}
+
+// znaki returns the letters and digits of the text in upper case, so that invoice numbers and NIPs are
+// found in titles whatever separators the payer used.
+func znaki(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		if unicode.IsLetter(c) || unicode.IsDigit(c) {
+			b.WriteRune(unicode.ToUpper(c))
+		}
+	}
+	return b.String()
+}
+
+// dopasuj returns the id of the open invoice the transaction most likely pays, zero when no invoice
+// stands out. The invoice number in the title counts most, then the contractor recognised by the NIP in
+// the title or by the account, then an amount equal to what is left to pay. An amount alone is not
+// enough. konta maps the accounts of the other parties to their NIP.
+func dopasuj(t BankTransaction, open []*Invoice, konta map[string]string) int {
+	tytul := znaki(t.Tytul)
+	best, bestScore, remis := 0, 0, false
+	for _, inv := range open {
+		if !t.Pasuje(inv) {
+			continue
+		}
+		score := 0
+		// short numbers such as "1" would be found in any title
+		if nr := znaki(inv.Nr_faktury); len(nr) >= 4 && strings.Contains(tytul, nr) {
+			score += 4
+		}
+		switch {
+		case inv.Nip != "" && strings.Contains(tytul, inv.Nip):
+			score += 2
+		case t.Rachunek != "" && (konta[t.Rachunek] == inv.Nip || iban(inv.NrRachunku) == t.Rachunek && inv.Inv_type == PurchaseInvoice):
+			score += 2
+		}
+		if t.Wartosc() == inv.Niezaplacono() {
+			score++
+		}
+		switch {
+		case score > bestScore:
+			best, bestScore, remis = inv.Id, score, false
+		case score == bestScore:
+			remis = true
+		}
+	}
+	if bestScore < 3 || remis {
+		return 0
+	}
+	return best
+}
+
+type StatementModel struct {
+	DB *sql.DB
+}
+
+// openInvoices returns the invoices that can still be paid: payable documents other than corrections,
+// with an amount left to pay.
+func openInvoices(db *sql.DB, company_nip string) ([]*Invoice, error) {
+	stmt := `SELECT id, type, nip, nr_faktury, COALESCE(doc_type, 'VAT'), COALESCE(waluta, 'PLN'), data, termin_platnosci,
+	COALESCE(netto_waluta, netto), COALESCE(podatek_waluta, podatek), COALESCE(nr_rachunku, ''),
+	COALESCE((SELECT SUM(p.kwota) FROM Payments p WHERE p.invoice_id = Invoices.id AND p.company_nip = Invoices.company_nip), 0)
+	FROM Invoices WHERE company_nip = @p1 AND COALESCE(doc_type, 'VAT') IN ('VAT', 'MK', 'VAT_RR') AND korekta_do IS NULL
+	ORDER BY data, id`
+	rows, err := db.Query(stmt, company_nip)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	invoices := []*Invoice{}
+	for rows.Next() {
+		inv := &Invoice{}
+		var terminPlatnosci sql.NullTime
+		err = rows.Scan(&inv.Id, &inv.Inv_type, &inv.Nip, &inv.Nr_faktury, &inv.Dokument, &inv.Waluta, &inv.Data, &terminPlatnosci,
+			&inv.NettoWaluta, &inv.PodatekWaluta, &inv.NrRachunku, &inv.Zaplacono)
+		if err != nil {
+			return nil, err
+		}
+		inv.TerminPlatnosci = terminPlatnosci.Time
+		if inv.Niezaplacono() > 0 {
+			invoices = append(invoices, inv)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return invoices, nil
+}
+
+// Open returns the invoices with an amount left to pay, the oldest first.
+func (m *InvoiceModel) Open(company_nip string) ([]*Invoice, error) {
+	return openInvoices(m.DB, company_nip)
+}
+
+// knownAccounts maps the accounts of confirmed transactions to the NIP of the invoices they paid.
+func (m *StatementModel) knownAccounts(company_nip string) (map[string]string, error) {
+	stmt := `SELECT DISTINCT t.rachunek, i.nip FROM BankTransactions t
+	JOIN Invoices i ON i.id = t.invoice_id AND i.company_nip = t.company_nip
+	WHERE t.company_nip = @p1 AND t.payment_id IS NOT NULL AND t.rachunek <> '' AND i.nip <> ''`
+	rows, err := m.DB.Query(stmt, company_nip)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	konta := map[string]string{}
+	for rows.Next() {
+		var rachunek, nip string
+		if err = rows.Scan(&rachunek, &nip); err != nil {
+			return nil, err
+		}
+		konta[rachunek] = nip
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return konta, nil
+}
+
+// Import stores the transactions not imported before with the invoices they are matched to. It returns
+// the number of transactions stored and of those matched.
+func (m *StatementModel) Import(txs []BankTransaction, company_nip string) (zaimportowano, dopasowano int, err error) {
+	open, err := openInvoices(m.DB, company_nip)
+	if err != nil {
+		return 0, 0, err
+	}
+	konta, err := m.knownAccounts(company_nip)
+	if err != nil {
+		return 0, 0, err
+	}
+	exists := `SELECT CASE WHEN EXISTS(SELECT 1 FROM BankTransactions WHERE company_nip = @p1 AND data = @p2 AND kwota = @p3
+	AND waluta = @p4 AND referencja = @p5 AND tytul = @p6) THEN 1 ELSE 0 END`
+	stmt := `INSERT INTO BankTransactions (company_nip, data, kwota, waluta, tytul, kontrahent, rachunek, referencja, invoice_id, ignored, created_at)
+	VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8, @p9, 0, @p10)`
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+	for _, t := range txs {
+		var imported bool
+		err = tx.QueryRow(exists, company_nip, t.Data, t.Kwota, t.Waluta, t.Referencja, t.Tytul).Scan(&imported)
+		if err != nil {
+			return 0, 0, err
+		}
+		if imported {
+			continue
+		}
+		invoiceId := dopasuj(t, open, konta)
+		_, err = tx.Exec(stmt, company_nip, t.Data, t.Kwota, t.Waluta, t.Tytul, t.Kontrahent, t.Rachunek, t.Referencja, nullId(invoiceId), time.Now())
+		if err != nil {
+			return 0, 0, err
+		}
+		zaimportowano++
+		if invoiceId != 0 {
+			dopasowano++
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+	return zaimportowano, dopasowano, nil
+}
+
+// Pending returns the transactions waiting for review, in the order they were booked.
+func (m *StatementModel) Pending(company_nip string) ([]*BankTransaction, error) {
+	stmt := `SELECT t.id, t.data, t.kwota, t.waluta, t.tytul, t.kontrahent, t.rachunek, t.referencja, COALESCE(t.invoice_id, 0), COALESCE(i.nr_faktury, '')
+	FROM BankTransactions t LEFT JOIN Invoices i ON i.id = t.invoice_id AND i.company_nip = t.company_nip
+	WHERE t.company_nip = @p1 AND t.payment_id IS NULL AND t.ignored = 0 ORDER BY t.data, t.id`
+	rows, err := m.DB.Query(stmt, company_nip)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	txs := []*BankTransaction{}
+	for rows.Next() {
+		t := &BankTransaction{}
+		err = rows.Scan(&t.Id, &t.Data, &t.Kwota, &t.Waluta, &t.Tytul, &t.Kontrahent, &t.Rachunek, &t.Referencja, &t.InvoiceId, &t.Nr_faktury)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, t)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return txs, nil
+}
+
+// Confirm records the transaction as a payment of the invoice by transfer. The transaction has to fit the
+// invoice and not exceed the amount left to pay.
+func (m *StatementModel) Confirm(id, invoiceId int, company_nip string) error {
+	t := BankTransaction{}
+	err := m.DB.QueryRow("SELECT data, kwota, waluta FROM BankTransactions WHERE id = @p1 AND company_nip = @p2 AND payment_id IS NULL",
+		id, company_nip).Scan(&t.Data, &t.Kwota, &t.Waluta)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+	open, err := openInvoices(m.DB, company_nip)
+	if err != nil {
+		return err
+	}
+	var inv *Invoice
+	for _, o := range open {
+		if o.Id == invoiceId {
+			inv = o
+		}
+	}
+	if inv == nil || !t.Pasuje(inv) || t.Wartosc() > inv.Niezaplacono() {
+		return ErrPaymentMismatch
+	}
+	locked, err := paymentLocked(m.DB, invoiceId, company_nip, t.Data)
+	if err != nil {
+		return err
+	}
+	if locked {
+		return ErrPeriodLocked
+	}
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var paymentId int
+	err = tx.QueryRow("INSERT INTO Payments (invoice_id, company_nip, data, kwota, sposob) OUTPUT Inserted.id VALUES (@p1, @p2, @p3, @p4, @p5)",
+		invoiceId, company_nip, t.Data, t.Wartosc(), PlatnoscPrzelew).Scan(&paymentId)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE BankTransactions SET invoice_id = @p1, payment_id = @p2 WHERE id = @p3 AND company_nip = @p4", invoiceId, paymentId, id, company_nip)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Ignore removes the transaction from review, for transfers that pay no invoice.
+func (m *StatementModel) Ignore(id int, company_nip string) error {
+	res, err := m.DB.Exec("UPDATE BankTransactions SET ignored = 1 WHERE id = @p1 AND company_nip = @p2 AND payment_id IS NULL", id, company_nip)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package models
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const konto = "PL61109010140000071219812874"
+
+func mt940(lines ...string) []byte {
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+func TestParseMT940(t *testing.T) {
+	body := mt940(
+		"{1:F01BPKOPLPWAXXX0000000000}{4:",
+		":20:ST250301",
+		":25:/PL61109010140000071219812874",
+		":28C:1/1",
+		":60F:C250228PLN1000,00",
+		":61:2503010301C1230,00NTRFNONREF//BR0001",
+		":86:020~00PRZELEW~20FV/2025/03/1 za~21płatę",
+		"~27JAN KOWALSKI~28 SP. Z O.O.~3861109010140000071219812874",
+		":61:2503030303D250,5NTRFREF123",
+		":86:152^00PRZELEW^20FV 17/02/2025^3010901014^310000071219812874^32HURTOWNIA^33ABC",
+		":61:2503040304RC100,00NTRFNONREF//BR0003",
+		":86:?20ZWROT?21 FV/1",
+		":61:2503050305RD40,00NTRFNONREF",
+		":86:Zwrot obciążenia",
+		" błędnego",
+		":62F:C250305PLN1890,50",
+		"-}",
+	)
+	got, err := ParseStatement(strings.NewReader(string(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []BankTransaction{
+		{Data: date("2025-03-01"), Kwota: 123000, Waluta: PLN, Tytul: "FV/2025/03/1 zapłatę", Kontrahent: "JAN KOWALSKI SP. Z O.O.", Rachunek: konto, Referencja: "BR0001"},
+		{Data: date("2025-03-03"), Kwota: -25050, Waluta: PLN, Tytul: "FV 17/02/2025", Kontrahent: "HURTOWNIA ABC", Rachunek: konto, Referencja: "REF123"},
+		// a reversed credit takes the money back, a reversed debit returns it
+		{Data: date("2025-03-04"), Kwota: -10000, Waluta: PLN, Tytul: "ZWROT FV/1", Referencja: "BR0003"},
+		{Data: date("2025-03-05"), Kwota: 4000, Waluta: PLN, Tytul: "Zwrot obciążenia błędnego"},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("ParseStatement() =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestParseMT940Cp1250(t *testing.T) {
+	body := mt940(
+		":20:ST250301",
+		":60F:C250228EUR0,00",
+		":61:250301C99,99NTRFNONREF//BR0001",
+		// "Zapłata za FV 1/03" from "Łódź Sp. z o.o." in Windows-1250
+		":86:020~20Zap\xb3ata za FV 1/03~27\xa3\xf3d\x9f Sp. z o.o.~28\x80",
+	)
+	got, err := ParseStatement(strings.NewReader(string(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []BankTransaction{
+		{Data: date("2025-03-01"), Kwota: 9999, Waluta: "EUR", Tytul: "Zapłata za FV 1/03", Kontrahent: "Łódź Sp. z o.o. _", Referencja: "BR0001"},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("ParseStatement() =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestParseMT940Invalid(t *testing.T) {
+	tests := map[string][]byte{
+		"no transactions": mt940(":20:ST250301", ":60F:C250228PLN0,00", ":62F:C250228PLN0,00"),
+		"bad line":        mt940(":20:ST250301", ":61:2503C100,00NTRFNONREF"),
+		"bad date":        mt940(":20:ST250301", ":61:251301C100,00NTRFNONREF"),
+		"empty":           nil,
+	}
+	for name, body := range tests {
+		if _, err := ParseStatement(strings.NewReader(string(body))); !errors.Is(err, ErrInvalidStatement) {
+			t.Errorf("%s: ParseStatement() error = %v; want %v", name, err, ErrInvalidStatement)
+		}
+	}
+}
+
+func TestMt940Info(t *testing.T) {
+	tests := []struct {
+		info string
+		want BankTransaction
+	}{
+		{"~20FV 1~27A~3861109010140000071219812874", BankTransaction{Tytul: "FV 1", Kontrahent: "A", Rachunek: konto}},
+		{"^20FV 1^30109010140000071219812874", BankTransaction{Tytul: "FV 1"}},
+		{"?20FV 1?3010901014?310000071219812874", BankTransaction{Tytul: "FV 1", Rachunek: konto}},
+		// the IBAN wins over the sort code and number
+		{"~30109010 14~310000071219812874~38DE89370400440532013000", BankTransaction{Rachunek: "DE89370400440532013000"}},
+		{"~20ZA FAKTU~21RĘ 12/2025~22~23 PILNE", BankTransaction{Tytul: "ZA FAKTURĘ 12/2025 PILNE"}},
+		// the separator has to be followed by a two-digit code
+		{"Opłata ~ miesięczna", BankTransaction{Tytul: "Opłata ~ miesięczna"}},
+		{"Rata 1/12 ~2", BankTransaction{Tytul: "Rata 1/12 ~2"}},
+		{"  Przelew własny ", BankTransaction{Tytul: "Przelew własny"}},
+	}
+	for _, tt := range tests {
+		var got BankTransaction
+		mt940Info(&got, tt.info)
+		if got != tt.want {
+			t.Errorf("mt940Info(%q) = %+v; want %+v", tt.info, got, tt.want)
+		}
+	}
+}
+
+func camt(entries ...string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.02"><BkToCstmrStmt><Stmt>` +
+		strings.Join(entries, "") + `</Stmt></BkToCstmrStmt></Document>`
+}
+
+func TestParseCamt053(t *testing.T) {
+	body := camt(
+		`<Ntry><Amt Ccy="PLN">1230.00</Amt><CdtDbtInd>CRDT</CdtDbtInd><BookgDt><Dt>2025-03-01</Dt></BookgDt>
+		<AcctSvcrRef>BR0001</AcctSvcrRef><NtryDtls><TxDtls>
+		<RltdPties><Dbtr><Nm>Jan Kowalski</Nm></Dbtr><DbtrAcct><Id><IBAN>PL61 1090 1014 0000 0712 1981 2874</IBAN></Id></DbtrAcct></RltdPties>
+		<RmtInf><Ustrd>FV/2025/03/1</Ustrd></RmtInf></TxDtls></NtryDtls></Ntry>`,
+		// a batch of transfers, each with its own amount given directly or in the amount details
+		`<Ntry><Amt Ccy="PLN">300.00</Amt><CdtDbtInd>DBIT</CdtDbtInd><BookgDt><DtTm>2025-03-02T10:15:00</DtTm></BookgDt>
+		<AcctSvcrRef>BATCH1</AcctSvcrRef><NtryDtls>
+		<TxDtls><Amt Ccy="PLN">100.00</Amt><Refs><AcctSvcrRef>B1</AcctSvcrRef></Refs>
+		<RltdPties><Cdtr><Nm>Hurtownia</Nm></Cdtr><CdtrAcct><Id><Othr><Id>61109010140000071219812874</Id></Othr></Id></CdtrAcct></RltdPties>
+		<RmtInf><Ustrd>FV 17</Ustrd></RmtInf></TxDtls>
+		<TxDtls><AmtDtls><TxAmt><Amt Ccy="PLN">200.00</Amt></TxAmt></AmtDtls><Refs><EndToEndId>E2E2</EndToEndId></Refs>
+		<RltdPties><Cdtr><Pty><Nm>Drukarnia</Nm></Pty></Cdtr></RltdPties>
+		<RmtInf><Strd><CdtrRefInf><Ref>FV 18</Ref></CdtrRefInf></Strd></RmtInf></TxDtls>
+		</NtryDtls></Ntry>`,
+		// a batch without the amounts of its transfers stays one transaction
+		`<Ntry><Amt Ccy="EUR">50.00</Amt><CdtDbtInd>CRDT</CdtDbtInd><ValDt><Dt>2025-03-03</Dt></ValDt>
+		<AcctSvcrRef>BATCH2</AcctSvcrRef><AddtlNtryInf>Wpłaty zbiorcze</AddtlNtryInf><NtryDtls>
+		<TxDtls><Amt Ccy="EUR">20.00</Amt></TxDtls><TxDtls><Refs><EndToEndId>NOTPROVIDED</EndToEndId></Refs></TxDtls>
+		</NtryDtls></Ntry>`,
+	)
+	got, err := ParseStatement(strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []BankTransaction{
+		{Data: date("2025-03-01"), Kwota: 123000, Waluta: PLN, Tytul: "FV/2025/03/1", Kontrahent: "Jan Kowalski", Rachunek: konto, Referencja: "BR0001"},
+		{Data: date("2025-03-02"), Kwota: -10000, Waluta: PLN, Tytul: "FV 17", Kontrahent: "Hurtownia", Rachunek: konto, Referencja: "B1"},
+		{Data: date("2025-03-02"), Kwota: -20000, Waluta: PLN, Tytul: "FV 18", Kontrahent: "Drukarnia", Referencja: "BATCH1"},
+		{Data: date("2025-03-03"), Kwota: 5000, Waluta: "EUR", Tytul: "Wpłaty zbiorcze", Referencja: "BATCH2"},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("ParseStatement() =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestParseCamt053Invalid(t *testing.T) {
+	ntry := func(amt string) string {
+		return `<Ntry>` + amt + `<CdtDbtInd>CRDT</CdtDbtInd><BookgDt><Dt>2025-03-01</Dt></BookgDt></Ntry>`
+	}
+	tests := map[string]string{
+		"empty amount":     camt(ntry(`<Amt Ccy="PLN"/>`)),
+		"blank amount":     camt(ntry(`<Amt Ccy="PLN"> </Amt>`)),
+		"no amount":        camt(ntry(``)),
+		"no currency":      camt(ntry(`<Amt>10.00</Amt>`)),
+		"bad amount":       camt(ntry(`<Amt Ccy="PLN">10.0.0</Amt>`)),
+		"empty batch item": camt(`<Ntry><Amt Ccy="PLN">10.00</Amt><CdtDbtInd>CRDT</CdtDbtInd><BookgDt><Dt>2025-03-01</Dt></BookgDt><NtryDtls><TxDtls><Amt Ccy="PLN">10.00</Amt></TxDtls><TxDtls><Amt Ccy="PLN"/></TxDtls></NtryDtls></Ntry>`),
+		"no direction":     camt(`<Ntry><Amt Ccy="PLN">10.00</Amt><BookgDt><Dt>2025-03-01</Dt></BookgDt></Ntry>`),
+		"no date":          camt(`<Ntry><Amt Ccy="PLN">10.00</Amt><CdtDbtInd>CRDT</CdtDbtInd></Ntry>`),
+		"no entries":       camt(),
+		"not camt":         `<Faktura></Faktura>`,
+	}
+	for name, body := range tests {
+		if _, err := ParseStatement(strings.NewReader(body)); !errors.Is(err, ErrInvalidStatement) {
+			t.Errorf("%s: ParseStatement() error = %v; want %v", name, err, ErrInvalidStatement)
+		}
+	}
+}
+
+func TestDopasuj(t *testing.T) {
+	sprzedaz := func(id int, nr, nip string, brutto Money) *Invoice {
+		return &Invoice{Id: id, Inv_type: SaleInvoice, Waluta: PLN, Nr_faktury: nr, Nip: nip, NettoWaluta: brutto}
+	}
+	wplata := func(kwota Money, tytul, rachunek string) BankTransaction {
+		return BankTransaction{Kwota: kwota, Waluta: PLN, Tytul: tytul, Rachunek: rachunek}
+	}
+	konta := map[string]string{konto: "5260250274"}
+	tests := []struct {
+		name string
+		t    BankTransaction
+		open []*Invoice
+		want int
+	}{
+		{"number", wplata(5000, "zapłata FV/2025/03/1", ""),
+			[]*Invoice{sprzedaz(1, "FV/2025/03/1", "", 10000), sprzedaz(2, "FV/2025/03/2", "", 5000)}, 1},
+		{"number written differently", wplata(5000, "fv 2025-03-1", ""),
+			[]*Invoice{sprzedaz(1, "FV/2025/03/1", "", 10000)}, 1},
+		{"amount alone", wplata(5000, "przelew", ""),
+			[]*Invoice{sprzedaz(1, "FV/2025/03/1", "", 5000)}, 0},
+		{"nip in the title and amount", wplata(5000, "NIP 526-025-02-74", ""),
+			[]*Invoice{sprzedaz(1, "FV/1", "5260250274", 5000), sprzedaz(2, "FV/2", "5260250274", 7000)}, 1},
+		{"known account and amount", wplata(5000, "przelew", konto),
+			[]*Invoice{sprzedaz(1, "FV/1", "5260250274", 5000), sprzedaz(2, "FV/2", "7740001454", 5000)}, 1},
+		// two invoices of the contractor for the same amount and no number to tell them apart
+		{"tie", wplata(5000, "przelew", konto),
+			[]*Invoice{sprzedaz(1, "FV/1", "5260250274", 5000), sprzedaz(2, "FV/2", "5260250274", 5000)}, 0},
+		{"same number in two titles", wplata(5000, "FV/2025/03/1 FV/2025/03/2", ""),
+			[]*Invoice{sprzedaz(1, "FV/2025/03/1", "", 5000), sprzedaz(2, "FV/2025/03/2", "", 5000)}, 0},
+		{"tie broken by a better match", wplata(5000, "FV/2025/03/3", konto),
+			[]*Invoice{sprzedaz(1, "FV/2025/03/1", "5260250274", 5000), sprzedaz(2, "FV/2025/03/2", "5260250274", 5000),
+				sprzedaz(3, "FV/2025/03/3", "5260250274", 9000)}, 3},
+		{"tie below the best", wplata(5000, "FV/2025/03/3", ""),
+			[]*Invoice{sprzedaz(1, "FV/1", "", 5000), sprzedaz(2, "FV/2", "", 5000), sprzedaz(3, "FV/2025/03/3", "", 9000)}, 3},
+		{"short number", wplata(5000, "zapłata 1", ""),
+			[]*Invoice{sprzedaz(1, "1", "", 9000)}, 0},
+		{"money paid out", wplata(-5000, "FV/2025/03/1", ""),
+			[]*Invoice{sprzedaz(1, "FV/2025/03/1", "", 5000)}, 0},
+		{"other currency", BankTransaction{Kwota: 5000, Waluta: "EUR", Tytul: "FV/2025/03/1"},
+			[]*Invoice{sprzedaz(1, "FV/2025/03/1", "", 5000)}, 0},
+	}
+	for _, tt := range tests {
+		if got := dopasuj(tt.t, tt.open, konta); got != tt.want {
+			t.Errorf("%s: dopasuj() = %d; want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -10,20 +10,39 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// The roles of a user in the company. The owner signs the company up, adds the other users and
+// unlocks closed periods.
+const (
+	RoleOwner = "owner"
+	RoleUser  = "user"
+)
+
 type User struct {
 	Id             int
 	Name           string
 	Email          string
 	HashedPassword []byte
 	Created        time.Time
+	Role           string
 }
 
 type UserModel struct {
 	DB *sql.DB
 }
 
+// Insert signs the company up with its first user. The company, its tax profile and the user are stored in
+// one transaction, so that a rejected email does not leave the company behind.
 func (m *UserModel) Insert(name, email, password, company, nip string) error {
-	_, err := m.DB.Exec("INSERT INTO UserCompanies VALUES (@p1, @p2)", nip, company)
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return err
+	}
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec("INSERT INTO UserCompanies VALUES (@p1, @p2)", nip, company)
 	if err != nil {
 		var msSQLError *mssql.Error
 		if errors.As(err, &msSQLError) {
@@ -33,13 +52,41 @@ func (m *UserModel) Insert(name, email, password, company, nip string) error {
 		}
 		return err
 	}
-	stmt := "INSERT INTO Users (name, email, hashed_password, company_nip, created) values (@p1, @p2, @p3, @p4, GETDATE())"
+	// the tax profile starts with the signup data, the rest is filled in on the settings page
+	_, err = tx.Exec("INSERT INTO CompanyProfiles (company_nip, pelna_nazwa, email, telefon, kod_urzedu, osoba_fizyczna, imie, nazwisko, kwartalnie) VALUES (@p1, @p2, @p3, '', '', 0, '', '', 0)", nip, company, email)
+	if err != nil {
+		return err
+	}
+	// the user signing the company up owns it
+	err = insertUser(tx, name, email, hashedPassword, nip, RoleOwner)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
 
+// InsertMember adds a user to a company that is already signed up. Members keep the invoices and files
+// of the company but cannot add users or unlock closed periods.
+func (m *UserModel) InsertMember(name, email, password, company_nip string) error {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
 	if err != nil {
 		return err
 	}
-	_, err = m.DB.Exec(stmt, name, email, hashedPassword, nip)
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = insertUser(tx, name, email, hashedPassword, company_nip, RoleUser)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertUser(tx *sql.Tx, name, email string, hashedPassword []byte, company_nip, role string) error {
+	stmt := "INSERT INTO Users (name, email, hashed_password, company_nip, created, role) values (@p1, @p2, @p3, @p4, GETDATE(), @p5)"
+	_, err := tx.Exec(stmt, name, email, hashedPassword, company_nip, role)
 	if err != nil {
 		var msSQLError *mssql.Error
 		if errors.As(err, &msSQLError) {
@@ -52,6 +99,30 @@ func (m *UserModel) Insert(name, email, password, company, nip string) error {
 	return nil
 }
 
+// Company returns the users of the company, the owner first.
+func (m *UserModel) Company(company_nip string) ([]*User, error) {
+	stmt := `SELECT id, name, email, created, COALESCE(role, '') FROM Users WHERE company_nip = @p1
+	ORDER BY CASE WHEN role = 'owner' THEN 0 ELSE 1 END, created, id`
+	rows, err := m.DB.Query(stmt, company_nip)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	users := []*User{}
+	for rows.Next() {
+		u := &User{}
+		err = rows.Scan(&u.Id, &u.Name, &u.Email, &u.Created, &u.Role)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
 func (m *UserModel) Authenticate(email, password string) (int, string, error) {
 	var id int
 	var hashedPassword []byte
@@ -86,3 +157,17 @@ func (m *UserModel) Exists(id int) (bool, error) {
 	err := m.DB.QueryRow(stmt, id).Scan(&exists)
 	return exists, err
 }
+
+// IsOwner reports whether the user owns the company. A user without a role is not an owner.
+func (m *UserModel) IsOwner(id int) (bool, error) {
+	var owner bool
+	stmt := "SELECT CASE WHEN role = 'owner' THEN 1 ELSE 0 END FROM users WHERE id = @p1"
+	err := m.DB.QueryRow(stmt, id).Scan(&owner)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, ErrNoRecord
+		}
+		return false, err
+	}
+	return owner, nil
+}
@@ -2,13 +2,17 @@ package validator
 
 import (
 	"regexp"
-	"strconv"
+	"slices"
 	"strings"
 	"unicode/utf8"
 )
 
 var EmailRegex = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 
+var KodUrzeduRegex = regexp.MustCompile(`^\d{4}$`)
+
+var KodKrajuRegex = regexp.MustCompile(`^[A-Z]{2}$`)
+
 type Validator struct {
 	FieldErrors    map[string]string
 	NonFieldErrors []string
@@ -42,7 +46,7 @@ func NotBlank(value string) bool {
 	return strings.TrimSpace(value) != ""
 }
 
-func NotZero(value float64) bool {
+func NotZero[T ~int | ~int64 | ~float64](value T) bool {
 	return value > 0
 }
 
@@ -50,15 +54,136 @@ func LengthNIP(nip string) bool {
 	return len(nip) == 10
 }
 
+// NumberNIP reports whether the NIP is made of digits only. strconv.Atoi is not enough, it takes a sign.
 func NumberNIP(nip string) bool {
-	_, err := strconv.Atoi(nip)
-	return err == nil
+	if nip == "" {
+		return false
+	}
+	for _, c := range nip {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+var nipWeights = [9]int{6, 5, 7, 2, 3, 4, 5, 6, 7}
+
+// ChecksumNIP checks the control digit of a 10-digit NIP: the weighted sum of the first nine digits
+// modulo 11 must equal the last one.
+func ChecksumNIP(nip string) bool {
+	if !LengthNIP(nip) || !NumberNIP(nip) {
+		return false
+	}
+	sum := 0
+	for i, w := range nipWeights {
+		sum += int(nip[i]-'0') * w
+	}
+	return sum%11 == int(nip[9]-'0')
+}
+
+// vatFormats are the formats of EU VAT numbers without the country prefix. Polish numbers are checked
+// as NIP.
+var vatFormats = map[string]*regexp.Regexp{
+	"AT": regexp.MustCompile(`^U\d{8}$`),
+	"BE": regexp.MustCompile(`^[01]\d{9}$`),
+	"BG": regexp.MustCompile(`^\d{9,10}$`),
+	"CY": regexp.MustCompile(`^\d{8}[A-Z]$`),
+	"CZ": regexp.MustCompile(`^\d{8,10}$`),
+	"DE": regexp.MustCompile(`^\d{9}$`),
+	"DK": regexp.MustCompile(`^\d{8}$`),
+	"EE": regexp.MustCompile(`^\d{9}$`),
+	"ES": regexp.MustCompile(`^[A-Z0-9]\d{7}[A-Z0-9]$`),
+	"FI": regexp.MustCompile(`^\d{8}$`),
+	"FR": regexp.MustCompile(`^[A-HJ-NP-Z0-9]{2}\d{9}$`),
+	"GR": regexp.MustCompile(`^\d{9}$`),
+	"HR": regexp.MustCompile(`^\d{11}$`),
+	"HU": regexp.MustCompile(`^\d{8}$`),
+	"IE": regexp.MustCompile(`^(\d{7}[A-W][A-I]?|\d[A-Z+*]\d{5}[A-W])$`),
+	"IT": regexp.MustCompile(`^\d{11}$`),
+	"LT": regexp.MustCompile(`^(\d{9}|\d{12})$`),
+	"LU": regexp.MustCompile(`^\d{8}$`),
+	"LV": regexp.MustCompile(`^\d{11}$`),
+	"MT": regexp.MustCompile(`^\d{8}$`),
+	"NL": regexp.MustCompile(`^\d{9}B\d{2}$`),
+	"PT": regexp.MustCompile(`^\d{9}$`),
+	"RO": regexp.MustCompile(`^\d{2,10}$`),
+	"SE": regexp.MustCompile(`^\d{12}$`),
+	"SI": regexp.MustCompile(`^\d{8}$`),
+	"SK": regexp.MustCompile(`^\d{10}$`),
+	"XI": regexp.MustCompile(`^(\d{9}|\d{12}|GD\d{3}|HA\d{3})$`),
+}
+
+// VatNumber checks the number against the format of its country. Numbers from outside the EU have no
+// common format and only need to be present.
+func VatNumber(kodKraju, numer string) bool {
+	if kodKraju == "PL" {
+		return ChecksumNIP(numer)
+	}
+	if rx, ok := vatFormats[kodKraju]; ok {
+		return rx.MatchString(numer)
+	}
+	return NotBlank(numer)
+}
+
+// SplitVatNumber separates the country prefix from a VAT number. A number without a prefix is Polish.
+// Greek numbers are prefixed with EL, the JPK uses the ISO code GR.
+func SplitVatNumber(value string) (kodKraju, numer string) {
+	value = strings.ToUpper(value)
+	if len(value) > 2 && isLetter(value[0]) && isLetter(value[1]) {
+		kodKraju, numer = value[:2], value[2:]
+		if kodKraju == "EL" {
+			kodKraju = "GR"
+		}
+		return kodKraju, numer
+	}
+	return "PL", value
+}
+
+func isLetter(c byte) bool {
+	return c >= 'A' && c <= 'Z'
+}
+
+func PermittedValue[T comparable](value T, permittedValues ...T) bool {
+	return slices.Contains(permittedValues, value)
 }
 
 func MinChars(value string, n int) bool {
 	return utf8.RuneCountInString(value) >= n
 }
 
+func MaxChars(value string, n int) bool {
+	return utf8.RuneCountInString(value) <= n
+}
+
 func Matches(value string, rx *regexp.Regexp) bool {
 	return rx.MatchString(value)
 }
+
+var ibanRegex = regexp.MustCompile(`^[A-Z]{2}\d{2}[A-Z0-9]{11,30}$`)
+
+// CompactAccount removes the spaces and dashes bank account numbers are written with.
+func CompactAccount(numer string) string {
+	return strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(numer))
+}
+
+// AccountNumber checks the control digits of a compacted bank account number. A Polish NRB of 26 digits
+// is an IBAN without the PL prefix. The country code and control digits are moved to the end, letters
+// are replaced by 10 to 35 and the number taken modulo 97 must give 1.
+func AccountNumber(numer string) bool {
+	if len(numer) == 26 && NumberNIP(numer) {
+		numer = "PL" + numer
+	}
+	if !ibanRegex.MatchString(numer) {
+		return false
+	}
+	reszta := 0
+	for _, c := range numer[4:] + numer[:4] {
+		if c >= 'A' && c <= 'Z' {
+			reszta = (reszta*100 + int(c-'A') + 10) % 97
+		} else {
+			reszta = (reszta*10 + int(c-'0')) % 97
+		}
+	}
+	return reszta == 1
+}
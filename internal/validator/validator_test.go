@@ -0,0 +1,131 @@
+package validator
+
+import "testing"
+
+func TestChecksumNIP(t *testing.T) {
+	tests := []struct {
+		nip  string
+		want bool
+	}{
+		{"5260250274", true},
+		{"7740001454", true},
+		{"1234563218", true},
+		{"5260250275", false},
+		{"1234563219", false},
+		// the weighted sum gives 10, which no control digit matches
+		{"1234567890", false},
+		{"526025027", false},
+		{"52602502741", false},
+		{"526-025-02-74", false},
+		{"+526025027", false},
+		{"52602502a4", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := ChecksumNIP(tt.nip); got != tt.want {
+			t.Errorf("ChecksumNIP(%q) = %v; want %v", tt.nip, got, tt.want)
+		}
+	}
+}
+
+func TestVatNumber(t *testing.T) {
+	tests := []struct {
+		kodKraju, numer string
+		want            bool
+	}{
+		{"PL", "5260250274", true},
+		{"PL", "5260250275", false},
+		{"AT", "U12345678", true},
+		{"AT", "12345678", false},
+		{"BE", "0123456789", true},
+		{"BE", "2123456789", false},
+		{"DE", "123456789", true},
+		{"DE", "12345678", false},
+		{"ES", "X1234567Z", true},
+		{"FR", "AB123456789", true},
+		{"FR", "IO123456789", false},
+		{"GR", "123456789", true},
+		{"IE", "1234567WA", true},
+		{"IE", "1A23456W", true},
+		{"IE", "1234567", false},
+		{"LT", "123456789012", true},
+		{"LT", "1234567890", false},
+		{"NL", "123456789B01", true},
+		{"NL", "123456789", false},
+		{"SE", "123456789012", true},
+		{"XI", "GD123", true},
+		{"CY", "12345678X", true},
+		{"CY", "123456789", false},
+		// outside the EU any number is accepted
+		{"US", "12-3456789", true},
+		{"US", " ", false},
+	}
+	for _, tt := range tests {
+		if got := VatNumber(tt.kodKraju, tt.numer); got != tt.want {
+			t.Errorf("VatNumber(%q, %q) = %v; want %v", tt.kodKraju, tt.numer, got, tt.want)
+		}
+	}
+}
+
+func TestSplitVatNumber(t *testing.T) {
+	tests := []struct {
+		in                    string
+		wantKodKraju, wantNum string
+	}{
+		{"5260250274", "PL", "5260250274"},
+		{"PL5260250274", "PL", "5260250274"},
+		{"de123456789", "DE", "123456789"},
+		{"EL123456789", "GR", "123456789"},
+		{"el123456789", "GR", "123456789"},
+		{"GR123456789", "GR", "123456789"},
+		{"ATU12345678", "AT", "U12345678"},
+		{"1A23456W", "PL", "1A23456W"},
+		{"DE", "PL", "DE"},
+		{"", "PL", ""},
+	}
+	for _, tt := range tests {
+		kodKraju, numer := SplitVatNumber(tt.in)
+		if kodKraju != tt.wantKodKraju || numer != tt.wantNum {
+			t.Errorf("SplitVatNumber(%q) = %q, %q; want %q, %q", tt.in, kodKraju, numer, tt.wantKodKraju, tt.wantNum)
+		}
+	}
+}
+
+func TestAccountNumber(t *testing.T) {
+	tests := []struct {
+		numer string
+		want  bool
+	}{
+		{"PL61109010140000071219812874", true},
+		{"61109010140000071219812874", true},
+		{"27114020040000300201355387", true},
+		{"61109010140000071219812875", false},
+		{"PL61109010140000071219812875", false},
+		{"PL16109010140000071219812874", false},
+		{"DE89370400440532013000", true},
+		{"GB82WEST12345698765432", true},
+		{"FR1420041010050500013M02606", true},
+		{"GB82WEST12345698765433", false},
+		// the number has to be compacted first
+		{"61 1090 1014 0000 0712 1981 2874", false},
+		{"6110901014000007121981287", false},
+		{"pl61109010140000071219812874", false},
+		{"PL", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := AccountNumber(tt.numer); got != tt.want {
+			t.Errorf("AccountNumber(%q) = %v; want %v", tt.numer, got, tt.want)
+		}
+	}
+}
+
+func TestCompactAccount(t *testing.T) {
+	got := CompactAccount("pl 61 1090-1014 0000 0712 1981 2874")
+	if want := "PL61109010140000071219812874"; got != want {
+		t.Errorf("CompactAccount() = %q; want %q", got, want)
+	}
+	if !AccountNumber(got) {
+		t.Errorf("AccountNumber(%q) = false; want true", got)
+	}
+}
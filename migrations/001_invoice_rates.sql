@@ -0,0 +1,20 @@
+-- Net and tax amounts of an invoice per VAT rate.
+IF OBJECT_ID('dbo.InvoiceRates', 'U') IS NULL
+CREATE TABLE dbo.InvoiceRates (
+    id         INT IDENTITY(1, 1) NOT NULL CONSTRAINT PK_InvoiceRates PRIMARY KEY,
+    invoice_id INT NOT NULL CONSTRAINT FK_InvoiceRates_Invoices REFERENCES dbo.Invoices (id),
+    stawka     NVARCHAR(10) NOT NULL,
+    netto      DECIMAL(18, 2) NOT NULL,
+    podatek    DECIMAL(18, 2) NOT NULL
+);
+GO
+
+IF NOT EXISTS (SELECT 1 FROM sys.indexes WHERE name = 'IX_InvoiceRates_invoice_id' AND object_id = OBJECT_ID('dbo.InvoiceRates'))
+CREATE INDEX IX_InvoiceRates_invoice_id ON dbo.InvoiceRates (invoice_id);
+GO
+
+-- Invoices stored before rates were introduced keep their totals at 23%.
+INSERT INTO dbo.InvoiceRates (invoice_id, stawka, netto, podatek)
+SELECT i.id, '23', i.netto, i.podatek FROM dbo.Invoices i
+WHERE NOT EXISTS (SELECT 1 FROM dbo.InvoiceRates r WHERE r.invoice_id = i.id);
+GO
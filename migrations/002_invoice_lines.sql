@@ -0,0 +1,19 @@
+-- Line items of an invoice. The per-rate amounts and the totals of the invoice are derived from them.
+IF OBJECT_ID('dbo.InvoiceLines', 'U') IS NULL
+CREATE TABLE dbo.InvoiceLines (
+    id         INT IDENTITY(1, 1) NOT NULL CONSTRAINT PK_InvoiceLines PRIMARY KEY,
+    invoice_id INT NOT NULL CONSTRAINT FK_InvoiceLines_Invoices REFERENCES dbo.Invoices (id),
+    lp         INT NOT NULL,
+    opis       NVARCHAR(MAX) NOT NULL,
+    ilosc      DECIMAL(16, 6) NOT NULL,
+    jednostka  NVARCHAR(20) NOT NULL,
+    cena_netto DECIMAL(18, 2) NOT NULL,
+    stawka     NVARCHAR(10) NOT NULL,
+    netto      DECIMAL(18, 2) NOT NULL,
+    podatek    DECIMAL(18, 2) NOT NULL
+);
+GO
+
+IF NOT EXISTS (SELECT 1 FROM sys.indexes WHERE name = 'IX_InvoiceLines_invoice_id' AND object_id = OBJECT_ID('dbo.InvoiceLines'))
+CREATE INDEX IX_InvoiceLines_invoice_id ON dbo.InvoiceLines (invoice_id, lp);
+GO
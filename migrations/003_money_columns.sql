@@ -0,0 +1,8 @@
+-- Amounts are stored exactly in zloty and grosze instead of floating point.
+IF EXISTS (SELECT 1 FROM sys.columns WHERE object_id = OBJECT_ID('dbo.Invoices') AND name = 'netto' AND system_type_id <> TYPE_ID('decimal'))
+ALTER TABLE dbo.Invoices ALTER COLUMN netto DECIMAL(18, 2) NOT NULL;
+GO
+
+IF EXISTS (SELECT 1 FROM sys.columns WHERE object_id = OBJECT_ID('dbo.Invoices') AND name = 'podatek' AND system_type_id <> TYPE_ID('decimal'))
+ALTER TABLE dbo.Invoices ALTER COLUMN podatek DECIMAL(18, 2) NOT NULL;
+GO
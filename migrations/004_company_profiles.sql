@@ -0,0 +1,14 @@
+-- Tax profile of a company, the Podmiot1 of its JPK files.
+IF OBJECT_ID('dbo.CompanyProfiles', 'U') IS NULL
+CREATE TABLE dbo.CompanyProfiles (
+    company_nip    NVARCHAR(10) NOT NULL CONSTRAINT PK_CompanyProfiles PRIMARY KEY,
+    pelna_nazwa    NVARCHAR(255) NOT NULL,
+    email          NVARCHAR(255) NOT NULL,
+    telefon        NVARCHAR(32) NOT NULL,
+    kod_urzedu     NVARCHAR(4) NOT NULL,
+    osoba_fizyczna BIT NOT NULL,
+    imie           NVARCHAR(255) NOT NULL,
+    nazwisko       NVARCHAR(255) NOT NULL,
+    data_urodzenia DATE NULL
+);
+GO
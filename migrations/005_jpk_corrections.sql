@@ -0,0 +1,8 @@
+-- Purpose of a JPK file, 1 for an original submission and 2 for a correction, and the file it corrects.
+IF COL_LENGTH('dbo.JpkFiles', 'cel') IS NULL
+ALTER TABLE dbo.JpkFiles ADD cel INT NOT NULL CONSTRAINT DF_JpkFiles_cel DEFAULT 1;
+GO
+
+IF COL_LENGTH('dbo.JpkFiles', 'corrects_id') IS NULL
+ALTER TABLE dbo.JpkFiles ADD corrects_id INT NULL CONSTRAINT FK_JpkFiles_corrects REFERENCES dbo.JpkFiles (id);
+GO
@@ -0,0 +1,5 @@
+-- Schema violations found when the file was generated, one per line. A file with violations cannot be
+-- confirmed.
+IF COL_LENGTH('dbo.JpkFiles', 'validation_errors') IS NULL
+ALTER TABLE dbo.JpkFiles ADD validation_errors NVARCHAR(MAX) NULL;
+GO
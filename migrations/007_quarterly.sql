@@ -0,0 +1,4 @@
+-- Companies settling VAT quarterly file JPK_V7K instead of JPK_V7M.
+IF COL_LENGTH('dbo.CompanyProfiles', 'kwartalnie') IS NULL
+ALTER TABLE dbo.CompanyProfiles ADD kwartalnie BIT NOT NULL CONSTRAINT DF_CompanyProfiles_kwartalnie DEFAULT 0;
+GO
@@ -0,0 +1,9 @@
+-- GTU codes and procedure markings of an invoice, reported in its JPK row.
+IF OBJECT_ID('dbo.InvoiceMarkers', 'U') IS NULL
+CREATE TABLE dbo.InvoiceMarkers (
+    id         INT IDENTITY(1, 1) NOT NULL CONSTRAINT PK_InvoiceMarkers PRIMARY KEY,
+    invoice_id INT NOT NULL CONSTRAINT FK_InvoiceMarkers_Invoices REFERENCES dbo.Invoices (id),
+    kod        NVARCHAR(20) NOT NULL,
+    CONSTRAINT UQ_InvoiceMarkers UNIQUE (invoice_id, kod)
+);
+GO
@@ -0,0 +1,5 @@
+-- Type of the sale or purchase document: VAT, RO, WEW, FP or VAT_RR. Invoices stored before the
+-- column was added are read as VAT.
+IF COL_LENGTH('dbo.Invoices', 'doc_type') IS NULL
+ALTER TABLE dbo.Invoices ADD doc_type NVARCHAR(10) NULL;
+GO
@@ -0,0 +1,16 @@
+-- Excess of input VAT carried from a confirmed period to the next one. The amounts are in whole zloty,
+-- as in the declaration.
+IF OBJECT_ID('dbo.VatCarryForward', 'U') IS NULL
+CREATE TABLE dbo.VatCarryForward (
+    company_nip  NVARCHAR(10) NOT NULL,
+    year         INT NOT NULL,
+    month        INT NOT NULL,
+    jpk_id       INT NOT NULL CONSTRAINT FK_VatCarryForward_JpkFiles REFERENCES dbo.JpkFiles (id),
+    p_39         INT NOT NULL,
+    p_51         INT NOT NULL,
+    p_53         INT NOT NULL,
+    p_62         INT NOT NULL,
+    confirmed_at DATETIME2 NOT NULL,
+    CONSTRAINT PK_VatCarryForward PRIMARY KEY (company_nip, year, month)
+);
+GO
@@ -0,0 +1,16 @@
+-- Changes of an edited invoice, one row per changed field.
+IF OBJECT_ID('dbo.InvoiceHistory', 'U') IS NULL
+CREATE TABLE dbo.InvoiceHistory (
+    id         INT IDENTITY(1, 1) NOT NULL CONSTRAINT PK_InvoiceHistory PRIMARY KEY,
+    invoice_id INT NOT NULL CONSTRAINT FK_InvoiceHistory_Invoices REFERENCES dbo.Invoices (id),
+    user_id    INT NULL,
+    changed_at DATETIME2 NOT NULL,
+    pole       NVARCHAR(50) NOT NULL,
+    przed      NVARCHAR(MAX) NOT NULL,
+    po         NVARCHAR(MAX) NOT NULL
+);
+GO
+
+IF NOT EXISTS (SELECT 1 FROM sys.indexes WHERE name = 'IX_InvoiceHistory_invoice_id' AND object_id = OBJECT_ID('dbo.InvoiceHistory'))
+CREATE INDEX IX_InvoiceHistory_invoice_id ON dbo.InvoiceHistory (invoice_id, changed_at);
+GO
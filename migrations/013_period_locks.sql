@@ -0,0 +1,40 @@
+-- Periods closed by a confirmed JPK file, and the log of their unlocks by the company owner.
+IF OBJECT_ID('dbo.PeriodLocks', 'U') IS NULL
+CREATE TABLE dbo.PeriodLocks (
+    company_nip NVARCHAR(10) NOT NULL,
+    year        INT NOT NULL,
+    month       INT NOT NULL,
+    jpk_id      INT NOT NULL CONSTRAINT FK_PeriodLocks_JpkFiles REFERENCES dbo.JpkFiles (id),
+    locked_at   DATETIME2 NOT NULL,
+    CONSTRAINT PK_PeriodLocks PRIMARY KEY (company_nip, year, month)
+);
+GO
+
+IF OBJECT_ID('dbo.PeriodUnlocks', 'U') IS NULL
+CREATE TABLE dbo.PeriodUnlocks (
+    id          INT IDENTITY(1, 1) NOT NULL CONSTRAINT PK_PeriodUnlocks PRIMARY KEY,
+    company_nip NVARCHAR(10) NOT NULL,
+    year        INT NOT NULL,
+    month       INT NOT NULL,
+    user_id     INT NOT NULL,
+    powod       NVARCHAR(MAX) NOT NULL,
+    unlocked_at DATETIME2 NOT NULL
+);
+GO
+
+-- Role of the user in the company, 'owner' or 'user'. Until now every account was created by signing a
+-- company up, so the existing users own their companies.
+IF COL_LENGTH('dbo.Users', 'role') IS NULL
+ALTER TABLE dbo.Users ADD role NVARCHAR(10) NULL;
+GO
+
+UPDATE dbo.Users SET role = 'owner' WHERE role IS NULL;
+GO
+
+IF EXISTS (SELECT 1 FROM sys.columns WHERE object_id = OBJECT_ID('dbo.Users') AND name = 'role' AND is_nullable = 1)
+ALTER TABLE dbo.Users ALTER COLUMN role NVARCHAR(10) NOT NULL;
+GO
+
+IF OBJECT_ID('dbo.CK_Users_role', 'C') IS NULL
+ALTER TABLE dbo.Users ADD CONSTRAINT CK_Users_role CHECK (role IN ('owner', 'user'));
+GO
@@ -0,0 +1,36 @@
+-- Contractor registry. Contractors used to be shared by all companies and keyed by NIP alone, now each
+-- company keeps its own entries, identified by id.
+IF COL_LENGTH('dbo.Companies', 'company_nip') IS NULL
+ALTER TABLE dbo.Companies ADD company_nip NVARCHAR(10) NULL;
+GO
+
+IF COL_LENGTH('dbo.Companies', 'kod_kraju') IS NULL
+ALTER TABLE dbo.Companies ADD kod_kraju NVARCHAR(2) NOT NULL CONSTRAINT DF_Companies_kod_kraju DEFAULT 'PL';
+GO
+
+-- the old key on the NIP alone does not allow the same contractor in two companies
+DECLARE @pk SYSNAME = (SELECT k.name FROM sys.key_constraints k WHERE k.parent_object_id = OBJECT_ID('dbo.Companies') AND k.type = 'PK'
+    AND NOT EXISTS (SELECT 1 FROM sys.index_columns ic JOIN sys.columns c ON c.object_id = ic.object_id AND c.column_id = ic.column_id
+        WHERE ic.object_id = k.parent_object_id AND ic.index_id = k.unique_index_id AND c.name = 'id'));
+IF @pk IS NOT NULL
+EXEC ('ALTER TABLE dbo.Companies DROP CONSTRAINT ' + @pk);
+GO
+
+-- a shared entry is copied to every company with invoices of the contractor
+INSERT INTO dbo.Companies (company_nip, nip, nazwa, kod_kraju)
+SELECT DISTINCT i.company_nip, c.nip, c.nazwa, c.kod_kraju FROM dbo.Companies c JOIN dbo.Invoices i ON i.nip = c.nip
+WHERE c.company_nip IS NULL;
+DELETE FROM dbo.Companies WHERE company_nip IS NULL;
+GO
+
+IF EXISTS (SELECT 1 FROM sys.columns WHERE object_id = OBJECT_ID('dbo.Companies') AND name = 'company_nip' AND is_nullable = 1)
+ALTER TABLE dbo.Companies ALTER COLUMN company_nip NVARCHAR(10) NOT NULL;
+GO
+
+IF COL_LENGTH('dbo.Companies', 'id') IS NULL
+ALTER TABLE dbo.Companies ADD id INT IDENTITY(1, 1) NOT NULL CONSTRAINT PK_Companies PRIMARY KEY;
+GO
+
+IF OBJECT_ID('dbo.UQ_Companies_nip', 'UQ') IS NULL
+ALTER TABLE dbo.Companies ADD CONSTRAINT UQ_Companies_nip UNIQUE (company_nip, nip);
+GO
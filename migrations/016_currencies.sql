@@ -0,0 +1,22 @@
+-- NBP average exchange rates, in zloty per unit of currency.
+IF OBJECT_ID('dbo.ExchangeRates', 'U') IS NULL
+CREATE TABLE dbo.ExchangeRates (
+    waluta NVARCHAR(3) NOT NULL,
+    data   DATE NOT NULL,
+    kurs   DECIMAL(10, 4) NOT NULL,
+    tabela NVARCHAR(20) NOT NULL,
+    CONSTRAINT PK_ExchangeRates PRIMARY KEY (waluta, data)
+);
+GO
+
+-- Currency of an invoice with the rate used to convert it and the amounts in that currency. Invoices
+-- stored before are read as zloty.
+IF COL_LENGTH('dbo.Invoices', 'waluta') IS NULL
+ALTER TABLE dbo.Invoices ADD
+    waluta         NVARCHAR(3) NULL,
+    kurs           DECIMAL(10, 4) NULL,
+    kurs_data      DATE NULL,
+    tabela_nbp     NVARCHAR(20) NULL,
+    netto_waluta   DECIMAL(18, 2) NULL,
+    podatek_waluta DECIMAL(18, 2) NULL;
+GO
@@ -0,0 +1,5 @@
+-- Kind of transaction: domestic, WDT, WNT, import of services or a reverse-charge purchase. Invoices
+-- stored before are read as domestic.
+IF COL_LENGTH('dbo.Invoices', 'transakcja') IS NULL
+ALTER TABLE dbo.Invoices ADD transakcja NVARCHAR(20) NULL;
+GO
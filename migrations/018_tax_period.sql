@@ -0,0 +1,8 @@
+-- Date of sale and date of receipt of the document, and the month the invoice is reported in. Invoices
+-- stored before are reported in the month of their issue date.
+IF COL_LENGTH('dbo.Invoices', 'okres') IS NULL
+ALTER TABLE dbo.Invoices ADD
+    data_sprzedazy DATE NULL,
+    data_wplywu    DATE NULL,
+    okres          DATE NULL;
+GO
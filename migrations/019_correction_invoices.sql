@@ -0,0 +1,12 @@
+-- Correction invoices point to the invoice they correct. blad_pierwotny marks a correction of an error
+-- in the original invoice, reported in the period of that invoice.
+IF COL_LENGTH('dbo.Invoices', 'korekta_do') IS NULL
+ALTER TABLE dbo.Invoices ADD
+    korekta_do        INT NULL CONSTRAINT FK_Invoices_korekta_do REFERENCES dbo.Invoices (id),
+    przyczyna_korekty NVARCHAR(MAX) NULL,
+    blad_pierwotny    BIT NULL;
+GO
+
+IF NOT EXISTS (SELECT 1 FROM sys.indexes WHERE name = 'IX_Invoices_korekta_do' AND object_id = OBJECT_ID('dbo.Invoices'))
+CREATE INDEX IX_Invoices_korekta_do ON dbo.Invoices (korekta_do) WHERE korekta_do IS NOT NULL;
+GO
@@ -0,0 +1,11 @@
+-- Share of the VAT on a purchase that is deducted: 100, 50 for cars, WSP for the company proportion or
+-- 0, with the proportion in percent used for WSP. The company proportion is kept in its profile.
+IF COL_LENGTH('dbo.Invoices', 'odliczenie') IS NULL
+ALTER TABLE dbo.Invoices ADD
+    odliczenie NVARCHAR(3) NULL,
+    proporcja  INT NULL;
+GO
+
+IF COL_LENGTH('dbo.CompanyProfiles', 'proporcja') IS NULL
+ALTER TABLE dbo.CompanyProfiles ADD proporcja INT NULL;
+GO
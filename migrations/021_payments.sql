@@ -0,0 +1,19 @@
+-- Payments recorded against invoices. Under the cash accounting method, set in the company profile, an
+-- invoice is reported in the periods of its payments.
+IF OBJECT_ID('dbo.Payments', 'U') IS NULL
+CREATE TABLE dbo.Payments (
+    id          INT IDENTITY(1, 1) NOT NULL CONSTRAINT PK_Payments PRIMARY KEY,
+    invoice_id  INT NOT NULL CONSTRAINT FK_Payments_Invoices REFERENCES dbo.Invoices (id),
+    company_nip NVARCHAR(10) NOT NULL,
+    data        DATE NOT NULL,
+    kwota       DECIMAL(18, 2) NOT NULL
+);
+GO
+
+IF NOT EXISTS (SELECT 1 FROM sys.indexes WHERE name = 'IX_Payments_invoice_id' AND object_id = OBJECT_ID('dbo.Payments'))
+CREATE INDEX IX_Payments_invoice_id ON dbo.Payments (invoice_id, data);
+GO
+
+IF COL_LENGTH('dbo.CompanyProfiles', 'metoda_kasowa') IS NULL
+ALTER TABLE dbo.CompanyProfiles ADD metoda_kasowa BIT NULL;
+GO
@@ -0,0 +1,17 @@
+-- Bad-debt relief applied to unpaid sale invoices, in the period the relief was claimed. An invoice can
+-- be relieved once.
+IF OBJECT_ID('dbo.BadDebts', 'U') IS NULL
+CREATE TABLE dbo.BadDebts (
+    id          INT IDENTITY(1, 1) NOT NULL CONSTRAINT PK_BadDebts PRIMARY KEY,
+    invoice_id  INT NOT NULL CONSTRAINT FK_BadDebts_Invoices REFERENCES dbo.Invoices (id),
+    company_nip NVARCHAR(10) NOT NULL,
+    okres       DATE NOT NULL,
+    created_at  DATETIME2 NOT NULL,
+    CONSTRAINT UQ_BadDebts_invoice UNIQUE (company_nip, invoice_id)
+);
+GO
+
+-- The relief is counted from the payment due date of the invoice.
+IF COL_LENGTH('dbo.Invoices', 'termin_platnosci') IS NULL
+ALTER TABLE dbo.Invoices ADD termin_platnosci DATE NULL;
+GO
@@ -0,0 +1,10 @@
+-- Payment method and bank account of an invoice, and the method of each payment.
+IF COL_LENGTH('dbo.Invoices', 'sposob_platnosci') IS NULL
+ALTER TABLE dbo.Invoices ADD
+    sposob_platnosci NVARCHAR(20) NULL,
+    nr_rachunku      NVARCHAR(34) NULL;
+GO
+
+IF COL_LENGTH('dbo.Payments', 'sposob') IS NULL
+ALTER TABLE dbo.Payments ADD sposob NVARCHAR(20) NULL;
+GO
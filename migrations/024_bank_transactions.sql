@@ -0,0 +1,23 @@
+-- Transactions imported from MT940 and CAMT.053 bank statements. invoice_id is the invoice proposed by
+-- matching, payment_id the payment recorded when the match was confirmed.
+IF OBJECT_ID('dbo.BankTransactions', 'U') IS NULL
+CREATE TABLE dbo.BankTransactions (
+    id          INT IDENTITY(1, 1) NOT NULL CONSTRAINT PK_BankTransactions PRIMARY KEY,
+    company_nip NVARCHAR(10) NOT NULL,
+    data        DATE NOT NULL,
+    kwota       DECIMAL(18, 2) NOT NULL,
+    waluta      NVARCHAR(3) NOT NULL,
+    tytul       NVARCHAR(MAX) NOT NULL,
+    kontrahent  NVARCHAR(MAX) NOT NULL,
+    rachunek    NVARCHAR(255) NOT NULL,
+    referencja  NVARCHAR(255) NOT NULL,
+    invoice_id  INT NULL CONSTRAINT FK_BankTransactions_Invoices REFERENCES dbo.Invoices (id),
+    payment_id  INT NULL CONSTRAINT FK_BankTransactions_Payments REFERENCES dbo.Payments (id),
+    ignored     BIT NOT NULL CONSTRAINT DF_BankTransactions_ignored DEFAULT 0,
+    created_at  DATETIME2 NOT NULL
+);
+GO
+
+IF NOT EXISTS (SELECT 1 FROM sys.indexes WHERE name = 'IX_BankTransactions_company' AND object_id = OBJECT_ID('dbo.BankTransactions'))
+CREATE INDEX IX_BankTransactions_company ON dbo.BankTransactions (company_nip, data);
+GO
@@ -0,0 +1,10 @@
+-- Bank account of the company, debited by the exported split payment transfers.
+IF COL_LENGTH('dbo.CompanyProfiles', 'nr_rachunku') IS NULL
+ALTER TABLE dbo.CompanyProfiles ADD nr_rachunku NVARCHAR(34) NULL;
+GO
+
+-- Set when the MPP marker of the invoice was added because the split payment is mandatory, so that it
+-- can be taken away when an edit makes it optional. Markers stored before are kept as set by the user.
+IF COL_LENGTH('dbo.Invoices', 'mpp_auto') IS NULL
+ALTER TABLE dbo.Invoices ADD mpp_auto BIT NULL;
+GO
@@ -1,8 +1,123 @@
 document.addEventListener("DOMContentLoaded", () => {
         const dateInput = document.getElementById("dateInput");
-        if (dateInput) {
+        if (dateInput && !dateInput.value) {
             const d = new Date();
             d.setMonth(d.getMonth() - 1);
             dateInput.value = d.toISOString().split('T')[0];
         }
+
+        const nipInput = document.getElementById("nipInput");
+        const nazwaInput = document.getElementById("nazwaInput");
+        if (nipInput && nazwaInput) {
+            // picking a contractor from the registry fills the other field
+            nipInput.addEventListener("input", () => {
+                for (const option of document.getElementById("contractorNips").options) {
+                    if (option.value === nipInput.value) {
+                        nazwaInput.value = option.dataset.nazwa;
+                    }
+                }
+            });
+            nazwaInput.addEventListener("input", () => {
+                for (const option of document.getElementById("contractorNames").options) {
+                    if (option.value === nazwaInput.value) {
+                        nipInput.value = option.dataset.nip;
+                    }
+                }
+            });
+        }
+
+        const typeSelect = document.getElementById("typeSelect");
+        const saleMarkers = document.getElementById("saleMarkers");
+        const purchaseMarkers = document.getElementById("purchaseMarkers");
+        const purchaseDates = document.getElementById("purchaseDates");
+        const documentSelect = document.getElementById("documentSelect");
+        const documents = {
+            SALE: ["VAT", "RO", "WEW", "FP"],
+            PURC: ["VAT", "MK", "VAT_RR", "WEW"],
+        };
+
+        const transactionSelect = document.getElementById("transactionSelect");
+        const transactions = {
+            SALE: ["KRAJ", "WDT"],
+            PURC: ["KRAJ", "WNT", "IMPORT_USLUG_28B", "IMPORT_USLUG", "OO"],
+        };
+
+        function updateTransactions() {
+            const allowed = transactions[typeSelect.value] || [];
+            for (const option of transactionSelect.options) {
+                option.hidden = !allowed.includes(option.value);
+            }
+            if (transactionSelect.selectedOptions[0].hidden) {
+                transactionSelect.value = "KRAJ";
+            }
+        }
+
+        function updateDocuments() {
+            const allowed = documents[typeSelect.value] || [];
+            for (const option of documentSelect.options) {
+                option.hidden = !allowed.includes(option.value);
+            }
+            if (documentSelect.selectedOptions[0].hidden) {
+                documentSelect.value = "VAT";
+            }
+        }
+
+        if (typeSelect && saleMarkers && purchaseMarkers) {
+            typeSelect.addEventListener("change", () => {
+                saleMarkers.hidden = typeSelect.value !== "SALE";
+                purchaseMarkers.hidden = typeSelect.value === "SALE";
+            });
+        }
+        if (typeSelect && purchaseDates) {
+            typeSelect.addEventListener("change", () => {
+                purchaseDates.hidden = typeSelect.value === "SALE";
+            });
+        }
+        if (typeSelect && documentSelect) {
+            updateDocuments();
+            typeSelect.addEventListener("change", updateDocuments);
+        }
+        if (typeSelect && transactionSelect) {
+            updateTransactions();
+            typeSelect.addEventListener("change", updateTransactions);
+        }
+
+        const linesBody = document.getElementById("linesBody");
+        const addLine = document.getElementById("addLine");
+        if (!linesBody || !addLine) {
+            return;
+        }
+
+        function updateNetto(row) {
+            const ilosc = parseFloat(row.querySelector("input[name='ilosc']").value) || 0;
+            const cena = parseFloat(row.querySelector("input[name='cena']").value) || 0;
+            row.querySelector(".line-netto").innerText = (Math.round(ilosc * cena * 100) / 100).toFixed(2);
+        }
+
+        linesBody.addEventListener("input", (e) => {
+            const row = e.target.closest("tr.line-row");
+            if (row) {
+                updateNetto(row);
+            }
+        });
+
+        linesBody.addEventListener("click", (e) => {
+            if (!e.target.classList.contains("remove-line")) {
+                return;
+            }
+            const rows = linesBody.querySelectorAll("tr.line-row");
+            if (rows.length > 1) {
+                e.target.closest("tr.line-row").remove();
+            }
+        });
+
+        addLine.addEventListener("click", () => {
+            const rows = linesBody.querySelectorAll("tr.line-row");
+            const row = rows[rows.length - 1].cloneNode(true);
+            row.querySelector("input[name='opis']").value = "";
+            row.querySelector("input[name='ilosc']").value = "1";
+            row.querySelector("input[name='cena']").value = "";
+            updateNetto(row);
+            linesBody.appendChild(row);
+        });
     });
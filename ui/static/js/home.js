@@ -0,0 +1,22 @@
+document.addEventListener("DOMContentLoaded", () => {
+    const zwrotTermin = document.getElementById("zwrotTermin");
+    const zwrotKwota = document.getElementById("zwrotKwota");
+    if (!zwrotTermin || !zwrotKwota) {
+        return;
+    }
+
+    const zaliczenieKwota = document.getElementById("zaliczenieKwota");
+    const zaliczenieRodzaj = document.getElementById("zaliczenieRodzaj");
+
+    zwrotTermin.addEventListener("change", () => {
+        zwrotKwota.hidden = zwrotTermin.value === "";
+        zwrotKwota.required = zwrotTermin.value !== "";
+        zaliczenieKwota.hidden = zwrotTermin.value === "";
+        zaliczenieRodzaj.hidden = zwrotTermin.value === "";
+    });
+
+    // the kind of the liability is required once a part of the refund is offset against it
+    zaliczenieKwota.addEventListener("input", () => {
+        zaliczenieRodzaj.required = zaliczenieKwota.value !== "";
+    });
+});
@@ -0,0 +1,14 @@
+document.addEventListener("DOMContentLoaded", () => {
+    const checkbox = document.getElementById("osobaFizyczna");
+    if (!checkbox) {
+        return;
+    }
+
+    function toggle() {
+        document.querySelectorAll(".fizyczna").forEach(el => el.hidden = !checkbox.checked);
+        document.querySelectorAll(".niefizyczna").forEach(el => el.hidden = checkbox.checked);
+    }
+
+    checkbox.addEventListener("change", toggle);
+    toggle();
+});
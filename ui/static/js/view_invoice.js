@@ -1,18 +1,8 @@
 document.addEventListener("DOMContentLoaded", function() {
-    const nettoEl = document.querySelector('.val-netto');
-    const podatekEl = document.querySelector('.val-podatek');
-    const bruttoEl = document.querySelector('.val-brutto');
+    const values = document.querySelectorAll('.val-netto, .val-podatek, .val-brutto');
 
-    function formatMoney(value) {
-        return value.toFixed(2) + ' PLN';
-    }
-
-    if (nettoEl && podatekEl && bruttoEl) {
-        const netto = parseFloat(nettoEl.innerText) || 0;
-        const podatek = parseFloat(podatekEl.innerText) || 0;
-        const sum = netto + podatek;
-        nettoEl.innerText = formatMoney(netto);
-        podatekEl.innerText = formatMoney(podatek);
-        bruttoEl.innerText = formatMoney(sum);
-    }
+    // amounts are rendered by the server with two decimals already, only the currency is added here
+    values.forEach(el => {
+        el.innerText = el.innerText.trim() + ' PLN';
+    });
 });